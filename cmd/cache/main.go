@@ -21,17 +21,57 @@ import (
 	"time"
 )
 
+// defaultCacheTTL is the TTL of the cached url without expiry
+const defaultCacheTTL = time.Hour * 24
+
 var (
 	client *redis.Client
 	cfg    *config.AppConfig
 	logger *zap.Logger
 )
 
+type cacheEntry struct {
+	Url       string     `json:"url"`
+	Alias     string     `json:"alias"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// cachedUrl is the value of the cached alias. Urls cached by previous versions are stored as is
+type cachedUrl struct {
+	Url       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func encodeCachedUrl(e cacheEntry) string {
+	bs, _ := json.Marshal(cachedUrl{Url: e.Url, ExpiresAt: e.ExpiresAt})
+	return string(bs)
+}
+
+// decodeCachedUrl returns cached url and its expiry time. Zero time is returned for urls that never expire,
+// nil is returned if the expiry time is unknown
+func decodeCachedUrl(value string) (string, *time.Time) {
+	var v cachedUrl
+	if !strings.HasPrefix(value, "{") || json.Unmarshal([]byte(value), &v) != nil {
+		return value, nil
+	}
+	if v.ExpiresAt == nil {
+		v.ExpiresAt = &time.Time{}
+	}
+	return v.Url, v.ExpiresAt
+}
+
+// cacheTTL returns TTL of the cached url. Cached entry must never outlive the url itself,
+// so non-positive TTL is returned for expired urls
+func cacheTTL(expiresAt *time.Time) time.Duration {
+	ttl := defaultCacheTTL
+	if expiresAt != nil {
+		ttl = min(ttl, time.Until(*expiresAt))
+	}
+	return ttl
+}
+
 func putCacheUrlAlias(w http.ResponseWriter, r *http.Request) {
-	request := struct {
-		Url   string `json:"url"`
-		Alias string `json:"alias"`
-	}{}
+	var request cacheEntry
 	defer r.Body.Close()
 
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -70,7 +110,14 @@ func putCacheUrlAlias(w http.ResponseWriter, r *http.Request) {
 		zap.String("alias", request.Alias),
 	)
 
-	err = client.Set(context.Background(), request.Alias, request.Url, time.Hour*24).Err()
+	ttl := cacheTTL(request.ExpiresAt)
+	if ttl <= 0 {
+		logger.Info("url has expired, not cached")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	err = client.Set(context.Background(), request.Alias, encodeCachedUrl(request), ttl).Err()
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
 			w.WriteHeader(http.StatusRequestTimeout)
@@ -85,6 +132,60 @@ func putCacheUrlAlias(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func putCacheUrlAliases(w http.ResponseWriter, r *http.Request) {
+	var request []cacheEntry
+	defer r.Body.Close()
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/problem+json")
+		if errors.Is(err, io.EOF) {
+			w.WriteHeader(http.StatusOK)
+			response := resp.ErrorMsg("content empty")
+			bs, _ := json.Marshal(&response)
+			w.Write(bs)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			response := resp.ErrorMsg("content decode error")
+			bs, _ := json.Marshal(&response)
+			w.Write(bs)
+		}
+
+		logger.Error("request decode error", trace.AsZapError(err))
+		return
+	}
+
+	// all entries are set in a single round trip
+	pipe := client.Pipeline()
+	for _, entry := range request {
+		entry.Url = strings.TrimSpace(entry.Url)
+		entry.Alias = strings.TrimSpace(entry.Alias)
+		if entry.Url == "" || entry.Alias == "" {
+			continue
+		}
+		ttl := cacheTTL(entry.ExpiresAt)
+		if ttl <= 0 {
+			continue
+		}
+		pipe.Set(context.Background(), entry.Alias, encodeCachedUrl(entry), ttl)
+	}
+
+	n := pipe.Len()
+	_, err = pipe.Exec(context.Background())
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			w.WriteHeader(http.StatusRequestTimeout)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Error("cache error", trace.AsZapError(err))
+		return
+	}
+
+	logger.Info("cached urls", zap.Int("count", n))
+	w.WriteHeader(http.StatusOK)
+}
+
 func getCacheUrlAlias(w http.ResponseWriter, r *http.Request) {
 	var alias string
 	defer r.Body.Close()
@@ -96,7 +197,7 @@ func getCacheUrlAlias(w http.ResponseWriter, r *http.Request) {
 		alias = varsAlias
 	}
 
-	url, err := client.Get(context.Background(), alias).Result()
+	value, err := client.Get(context.Background(), alias).Result()
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
 			w.WriteHeader(http.StatusRequestTimeout)
@@ -115,9 +216,11 @@ func getCacheUrlAlias(w http.ResponseWriter, r *http.Request) {
 	response := struct {
 		resp.BaseResponse
 		Url string `json:"url"`
+		// ExpiresAt is zero time for urls that never expire, it is omitted if the expiry time is unknown
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
 	}{}
 	response.BaseResponse = resp.Ok()
-	response.Url = url
+	response.Url, response.ExpiresAt = decodeCachedUrl(value)
 
 	bs, err := json.Marshal(&response)
 	if err != nil {
@@ -130,6 +233,32 @@ func getCacheUrlAlias(w http.ResponseWriter, r *http.Request) {
 	w.Write(bs)
 }
 
+func deleteCacheUrlAlias(w http.ResponseWriter, r *http.Request) {
+	var alias string
+	defer r.Body.Close()
+
+	if varsAlias, ok := mux.Vars(r)["alias"]; !ok {
+		logger.Error("segment not found", zap.String("segment", "alias"))
+		return
+	} else {
+		alias = varsAlias
+	}
+
+	err := client.Del(context.Background(), alias).Err()
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			w.WriteHeader(http.StatusRequestTimeout)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Error("delete from cache error", trace.AsZapError(err))
+		return
+	}
+
+	logger.Info("removed cached url", zap.String("alias", alias))
+	w.WriteHeader(http.StatusOK)
+}
+
 func main() {
 	var err error
 	cfg = config.MustLoad()
@@ -147,7 +276,9 @@ func main() {
 
 	serverMux := mux.NewRouter()
 	serverMux.Methods("GET").Path("/{alias}").HandlerFunc(getCacheUrlAlias)
+	serverMux.Methods("DELETE").Path("/{alias}").HandlerFunc(deleteCacheUrlAlias)
 	serverMux.Methods("POST").Path("/set").HandlerFunc(putCacheUrlAlias)
+	serverMux.Methods("POST").Path("/set/batch").HandlerFunc(putCacheUrlAliases)
 	serverMux.Use(
 		middleware.NewRequestId(),
 		middleware.NewLogging(logger),
@@ -167,11 +298,12 @@ func main() {
 		}
 	}()
 
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 
 	<-c
-	ctx, _ := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
 	serv.Shutdown(ctx)
 
 	log.Print("Shut down")
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sajoniks/GoShort/internal/auth"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/sajoniks/GoShort/internal/store/sqlite"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage:
+  go-short                      run the server
+  go-short keys add <owner>     create api key for the owner
+  go-short keys list            list api keys
+  go-short keys revoke <id>     revoke api key
+  go-short migrate up           apply pending database migrations
+  go-short migrate down [n]     revert n latest migrations, 1 by default
+  go-short migrate status       list migrations and their state`
+
+// runCommand runs admin subcommand and returns exit code
+func runCommand(args []string) int {
+	switch args[0] {
+	case "keys":
+		if err := runKeysCommand(args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	case "migrate":
+		if err := runMigrateCommand(args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+}
+
+func runKeysCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	cfg := config.MustLoad()
+	store, err := newStore(&cfg.Database, sqlite.NewNoOpMetrics())
+	if err != nil {
+		return fmt.Errorf("unable to load database: %w", err)
+	}
+	defer store.Close()
+
+	keys, ok := store.(auth.KeyStore)
+	if !ok {
+		return errors.New("store does not support api keys")
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		key, err := auth.GenerateKey()
+		if err != nil {
+			return fmt.Errorf("unable to generate key: %w", err)
+		}
+		id, err := keys.AddApiKey(args[1], auth.HashKey(key))
+		if err != nil {
+			return fmt.Errorf("unable to add key: %w", err)
+		}
+		fmt.Printf("id: %d\nowner: %s\nkey: %s\n", id, args[1], key)
+		fmt.Println("store the key now, it can not be shown again")
+
+	case "list":
+		list, err := keys.ListApiKeys()
+		if err != nil {
+			return fmt.Errorf("unable to list keys: %w", err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tOWNER\tCREATED")
+		for _, k := range list {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", k.ID, k.Owner, k.CreatedAt.Format(time.RFC3339))
+		}
+		return tw.Flush()
+
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid key id %q", args[1])
+		}
+		if err := keys.DeleteApiKey(id); err != nil {
+			return fmt.Errorf("unable to revoke key: %w", err)
+		}
+		fmt.Printf("revoked key %d\n", id)
+
+	default:
+		return errors.New(usage)
+	}
+	return nil
+}
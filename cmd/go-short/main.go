@@ -2,17 +2,30 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"github.com/sajoniks/GoShort/internal/aliasgen"
+	"github.com/sajoniks/GoShort/internal/api/v1/event"
+	"github.com/sajoniks/GoShort/internal/api/v1/event/urls"
+	"github.com/sajoniks/GoShort/internal/auth"
 	"github.com/sajoniks/GoShort/internal/config"
 	"github.com/sajoniks/GoShort/internal/http-server/handlers/get"
+	"github.com/sajoniks/GoShort/internal/http-server/handlers/remove"
 	"github.com/sajoniks/GoShort/internal/http-server/handlers/save"
+	"github.com/sajoniks/GoShort/internal/http-server/handlers/update"
 	"github.com/sajoniks/GoShort/internal/http-server/metrics"
 	"github.com/sajoniks/GoShort/internal/http-server/middleware"
 	"github.com/sajoniks/GoShort/internal/mq"
+	"github.com/sajoniks/GoShort/internal/ratelimit"
 	"github.com/sajoniks/GoShort/internal/store/cache"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/store/memory"
+	"github.com/sajoniks/GoShort/internal/store/postgres"
 	"github.com/sajoniks/GoShort/internal/store/sqlite"
+	"github.com/sajoniks/GoShort/internal/validate"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
@@ -40,25 +53,187 @@ func configureLogger(env string, cfg *config.AppConfig) (*zap.Logger, error) {
 	return logger, err
 }
 
+const defaultCleanupInterval = time.Minute * 10
+
+// runExpiredCleanup periodically removes expired urls from the store until ctx is cancelled
+func runExpiredCleanup(ctx context.Context, purger urlstore.ExpiredPurger, interval time.Duration, logger *zap.Logger) {
+	if interval <= 0 {
+		interval = defaultCleanupInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := purger.PurgeExpired()
+			if err != nil {
+				logger.Error("failed to purge expired urls", zap.Error(err))
+			} else if n > 0 {
+				logger.Info("purged expired urls", zap.Int64("count", n))
+			}
+		}
+	}
+}
+
+// newRateLimiter creates limiter of the configured backend, limits of all routes must be valid
+func newRateLimiter(cfg *config.RateLimitConfig) (ratelimit.Limiter, error) {
+	for route, limit := range cfg.Routes {
+		if err := (ratelimit.Limit{Rate: limit.Rate, Burst: limit.Burst}).Validate(); err != nil {
+			return nil, fmt.Errorf("rate limit of route %q: %w", route, err)
+		}
+	}
+
+	switch cfg.Backend {
+	case "", "memory":
+		return ratelimit.NewMemoryLimiter(), nil
+	case "redis":
+		opt, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		return ratelimit.NewRedisLimiter(redis.NewClient(opt)), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", cfg.Backend)
+	}
+}
+
+// newStore opens store of the configured driver
+func newStore(cfg *config.DbConfig, metrics sqlite.StoreMetricsService) (urlstore.CloseableStore, error) {
+	switch cfg.Driver {
+	case "", "sqlite":
+		return sqlite.NewSqliteStore(cfg.ConnectionString, metrics)
+	case "postgres":
+		return postgres.NewPostgresStore(cfg.ConnectionString)
+	case "memory":
+		return memory.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+}
+
+// newCachedStore wraps store with the cache of the configured backend
+func newCachedStore(cfg *config.CacheConfig, store urlstore.CloseableStore, logger *zap.Logger) (urlstore.CloseableStore, error) {
+	switch cfg.Backend {
+	case "", "http":
+		// cache service is optional for local runs
+		if cfg.Host == "" {
+			return store, nil
+		}
+		return cache.NewCachedStore(cfg.Host, store, &cfg.Client, logger)
+	case "redis":
+		opt, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		return cache.NewRedisCachedStore(redis.NewClient(opt), store, cfg.TTL, cfg.NegativeTTL, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
+
+// newLocalCachedStore wraps store with the in-process cache. If invalidation Redis is configured,
+// changed aliases are broadcast to other instances and dropped from the local cache when they are changed elsewhere
+func newLocalCachedStore(ctx context.Context, cfg *config.LocalCacheConfig, store urlstore.CloseableStore, logger *zap.Logger) (urlstore.CloseableStore, error) {
+	local := cache.NewLocalCachedStore(store, cfg.Size, cfg.TTL, cache.NewLocalCacheMetrics(prometheus.DefaultRegisterer))
+	if cfg.InvalidationRedisURL == "" {
+		return local, nil
+	}
+
+	opt, err := redis.ParseURL(cfg.InvalidationRedisURL)
+	if err != nil {
+		return store, err
+	}
+	client := redis.NewClient(opt)
+	inv := local.(cache.Invalidator)
+	inv.OnInvalidate(cache.NewInvalidationPublisher(client))
+	go func() {
+		defer client.Close()
+		if err := cache.ListenInvalidations(ctx, client, inv); err != nil {
+			logger.Error("invalidation listener stopped", zap.Error(err))
+		}
+	}()
+	return local, nil
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	env := config.GetEnvironment()
 	cfg := config.MustLoad()
 	logger, _ := configureLogger(env, cfg)
 
-	store, err := sqlite.NewSqliteStore(cfg.Database.ConnectionString, sqlite.NewStoreMetrics(prometheus.DefaultRegisterer))
+	store, err := newStore(&cfg.Database, sqlite.NewStoreMetrics(prometheus.DefaultRegisterer))
 	if err != nil {
 		logger.Panic("unable to load database", zap.Error(err))
 	}
 
-	storeCache, err := cache.NewCachedStore(cfg.Cache.Host, store)
+	// background tasks are stopped on shutdown
+	backgroundCtx, backgroundCancel := context.WithCancel(context.Background())
+	defer backgroundCancel()
+
+	storeCache, err := newCachedStore(&cfg.Cache, store, logger.With(zap.Namespace("cache")))
 	if err != nil {
 		store.Close()
 		logger.Panic("unable to load cache", zap.Error(err))
 	}
+	if cfg.Cache.Local.Size > 0 {
+		storeCache, err = newLocalCachedStore(backgroundCtx, &cfg.Cache.Local, storeCache, logger.With(zap.Namespace("local_cache")))
+		if err != nil {
+			storeCache.Close()
+			logger.Panic("unable to load local cache", zap.Error(err))
+		}
+	}
 
 	defer storeCache.Close()
 
-	kafka := mq.NewKafkaWriterWorker(&cfg.Messaging.Kafka.Writers[0], logger)
+	if purger, ok := store.(urlstore.ExpiredPurger); ok {
+		go runExpiredCleanup(backgroundCtx, purger, cfg.Database.CleanupInterval, logger.With(zap.Namespace("cleanup")))
+	}
+
+	registry := event.NewRegistry("go-short")
+	urls.Register(registry)
+
+	var kafka mq.KafkaWriterWorkerInterface = mq.NewWriterNoOp()
+	var relay *mq.OutboxRelay
+	var kafkaWorker *mq.KafkaWriterWorker
+	if len(cfg.Messaging.Kafka.Writers) > 0 {
+		writerCfg := &cfg.Messaging.Kafka.Writers[0]
+		encoder, err := mq.NewEncoder(writerCfg.Encoding, registry)
+		if err != nil {
+			storeCache.Close()
+			logger.Panic("unable to create message encoder", zap.Error(err))
+		}
+		if cfg.Messaging.Outbox.Enabled {
+			outbox, ok := store.(urlstore.Outbox)
+			if !ok {
+				storeCache.Close()
+				logger.Panic("store does not support outbox")
+			}
+			key, err := mq.NewKeyFunc(writerCfg.Key)
+			if err != nil {
+				storeCache.Close()
+				logger.Panic("unable to create outbox writer", zap.Error(err))
+			}
+			kafka = mq.NewOutboxWriter(outbox, encoder, key, logger.With(zap.Namespace("outbox")))
+			if relay, err = mq.NewOutboxRelay(outbox, writerCfg, &cfg.Messaging.Outbox, logger); err != nil {
+				storeCache.Close()
+				logger.Panic("unable to create outbox relay", zap.Error(err))
+			}
+			mq.NewWriterMetrics(prometheus.DefaultRegisterer, relay)
+		} else {
+			if kafkaWorker, err = mq.NewKafkaWriterWorker(writerCfg, encoder, logger); err != nil {
+				storeCache.Close()
+				logger.Panic("unable to create kafka writer", zap.Error(err))
+			}
+			kafka = kafkaWorker
+			mq.NewWriterMetrics(prometheus.DefaultRegisterer, kafkaWorker)
+		}
+	}
 	httpMetrics := metrics.NewHttpMetrics(prometheus.DefaultRegisterer)
 
 	servMux := mux.NewRouter()
@@ -69,8 +244,64 @@ func main() {
 		middleware.NewRecoverer(),
 	)
 
-	servMux.Methods("POST").Path("/").Handler(save.NewSaveUrlHandler(cfg.Server.Host, storeCache, kafka))
-	servMux.Methods("GET").Path("/{alias}").Handler(get.NewGetUrlHandler(storeCache, kafka))
+	keys, ok := store.(auth.KeyStore)
+	if !ok {
+		storeCache.Close()
+		logger.Panic("store does not support api keys")
+	}
+	authMiddleware := middleware.NewApiKeyAuth(keys, cfg.Auth.Required)
+
+	limiter, err := newRateLimiter(&cfg.RateLimit)
+	if err != nil {
+		storeCache.Close()
+		logger.Panic("unable to create rate limiter", zap.Error(err))
+	}
+	rateLimitMetrics := metrics.NewRateLimitMetrics(prometheus.DefaultRegisterer)
+	rateLimited := func(route string, h http.Handler) http.Handler {
+		routeLimit, ok := cfg.RateLimit.Routes[route]
+		if !ok {
+			return h
+		}
+		limit := ratelimit.Limit{Rate: routeLimit.Rate, Burst: routeLimit.Burst}
+		return middleware.NewRateLimit(route, limiter, limit, rateLimitMetrics)(h)
+	}
+
+	validationRules := []validate.Rule{
+		validate.SelfReference(append(cfg.Validation.SelfHosts, cfg.Server.Host)...),
+		validate.PrivateAddress(),
+	}
+	if cfg.Validation.BlocklistPath != "" {
+		blocklist, err := validate.NewFileBlocklist(
+			cfg.Validation.BlocklistPath,
+			cfg.Validation.BlocklistReloadInterval,
+			logger.With(zap.Namespace("validation")),
+		)
+		if err != nil {
+			storeCache.Close()
+			logger.Panic("unable to load blocklist", zap.Error(err))
+		}
+		defer blocklist.Close()
+		validationRules = append(validationRules, blocklist)
+	}
+	validator := validate.New(validationRules...)
+
+	aliasPolicy := save.NewAliasPolicy(&cfg.Aliases)
+	expiryPolicy := save.NewExpiryPolicy(&cfg.Expiry)
+	aliasSequence, ok := store.(aliasgen.Sequence)
+	if !ok {
+		aliasSequence = aliasgen.NewMemorySequence(uint64(time.Now().Unix()))
+	}
+	aliasGenerator, err := aliasgen.New(&cfg.Aliases.Generator, aliasSequence)
+	if err != nil {
+		storeCache.Close()
+		logger.Panic("unable to create alias generator", zap.Error(err))
+	}
+
+	servMux.Methods("POST").Path("/").Handler(authMiddleware(rateLimited("save", save.NewSaveUrlHandler(cfg.Server.Host, storeCache, kafka, aliasPolicy, expiryPolicy, aliasGenerator, validator, cfg.Aliases.Dedupe))))
+	servMux.Methods("POST").Path("/batch").Handler(authMiddleware(rateLimited("batch", save.NewBatchSaveUrlHandler(cfg.Server.Host, storeCache, kafka, aliasPolicy, expiryPolicy, aliasGenerator, validator, cfg.Aliases.Dedupe, cfg.Batch.MaxItems))))
+	servMux.Methods("GET").Path("/{alias}").Handler(rateLimited("get", get.NewGetUrlHandler(storeCache, kafka)))
+	servMux.Methods("PATCH").Path("/{alias}").Handler(authMiddleware(rateLimited("update", update.NewUpdateUrlHandler(storeCache, kafka, validator))))
+	servMux.Methods("DELETE").Path("/{alias}").Handler(authMiddleware(rateLimited("delete", remove.NewDeleteUrlHandler(storeCache, kafka))))
 
 	serv := &http.Server{
 		Addr:    cfg.Server.Host,
@@ -103,10 +334,12 @@ func main() {
 		log.Printf("%s: shut down", servName)
 	}()
 
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	<-c
 
+	backgroundCancel()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -118,6 +351,14 @@ func main() {
 	}()
 	<-ctx.Done()
 
+	// pending messages stay in the outbox and are published after restart
+	if relay != nil {
+		relay.Shutdown()
+	}
+	if kafkaWorker != nil {
+		kafkaWorker.Shutdown()
+	}
+
 	logger.Info("Shut down")
 	os.Exit(0)
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/sajoniks/GoShort/internal/store/sqlite"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	cfg := config.MustLoad()
+	if cfg.Database.Driver != "" && cfg.Database.Driver != "sqlite" {
+		return fmt.Errorf("migrate command is not supported by %q driver, its migrations are applied on start", cfg.Database.Driver)
+	}
+
+	// database is opened without the store, which applies pending migrations on open
+	db, err := sql.Open("sqlite3", cfg.Database.ConnectionString)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	migrator, err := sqlite.NewMigrator(db)
+	if err != nil {
+		return fmt.Errorf("unable to load migrations: %w", err)
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := migrator.Up()
+		if err != nil {
+			return fmt.Errorf("unable to apply migrations: %w", err)
+		}
+		fmt.Printf("applied %d migrations\n", n)
+
+	case "down":
+		steps := 1
+		if len(args) == 2 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		} else if len(args) > 2 {
+			return errors.New(usage)
+		}
+		n, err := migrator.Down(steps)
+		if err != nil {
+			return fmt.Errorf("unable to revert migrations: %w", err)
+		}
+		fmt.Printf("reverted %d migrations\n", n)
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return fmt.Errorf("unable to get migrations status: %w", err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, st := range statuses {
+			applied := "pending"
+			if st.Applied {
+				applied = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", st.Version, st.Name, applied)
+		}
+		return tw.Flush()
+
+	default:
+		return errors.New(usage)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/sajoniks/GoShort/internal/mq"
+	"os"
+	"os/signal"
+	"time"
+)
+
+const usage = `usage:
+  short-analytics                       run the service
+  short-analytics replay-dlq [idle]     send dead-lettered events back to their topic,
+                                        stops when there is no new event for idle, 5s by default`
+
+// defaultReplayIdle is the time replay waits for new dead-lettered events before it stops
+const defaultReplayIdle = time.Second * 5
+
+// runCommand runs admin subcommand and returns exit code
+func runCommand(args []string) int {
+	switch args[0] {
+	case "replay-dlq":
+		if err := runReplayCommand(args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+}
+
+func runReplayCommand(args []string) error {
+	idle := defaultReplayIdle
+	switch len(args) {
+	case 0:
+	case 1:
+		d, err := time.ParseDuration(args[0])
+		if err != nil || d <= 0 {
+			return errors.New(usage)
+		}
+		idle = d
+	default:
+		return errors.New(usage)
+	}
+
+	cfg := config.MustLoad()
+	logger, err := configureLogger(config.GetEnvironment(), cfg)
+	if err != nil {
+		return fmt.Errorf("unable to create logger: %w", err)
+	}
+	if len(cfg.Messaging.Kafka.Readers) == 0 {
+		return errors.New("kafka reader is not configured")
+	}
+
+	replayer, err := mq.NewDeadLetterReplayer(&cfg.Messaging.Kafka.Readers[0], logger)
+	if err != nil {
+		return err
+	}
+	defer replayer.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	replayed, err := replayer.Replay(ctx, idle)
+	fmt.Printf("replayed: %d\n", replayed)
+	if err != nil {
+		return fmt.Errorf("unable to replay events: %w", err)
+	}
+	return nil
+}
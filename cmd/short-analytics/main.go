@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sajoniks/GoShort/internal/analytics"
+	analyticssqlite "github.com/sajoniks/GoShort/internal/analytics/sqlite"
+	"github.com/sajoniks/GoShort/internal/api/v1/event"
 	"github.com/sajoniks/GoShort/internal/api/v1/event/urls"
 	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/sajoniks/GoShort/internal/http-server/handlers/stats"
+	"github.com/sajoniks/GoShort/internal/http-server/middleware"
 	"github.com/sajoniks/GoShort/internal/mq"
 	"github.com/sajoniks/GoShort/internal/trace"
+	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
 	"net/http"
 	"os"
@@ -53,50 +61,126 @@ func configureLogger(env string, cfg *config.AppConfig) (*zap.Logger, error) {
 	return logger, err
 }
 
-func handleUrlEvent(eventValue []byte, logger *zap.Logger) error {
-	eventType := struct {
-		Type string `json:"type"`
-	}{}
-	err := json.Unmarshal(eventValue, &eventType)
+// errMalformedEvent is returned for events that are decoded, but can not be handled
+var errMalformedEvent = errors.New("malformed event")
+
+// defaultDatabase is the analytics database used if connection string is not configured
+const defaultDatabase = "analytics.sqlite"
+
+// isPermanent reports whether handling of the event would fail again.
+// Events of unknown types and versions are sent by newer producers, they can be replayed after upgrade
+func isPermanent(err error) bool {
+	return errors.Is(err, errMalformedEvent) ||
+		errors.Is(err, event.ErrMalformed) ||
+		errors.Is(err, event.ErrUnknownType) ||
+		errors.Is(err, event.ErrUnknownVersion)
+}
+
+func handleUrlEvent(
+	m kafka.Message,
+	registry *event.Registry,
+	store analytics.Store,
+	countries analytics.CountryLookup,
+	logger *zap.Logger,
+) error {
+	env, e, err := mq.DecodeEvent(registry, m)
 	if err != nil {
 		return trace.WrapError(err)
 	}
+	logger = logger.With(
+		zap.String("event_type", env.Type),
+		zap.Int("event_version", env.Version),
+		zap.String("event_id", env.Id),
+	)
 
-	switch eventType.Type {
-	case urls.EventTagUrlAdded:
-		var ev urls.AddedEvent
-		if err := json.Unmarshal(eventValue, &ev); err != nil {
-			return trace.WrapError(err)
-		}
-
+	switch ev := e.(type) {
+	case urls.AddedEvent:
 		metricHistUrlLength.Observe(float64(len(ev.Source)))
 
-		logger.Info("parsed event", zap.String("event_type", ev.Type))
+	case urls.AccessedEvent:
+		metricCounterUrlGet.Add(1.0)
 
-	case urls.EventTagUrlAccessed:
-		var ev urls.AccessedEvent
-		if err := json.Unmarshal(eventValue, &ev); err != nil {
+		// events without envelope have no time and id, the message is the closest one
+		clickedAt, source := env.OccurredAt, env.Id
+		if clickedAt.IsZero() {
+			clickedAt = m.Time
+		}
+		if source == "" {
+			source = fmt.Sprintf("%s/%d/%d", m.Topic, m.Partition, m.Offset)
+		}
+		click := analytics.Click{
+			Alias:          ev.Alias,
+			URL:            ev.URL,
+			Time:           clickedAt,
+			Source:         source,
+			Referrer:       ev.Referrer,
+			UserAgent:      ev.UserAgent,
+			IP:             ev.IP,
+			RequestId:      ev.RequestId,
+			AcceptLanguage: ev.AcceptLanguage,
+		}
+		analytics.Enrich(&click, countries)
+		err := store.AddClick(click)
+		if errors.Is(err, analytics.ErrAliasEmpty) {
+			return trace.WrapError(errors.Join(errMalformedEvent, err))
+		}
+		if err != nil {
 			return trace.WrapError(err)
 		}
 
-		metricCounterUrlGet.Add(1.0)
-
-		logger.Info("parsed event", zap.String("event_type", ev.Type))
+	case urls.UpdatedEvent, urls.DeletedEvent:
+		// changes of urls do not affect collected stats
+		logger.Debug("skip event")
+		return nil
 	}
 
+	logger.Info("handled event")
 	return nil
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	cfg := config.MustLoad()
 	logger, _ := configureLogger(config.GetEnvironment(), cfg)
 
-	http.Handle("/metrics", promhttp.Handler())
+	dbPath := cfg.Database.ConnectionString
+	if dbPath == "" {
+		dbPath = defaultDatabase
+	}
+	store, err := analyticssqlite.NewClickStore(dbPath)
+	if err != nil {
+		logger.Panic("unable to load analytics database", zap.Error(err))
+	}
+
+	registry := event.NewRegistry("short-analytics")
+	urls.Register(registry)
+
+	countries := analytics.NewNoOpCountryLookup()
+	if cfg.Analytics.GeoIPPath != "" {
+		countries, err = analytics.OpenGeoIPDatabase(cfg.Analytics.GeoIPPath)
+		if err != nil {
+			store.Close()
+			logger.Panic("unable to load geoip database", zap.Error(err))
+		}
+	}
+
+	router := mux.NewRouter()
+	router.Handle("/metrics", promhttp.Handler())
+	statsRouter := router.PathPrefix("/stats").Subrouter()
+	statsRouter.Use(
+		middleware.NewRequestId(),
+		middleware.NewLogging(logger),
+		middleware.NewRecoverer(),
+	)
+	statsRouter.Handle("/top", stats.NewTopHandler(store)).Methods(http.MethodGet)
+	statsRouter.Handle("/{alias}", stats.NewSeriesHandler(store)).Methods(http.MethodGet)
 
-	reader := mq.NewKafkaReaderWorker(&cfg.Messaging.Kafka.Readers[0], logger)
+	reader := mq.NewKafkaAckReaderWorker(&cfg.Messaging.Kafka.Readers[0], logger)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -107,27 +191,33 @@ func main() {
 			case <-ctx.Done():
 				logger.Info("shutting down message processing")
 				return
-			case bs := <-reader.C:
-				err := handleUrlEvent(bs, logger.With(zap.Namespace("handle url")))
-				if err != nil {
-					logger.Error("failed to parse event", zap.Error(trace.WrapError(err)))
-				} else {
-					logger.Info("parsed event")
+			case d := <-reader.C:
+				err := handleUrlEvent(d.Message, registry, store, countries, logger.With(zap.Namespace("handle url")))
+				switch {
+				case err == nil:
+					d.Ack()
+				case isPermanent(err):
+					// event would fail again, so it is not retried
+					logger.Error("failed to decode event", zap.Error(err))
+					d.Reject(err)
+				default:
+					logger.Error("failed to handle event", zap.Int("attempt", d.Attempt), zap.Error(err))
+					d.Nack(err)
 				}
 			}
 		}
 	}()
 	serv := http.Server{
 		Addr:    cfg.Server.Host,
-		Handler: nil,
+		Handler: router,
 	}
 	go func() {
-		if err := serv.ListenAndServe(); err != nil {
-			logger.Fatal("failed to start prometheus http server", zap.Error(err))
+		if err := serv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("failed to start http server", zap.Error(err))
 		}
 	}()
 
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, os.Interrupt)
 	<-ch
 
@@ -135,8 +225,11 @@ func main() {
 	wg.Wait()
 	reader.Shutdown()
 
-	qctx, _ := context.WithTimeout(ctx, time.Second*10)
+	qctx, qcancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer qcancel()
 	serv.Shutdown(qctx)
+	store.Close()
+	_ = countries.Close()
 
 	logger.Info("Shut down")
 
@@ -0,0 +1,67 @@
+package aliasgen
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Sequence provides increasing numbers for the counter strategy
+type Sequence interface {
+	NextSequence() (uint64, error)
+}
+
+type memorySequence struct {
+	value atomic.Uint64
+}
+
+// NewMemorySequence creates process local sequence that starts after start.
+// It is lost on restart, so persistent sequence of the store should be preferred
+func NewMemorySequence(start uint64) Sequence {
+	s := &memorySequence{}
+	s.value.Store(start)
+	return s
+}
+
+func (s *memorySequence) NextSequence() (uint64, error) {
+	return s.value.Add(1), nil
+}
+
+// encodeBase62 encodes n with base62Alphabet, left padded with zeros up to minLength
+func encodeBase62(n uint64, minLength int) string {
+	var buf [11]byte // max uint64 is 11 base62 digits
+	i := len(buf)
+	for {
+		i--
+		buf[i] = base62Alphabet[n%62]
+		n /= 62
+		if n == 0 {
+			break
+		}
+	}
+	s := string(buf[i:])
+	if len(s) < minLength {
+		s = strings.Repeat(string(base62Alphabet[0]), minLength-len(s)) + s
+	}
+	return s
+}
+
+type counterGenerator struct {
+	seq       Sequence
+	minLength int
+}
+
+// NewCounterGenerator creates generator of base62 encoded sequence numbers.
+// Aliases shorter than minLength are left padded with zeros, which keeps them unique
+func NewCounterGenerator(seq Sequence, minLength int) Generator {
+	return &counterGenerator{seq: seq, minLength: minLength}
+}
+
+func (g *counterGenerator) Generate(string) (string, error) {
+	n, err := g.seq.NextSequence()
+	if err != nil {
+		return "", err
+	}
+	return encodeBase62(n, g.minLength), nil
+}
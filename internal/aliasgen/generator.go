@@ -0,0 +1,66 @@
+package aliasgen
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"github.com/sajoniks/GoShort/internal/config"
+	"time"
+)
+
+// Generator creates aliases for the shortened urls.
+// Generators are safe for concurrent use. Generated alias is not guaranteed to be unique,
+// so callers retry with a new alias when it is already taken
+type Generator interface {
+	Generate(src string) (string, error)
+}
+
+// Strategy names used in config
+const (
+	StrategyHash    = "hash"
+	StrategyCounter = "counter"
+	StrategyRandom  = "random"
+	StrategyWords   = "words"
+)
+
+// New creates generator of the configured strategy. Hash strategy is used by default.
+// seq is used only by counter strategy
+func New(cfg *config.AliasGeneratorConfig, seq Sequence) (Generator, error) {
+	switch cfg.Strategy {
+	case "", StrategyHash:
+		return NewHashGenerator(), nil
+	case StrategyCounter:
+		return NewCounterGenerator(seq, cfg.Length), nil
+	case StrategyRandom:
+		return NewRandomGenerator(cfg.Alphabet, cfg.Length)
+	case StrategyWords:
+		return NewWordPairGenerator(cfg.Separator)
+	default:
+		return nil, fmt.Errorf("unknown alias generator strategy %q", cfg.Strategy)
+	}
+}
+
+var hashEncoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_").WithPadding(base64.NoPadding)
+
+type hashGenerator struct{}
+
+// NewHashGenerator creates generator of 11 characters aliases.
+// Alias is base64 encoded slice of sha-512 hash of the url, current time and random bytes
+func NewHashGenerator() Generator {
+	return hashGenerator{}
+}
+
+func (hashGenerator) Generate(src string) (string, error) {
+	rnd := make([]byte, 8)
+	if _, err := rand.Read(rnd); err != nil {
+		return "", err
+	}
+
+	// url|timestamp|random bytes [8]
+	// https://example.com|1234567890|jq2ef-=k
+	h := sha512.New()
+	fmt.Fprintf(h, "%s|%d|%s", src, time.Now().UTC().UnixNano(), rnd)
+
+	return hashEncoding.EncodeToString(h.Sum(nil)[:8]), nil
+}
@@ -0,0 +1,103 @@
+package aliasgen
+
+import (
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestHashGenerator(t *testing.T) {
+	g := NewHashGenerator()
+	a, err := g.Generate("https://www.example.com")
+	require.NoError(t, err)
+	b, err := g.Generate("https://www.example.com")
+	require.NoError(t, err)
+
+	require.Len(t, a, 11)
+	require.NotEqual(t, a, b)
+}
+
+func TestEncodeBase62(t *testing.T) {
+	tt := []struct {
+		n         uint64
+		minLength int
+		want      string
+	}{
+		{n: 0, want: "0"},
+		{n: 61, want: "z"},
+		{n: 62, want: "10"},
+		{n: 3843, want: "zz"},
+		{n: 1, minLength: 4, want: "0001"},
+		{n: 18446744073709551615, want: "LygHa16AHYF"},
+	}
+	for _, tc := range tt {
+		require.Equal(t, tc.want, encodeBase62(tc.n, tc.minLength))
+	}
+}
+
+func TestCounterGenerator(t *testing.T) {
+	g := NewCounterGenerator(NewMemorySequence(61), 3)
+
+	a, err := g.Generate("")
+	require.NoError(t, err)
+	b, err := g.Generate("")
+	require.NoError(t, err)
+
+	require.Equal(t, "010", a)
+	require.Equal(t, "011", b)
+}
+
+func TestRandomGenerator(t *testing.T) {
+	g, err := NewRandomGenerator("ab", 16)
+	require.NoError(t, err)
+
+	alias, err := g.Generate("")
+	require.NoError(t, err)
+	require.Len(t, alias, 16)
+	require.Empty(t, strings.Trim(alias, "ab"))
+
+	g, err = NewRandomGenerator("", 0)
+	require.NoError(t, err)
+	alias, err = g.Generate("")
+	require.NoError(t, err)
+	require.Len(t, alias, defaultRandomLength)
+	require.Empty(t, strings.Trim(alias, UnambiguousAlphabet))
+}
+
+func TestRandomGenerator_InvalidAlphabet(t *testing.T) {
+	_, err := NewRandomGenerator("a", 8)
+	require.ErrorIs(t, err, ErrAlphabetTooShort)
+
+	_, err = NewRandomGenerator("ab/", 8)
+	require.ErrorIs(t, err, ErrAlphabetCharset)
+
+	_, err = NewRandomGenerator("aba", 8)
+	require.ErrorIs(t, err, ErrAlphabetRepeated)
+}
+
+func TestWordPairGenerator(t *testing.T) {
+	g, err := NewWordPairGenerator("_")
+	require.NoError(t, err)
+
+	alias, err := g.Generate("")
+	require.NoError(t, err)
+	words := strings.Split(alias, "_")
+	require.Len(t, words, 2)
+	require.Contains(t, adjectives, words[0])
+	require.Contains(t, nouns, words[1])
+
+	_, err = NewWordPairGenerator(".")
+	require.ErrorIs(t, err, ErrSeparatorCharset)
+}
+
+func TestNew(t *testing.T) {
+	for _, strategy := range []string{"", StrategyHash, StrategyCounter, StrategyRandom, StrategyWords} {
+		g, err := New(&config.AliasGeneratorConfig{Strategy: strategy}, NewMemorySequence(0))
+		require.NoError(t, err, strategy)
+		require.NotNil(t, g)
+	}
+
+	_, err := New(&config.AliasGeneratorConfig{Strategy: "uuid"}, nil)
+	require.Error(t, err)
+}
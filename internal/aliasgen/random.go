@@ -0,0 +1,70 @@
+package aliasgen
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+const (
+	defaultRandomLength = 8
+	// UnambiguousAlphabet is base62 without characters that are easily confused: 0/O/o, 1/l/I
+	UnambiguousAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz"
+)
+
+var (
+	ErrAlphabetTooShort = errors.New("alias alphabet must contain at least 2 characters")
+	ErrAlphabetCharset  = errors.New("alias alphabet may contain only latin letters, digits, '-' and '_'")
+	ErrAlphabetRepeated = errors.New("alias alphabet contains repeated characters")
+)
+
+type randomGenerator struct {
+	alphabet string
+	length   int
+}
+
+// NewRandomGenerator creates generator of random aliases of given length made of alphabet characters.
+// UnambiguousAlphabet and length 8 are used by default
+func NewRandomGenerator(alphabet string, length int) (Generator, error) {
+	if alphabet == "" {
+		alphabet = UnambiguousAlphabet
+	}
+	if length <= 0 {
+		length = defaultRandomLength
+	}
+	if len(alphabet) < 2 {
+		return nil, ErrAlphabetTooShort
+	}
+	seen := make(map[rune]struct{}, len(alphabet))
+	for _, c := range alphabet {
+		if !isAliasChar(c) {
+			return nil, ErrAlphabetCharset
+		}
+		if _, ok := seen[c]; ok {
+			return nil, ErrAlphabetRepeated
+		}
+		seen[c] = struct{}{}
+	}
+	return &randomGenerator{alphabet: alphabet, length: length}, nil
+}
+
+func isAliasChar(c rune) bool {
+	return (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9') ||
+		c == '-' || c == '_'
+}
+
+func (g *randomGenerator) Generate(string) (string, error) {
+	buf := make([]byte, g.length)
+	max := big.NewInt(int64(len(g.alphabet)))
+	for i := range buf {
+		// rand.Int is uniform, unlike taking random byte modulo alphabet length
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		buf[i] = g.alphabet[n.Int64()]
+	}
+	return string(buf), nil
+}
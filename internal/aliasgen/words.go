@@ -0,0 +1,89 @@
+package aliasgen
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+const defaultWordSeparator = "-"
+
+var ErrSeparatorCharset = errors.New("word separator may contain only '-' and '_'")
+
+// adjectives and nouns are short, unambiguous english words.
+// Lists give len(adjectives) * len(nouns) combinations, so word pairs suit low volume installations
+var adjectives = []string{
+	"able", "agile", "amber", "ample", "azure", "basic", "blue", "bold",
+	"brave", "breezy", "bright", "brisk", "calm", "candid", "cheery", "civic",
+	"clean", "clear", "clever", "cool", "cosmic", "cozy", "crisp", "curly",
+	"daring", "dapper", "deep", "eager", "early", "easy", "epic", "exact",
+	"fair", "famous", "fancy", "fast", "fine", "firm", "fluffy", "fond",
+	"free", "fresh", "frosty", "fun", "gentle", "giant", "glad", "golden",
+	"good", "grand", "great", "green", "happy", "hardy", "hearty", "honest",
+	"humble", "icy", "ideal", "jolly", "just", "keen", "kind", "large",
+	"lively", "lucky", "lunar", "mellow", "merry", "mighty", "mild", "modest",
+	"neat", "nimble", "noble", "novel", "orange", "patient", "plain", "plucky",
+	"polite", "proud", "pure", "purple", "quick", "quiet", "rapid", "rare",
+	"ready", "red", "regal", "rich", "robust", "rosy", "royal", "rustic",
+	"safe", "sandy", "sharp", "shiny", "silent", "silver", "simple", "sleek",
+	"smart", "smooth", "snowy", "solar", "solid", "sonic", "spicy", "steady",
+	"sturdy", "sunny", "super", "sweet", "swift", "tidy", "tiny", "urban",
+	"vast", "vivid", "warm", "wise", "witty", "young", "zany", "zesty",
+}
+
+var nouns = []string{
+	"acorn", "anchor", "apple", "arrow", "badger", "bagel", "banjo", "beacon",
+	"bear", "beaver", "bison", "blossom", "breeze", "brook", "cactus", "camel",
+	"canoe", "canyon", "castle", "cedar", "cherry", "cloud", "clover", "comet",
+	"coral", "cricket", "crystal", "daisy", "delta", "desert", "dolphin", "dragon",
+	"eagle", "ember", "falcon", "fern", "finch", "forest", "fox", "galaxy",
+	"garden", "gecko", "glacier", "harbor", "hawk", "hazel", "heron", "hill",
+	"island", "jaguar", "jasmine", "kettle", "kiwi", "koala", "lagoon", "lantern",
+	"lemon", "lily", "lion", "llama", "lotus", "maple", "meadow", "meteor",
+	"mango", "moose", "moss", "mountain", "nebula", "oak", "ocean", "orbit",
+	"orchid", "otter", "owl", "panda", "parrot", "peach", "pebble", "pepper",
+	"pine", "planet", "plum", "pony", "prairie", "puffin", "quartz", "rabbit",
+	"raven", "reef", "river", "robin", "rocket", "sail", "salmon", "sparrow",
+	"spruce", "squirrel", "star", "stone", "summit", "sunset", "swan", "thistle",
+	"thunder", "tiger", "tulip", "turtle", "valley", "violet", "walnut", "whale",
+	"willow", "wolf", "wombat", "yak", "zebra", "zephyr", "bamboo", "birch",
+	"canary", "cobalt", "dune", "fjord", "grove", "iris", "juniper", "lynx",
+}
+
+type wordPairGenerator struct {
+	separator string
+}
+
+// NewWordPairGenerator creates generator of human-readable aliases like "brave-otter".
+// Words are joined with separator, "-" by default
+func NewWordPairGenerator(separator string) (Generator, error) {
+	if separator == "" {
+		separator = defaultWordSeparator
+	}
+	for _, c := range separator {
+		if c != '-' && c != '_' {
+			return nil, ErrSeparatorCharset
+		}
+	}
+	return &wordPairGenerator{separator: separator}, nil
+}
+
+func randomWord(words []string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+	if err != nil {
+		return "", err
+	}
+	return words[n.Int64()], nil
+}
+
+func (g *wordPairGenerator) Generate(string) (string, error) {
+	adjective, err := randomWord(adjectives)
+	if err != nil {
+		return "", err
+	}
+	noun, err := randomWord(nouns)
+	if err != nil {
+		return "", err
+	}
+	return adjective + g.separator + noun, nil
+}
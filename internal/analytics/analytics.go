@@ -0,0 +1,137 @@
+package analytics
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAliasEmpty         = errors.New("alias is empty")
+	ErrInvalidGranularity = errors.New("granularity must be \"hour\" or \"day\"")
+)
+
+// Granularity is the size of the time bucket clicks are counted by
+type Granularity string
+
+const (
+	Hour Granularity = "hour"
+	Day  Granularity = "day"
+)
+
+// ParseGranularity parses granularity name, Hour is returned for the empty name
+func ParseGranularity(name string) (Granularity, error) {
+	switch Granularity(name) {
+	case "", Hour:
+		return Hour, nil
+	case Day:
+		return Day, nil
+	default:
+		return "", ErrInvalidGranularity
+	}
+}
+
+// Duration returns the size of the bucket
+func (g Granularity) Duration() time.Duration {
+	if g == Day {
+		return time.Hour * 24
+	}
+	return time.Hour
+}
+
+// Truncate returns start of the UTC bucket t belongs to
+func (g Granularity) Truncate(t time.Time) time.Time {
+	return t.UTC().Truncate(g.Duration())
+}
+
+// Click is a single access to the alias
+type Click struct {
+	Alias string
+	URL   string
+	Time  time.Time
+	// Source identifies the message the click was read from. Clicks of the same source are counted once,
+	// so redelivered messages do not change the stats
+	Source string
+
+	// request of the click
+	Referrer       string
+	UserAgent      string
+	IP             string
+	RequestId      string
+	AcceptLanguage string
+
+	// dimensions derived from the request by Enrich
+	ReferrerHost string
+	Browser      string
+	OS           string
+	Bot          bool
+	Country      string
+	Language     string
+}
+
+// Enrich derives dimensions of the click from its request, countries resolve the ip of the click
+func Enrich(c *Click, countries CountryLookup) {
+	if u, err := url.Parse(c.Referrer); err == nil {
+		c.ReferrerHost = strings.ToLower(u.Hostname())
+	}
+	ua := ParseUserAgent(c.UserAgent)
+	c.Browser, c.OS, c.Bot = ua.Browser, ua.OS, ua.Bot
+	c.Country = countries.Country(net.ParseIP(c.IP))
+	c.Language = PrimaryLanguage(c.AcceptLanguage)
+}
+
+// Filter selects clicks by their dimensions, empty fields match any click.
+// Strings are compared case-insensitively
+type Filter struct {
+	Country      string
+	Browser      string
+	OS           string
+	ReferrerHost string
+	Language     string
+	// Bot selects clicks of bots if it is true, and clicks of people if it is false
+	Bot *bool
+}
+
+// IsEmpty reports whether filter matches any click
+func (f Filter) IsEmpty() bool {
+	return f == Filter{}
+}
+
+// Point is the number of clicks in the bucket starting at Time
+type Point struct {
+	Time   time.Time `json:"time"`
+	Clicks int64     `json:"clicks"`
+}
+
+// AliasClicks is the number of clicks of the alias
+type AliasClicks struct {
+	Alias  string `json:"alias"`
+	Clicks int64  `json:"clicks"`
+}
+
+type Store interface {
+	// AddClick records the click. Click of already recorded source is ignored
+	AddClick(c Click) error
+	// Series returns non-empty buckets of the alias with clicks matching f ordered by time.
+	// Buckets start in [from, to), from is truncated to the granularity
+	Series(alias string, from, to time.Time, g Granularity, f Filter) ([]Point, error)
+	// Top returns at most limit aliases with the most clicks matching f in hourly buckets that start in [from, to),
+	// from is truncated to the hour
+	Top(from, to time.Time, limit int, f Filter) ([]AliasClicks, error)
+	Close()
+}
+
+// FillSeries returns points of every bucket in [from, to), buckets missing in points have no clicks
+func FillSeries(points []Point, from, to time.Time, g Granularity) []Point {
+	clicks := make(map[int64]int64, len(points))
+	for _, p := range points {
+		clicks[p.Time.Unix()] = p.Clicks
+	}
+	var result []Point
+	for t := g.Truncate(from); t.Before(to); t = t.Add(g.Duration()) {
+		result = append(result, Point{Time: t, Clicks: clicks[t.Unix()]})
+	}
+	return result
+}
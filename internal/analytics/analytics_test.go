@@ -0,0 +1,62 @@
+package analytics
+
+import (
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseGranularity(t *testing.T) {
+	for name, want := range map[string]Granularity{"": Hour, "hour": Hour, "day": Day} {
+		g, err := ParseGranularity(name)
+		require.NoError(t, err)
+		require.Equal(t, want, g)
+	}
+	_, err := ParseGranularity("week")
+	require.ErrorIs(t, err, ErrInvalidGranularity)
+}
+
+func TestFillSeries(t *testing.T) {
+	from := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	points := FillSeries([]Point{{Time: start.Add(time.Hour), Clicks: 5}}, from, from.Add(time.Hour*2), Hour)
+	require.Equal(t, []Point{
+		{Time: start, Clicks: 0},
+		{Time: start.Add(time.Hour), Clicks: 5},
+		{Time: start.Add(time.Hour * 2), Clicks: 0},
+	}, points)
+}
+
+// countries resolves every ip to the same country
+type countries string
+
+func (c countries) Country(net.IP) string {
+	return string(c)
+}
+
+func (c countries) Close() error {
+	return nil
+}
+
+func TestEnrich(t *testing.T) {
+	c := Click{
+		Referrer:       "https://News.Example.org/post/1?utm_source=x",
+		UserAgent:      "Mozilla/5.0 (X11; Linux x86_64; rv:126.0) Gecko/20100101 Firefox/126.0",
+		IP:             "203.0.113.0",
+		AcceptLanguage: "de-DE,de;q=0.9",
+	}
+	Enrich(&c, countries("DE"))
+	require.Equal(t, "news.example.org", c.ReferrerHost)
+	require.Equal(t, "Firefox", c.Browser)
+	require.Equal(t, "Linux", c.OS)
+	require.False(t, c.Bot)
+	require.Equal(t, "DE", c.Country)
+	require.Equal(t, "de", c.Language)
+
+	// click without request details has no dimensions
+	c = Click{}
+	Enrich(&c, NewNoOpCountryLookup())
+	require.Equal(t, Click{}, c)
+}
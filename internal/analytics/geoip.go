@@ -0,0 +1,62 @@
+package analytics
+
+import (
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"net"
+)
+
+// CountryLookup resolves the country of the ip
+type CountryLookup interface {
+	// Country returns ISO 3166-1 alpha-2 code of the country, empty string is returned if it is unknown
+	Country(ip net.IP) string
+	Close() error
+}
+
+type countryLookupNoOp struct{}
+
+func (countryLookupNoOp) Country(net.IP) string {
+	return ""
+}
+
+func (countryLookupNoOp) Close() error {
+	return nil
+}
+
+// NewNoOpCountryLookup creates lookup that never knows the country
+func NewNoOpCountryLookup() CountryLookup {
+	return countryLookupNoOp{}
+}
+
+// GeoIPDatabase resolves countries with the local MaxMind database,
+// e.g. GeoLite2-Country or any other database with "country.iso_code" field
+type GeoIPDatabase struct {
+	reader *maxminddb.Reader
+}
+
+func OpenGeoIPDatabase(path string) (*GeoIPDatabase, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, trace.WrapError(err)
+	}
+	return &GeoIPDatabase{reader: reader}, nil
+}
+
+func (g *GeoIPDatabase) Country(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	var record struct {
+		Country struct {
+			IsoCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := g.reader.Lookup(ip, &record); err != nil {
+		return ""
+	}
+	return record.Country.IsoCode
+}
+
+func (g *GeoIPDatabase) Close() error {
+	return g.reader.Close()
+}
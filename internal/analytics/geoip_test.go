@@ -0,0 +1,82 @@
+package analytics
+
+import (
+	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mmdbString encodes string of the MaxMind DB data section
+func mmdbString(s string) []byte {
+	return append([]byte{0x40 | byte(len(s))}, s...)
+}
+
+// writeCountryDatabase writes IPv4 MaxMind DB that resolves the network /8 to the country
+func writeCountryDatabase(t *testing.T, network byte, country string) string {
+	const nodeCount = 8
+
+	// every node follows the next bit of the network, other bit leads to the empty record
+	var tree []byte
+	for i := 0; i < nodeCount; i++ {
+		next := uint32(i + 1)
+		if i == nodeCount-1 {
+			// pointer to the start of the data section
+			next = nodeCount + 16
+		}
+		left, right := next, uint32(nodeCount)
+		if network>>(7-i)&1 == 1 {
+			left, right = right, left
+		}
+		tree = append(tree, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+	}
+
+	var data []byte
+	data = append(data, 0xE1)
+	data = append(data, mmdbString("country")...)
+	data = append(data, 0xE1)
+	data = append(data, mmdbString("iso_code")...)
+	data = append(data, mmdbString(country)...)
+
+	var metadata []byte
+	metadata = append(metadata, 0xE5)
+	metadata = append(metadata, mmdbString("node_count")...)
+	metadata = append(metadata, 0xC1, nodeCount)
+	metadata = append(metadata, mmdbString("record_size")...)
+	metadata = append(metadata, 0xA1, 24)
+	metadata = append(metadata, mmdbString("ip_version")...)
+	metadata = append(metadata, 0xA1, 4)
+	metadata = append(metadata, mmdbString("binary_format_major_version")...)
+	metadata = append(metadata, 0xA1, 2)
+	metadata = append(metadata, mmdbString("database_type")...)
+	metadata = append(metadata, mmdbString("Test-Country")...)
+
+	var db []byte
+	db = append(db, tree...)
+	db = append(db, make([]byte, 16)...)
+	db = append(db, data...)
+	db = append(db, "\xAB\xCD\xEFMaxMind.com"...)
+	db = append(db, metadata...)
+
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	require.NoError(t, os.WriteFile(path, db, 0o600))
+	return path
+}
+
+func TestGeoIPDatabase(t *testing.T) {
+	db, err := OpenGeoIPDatabase(writeCountryDatabase(t, 203, "DE"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.Equal(t, "DE", db.Country(net.ParseIP("203.0.113.0")))
+	require.Empty(t, db.Country(net.ParseIP("198.51.100.0")))
+	// IPv6 can not be resolved by IPv4 database
+	require.Empty(t, db.Country(net.ParseIP("2001:db8::")))
+	require.Empty(t, db.Country(nil))
+}
+
+func TestOpenGeoIPDatabase_Missing(t *testing.T) {
+	_, err := OpenGeoIPDatabase(filepath.Join(t.TempDir(), "missing.mmdb"))
+	require.Error(t, err)
+}
@@ -0,0 +1,4 @@
+DROP TABLE clicks_daily;
+DROP INDEX idx_clicks_hourly_bucket;
+DROP TABLE clicks_hourly;
+DROP TABLE clicks;
@@ -0,0 +1,23 @@
+CREATE TABLE clicks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    source TEXT NOT NULL UNIQUE,
+    alias TEXT NOT NULL,
+    url TEXT NOT NULL,
+    clicked_at INTEGER NOT NULL
+);
+
+CREATE TABLE clicks_hourly (
+    alias TEXT NOT NULL,
+    bucket INTEGER NOT NULL,
+    clicks INTEGER NOT NULL,
+    PRIMARY KEY (alias, bucket)
+);
+
+CREATE INDEX idx_clicks_hourly_bucket ON clicks_hourly (bucket);
+
+CREATE TABLE clicks_daily (
+    alias TEXT NOT NULL,
+    bucket INTEGER NOT NULL,
+    clicks INTEGER NOT NULL,
+    PRIMARY KEY (alias, bucket)
+);
@@ -0,0 +1,14 @@
+DROP INDEX idx_clicks_time;
+DROP INDEX idx_clicks_alias_time;
+
+ALTER TABLE clicks DROP COLUMN language;
+ALTER TABLE clicks DROP COLUMN country;
+ALTER TABLE clicks DROP COLUMN bot;
+ALTER TABLE clicks DROP COLUMN os;
+ALTER TABLE clicks DROP COLUMN browser;
+ALTER TABLE clicks DROP COLUMN referrer_host;
+ALTER TABLE clicks DROP COLUMN accept_language;
+ALTER TABLE clicks DROP COLUMN request_id;
+ALTER TABLE clicks DROP COLUMN ip;
+ALTER TABLE clicks DROP COLUMN user_agent;
+ALTER TABLE clicks DROP COLUMN referrer;
@@ -0,0 +1,15 @@
+ALTER TABLE clicks ADD COLUMN referrer TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN request_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN accept_language TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN referrer_host TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN browser TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN os TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN bot INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE clicks ADD COLUMN country TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN language TEXT NOT NULL DEFAULT '';
+
+-- filtered stats are counted from raw clicks
+CREATE INDEX idx_clicks_alias_time ON clicks (alias, clicked_at);
+CREATE INDEX idx_clicks_time ON clicks (clicked_at);
@@ -0,0 +1,283 @@
+package sqlite
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sajoniks/GoShort/internal/analytics"
+	"github.com/sajoniks/GoShort/internal/store/sqlite/migrate"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// busyTimeout is how long connection waits for the database lock before SQLITE_BUSY is returned
+const busyTimeout = time.Second * 5
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// clickStore keeps raw clicks and their rollups per alias and hour or day.
+// Rollups are updated in the same transaction as the click is inserted, so unfiltered queries never scan
+// raw clicks. Filtered queries count raw clicks of the range
+type clickStore struct {
+	db *sql.DB
+
+	insertClickStmt  *sql.Stmt
+	addHourlyStmt    *sql.Stmt
+	addDailyStmt     *sql.Stmt
+	hourlySeriesStmt *sql.Stmt
+	dailySeriesStmt  *sql.Stmt
+	topStmt          *sql.Stmt
+}
+
+// NewClickStore opens analytics database at connString and applies pending migrations
+func NewClickStore(connString string) (analytics.Store, error) {
+	if !strings.HasPrefix(connString, "file:") {
+		connString = "file:" + connString
+	}
+	sep := "?"
+	if strings.Contains(connString, "?") {
+		sep = "&"
+	}
+	connString += sep + fmt.Sprintf("_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", busyTimeout.Milliseconds())
+
+	db, err := sql.Open("sqlite3", connString)
+	if err != nil {
+		return nil, trace.WrapError(err)
+	}
+	if strings.Contains(connString, ":memory:") || strings.Contains(connString, "mode=memory") {
+		// in-memory database is not shared between connections
+		db.SetMaxOpenConns(1)
+	}
+
+	s := &clickStore{db: db}
+	if err := s.migrate(); err != nil {
+		s.Close()
+		return nil, trace.WrapError(err)
+	}
+	if err := s.prepare(); err != nil {
+		s.Close()
+		return nil, trace.WrapError(err)
+	}
+	return s, nil
+}
+
+func (s *clickStore) migrate() error {
+	files, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return err
+	}
+	migrations, err := migrate.Load(files)
+	if err != nil {
+		return err
+	}
+	_, err = migrate.New(s.db, migrations).Up()
+	return err
+}
+
+// prepare prepares statements once for the lifetime of the store
+func (s *clickStore) prepare() error {
+	rollup := `
+		INSERT INTO %s (alias, bucket, clicks) VALUES (?, ?, 1)
+		ON CONFLICT (alias, bucket) DO UPDATE SET clicks = clicks + 1`
+	series := `
+		SELECT bucket, clicks FROM %s
+		WHERE alias = ? AND bucket >= ? AND bucket < ?
+		ORDER BY bucket`
+	for _, p := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&s.insertClickStmt, `
+			INSERT INTO clicks (
+				source, alias, url, clicked_at,
+				referrer, user_agent, ip, request_id, accept_language,
+				referrer_host, browser, os, bot, country, language
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (source) DO NOTHING`},
+		{&s.addHourlyStmt, fmt.Sprintf(rollup, "clicks_hourly")},
+		{&s.addDailyStmt, fmt.Sprintf(rollup, "clicks_daily")},
+		{&s.hourlySeriesStmt, fmt.Sprintf(series, "clicks_hourly")},
+		{&s.dailySeriesStmt, fmt.Sprintf(series, "clicks_daily")},
+		{&s.topStmt, `
+			SELECT alias, SUM(clicks) AS total FROM clicks_hourly
+			WHERE bucket >= ? AND bucket < ?
+			GROUP BY alias
+			ORDER BY total DESC, alias
+			LIMIT ?`},
+	} {
+		stmt, err := s.db.Prepare(p.query)
+		if err != nil {
+			return err
+		}
+		*p.stmt = stmt
+	}
+	return nil
+}
+
+func (s *clickStore) Close() {
+	for _, stmt := range []*sql.Stmt{
+		s.insertClickStmt, s.addHourlyStmt, s.addDailyStmt, s.hourlySeriesStmt, s.dailySeriesStmt, s.topStmt,
+	} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	s.db.Close()
+}
+
+func (s *clickStore) AddClick(c analytics.Click) error {
+	if c.Alias == "" {
+		return trace.WrapError(analytics.ErrAliasEmpty)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Stmt(s.insertClickStmt).Exec(
+		c.Source, c.Alias, c.URL, c.Time.Unix(),
+		c.Referrer, c.UserAgent, c.IP, c.RequestId, c.AcceptLanguage,
+		c.ReferrerHost, c.Browser, c.OS, c.Bot, c.Country, c.Language,
+	)
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	if n == 0 {
+		// click of this source is already counted
+		return nil
+	}
+
+	for _, r := range []struct {
+		stmt *sql.Stmt
+		g    analytics.Granularity
+	}{
+		{s.addHourlyStmt, analytics.Hour},
+		{s.addDailyStmt, analytics.Day},
+	} {
+		if _, err := tx.Stmt(r.stmt).Exec(c.Alias, r.g.Truncate(c.Time).Unix()); err != nil {
+			return trace.WrapError(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return trace.WrapError(err)
+	}
+	return nil
+}
+
+// filterCondition returns condition of the clicks matching f and its arguments
+func filterCondition(f analytics.Filter) (string, []any) {
+	var conditions []string
+	var args []any
+	for _, c := range []struct {
+		column, value string
+	}{
+		{"country", f.Country},
+		{"browser", f.Browser},
+		{"os", f.OS},
+		{"referrer_host", f.ReferrerHost},
+		{"language", f.Language},
+	} {
+		if c.value != "" {
+			conditions = append(conditions, c.column+" = ? COLLATE NOCASE")
+			args = append(args, c.value)
+		}
+	}
+	if f.Bot != nil {
+		conditions = append(conditions, "bot = ?")
+		args = append(args, *f.Bot)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// bucketsEnd returns the end of the last bucket that starts before to
+func bucketsEnd(to time.Time, g analytics.Granularity) time.Time {
+	end := g.Truncate(to)
+	if end.Before(to) {
+		end = end.Add(g.Duration())
+	}
+	return end
+}
+
+func (s *clickStore) Series(alias string, from, to time.Time, g analytics.Granularity, f analytics.Filter) ([]analytics.Point, error) {
+	var rows *sql.Rows
+	var err error
+	if f.IsEmpty() {
+		stmt := s.hourlySeriesStmt
+		if g == analytics.Day {
+			stmt = s.dailySeriesStmt
+		}
+		rows, err = stmt.Query(alias, g.Truncate(from).Unix(), to.Unix())
+	} else {
+		condition, args := filterCondition(f)
+		size := int64(g.Duration().Seconds())
+		query := fmt.Sprintf(`
+			SELECT clicked_at / %d * %d AS bucket, COUNT(*) FROM clicks
+			WHERE alias = ? AND clicked_at >= ? AND clicked_at < ? AND %s
+			GROUP BY bucket
+			ORDER BY bucket`, size, size, condition)
+		args = append([]any{alias, g.Truncate(from).Unix(), bucketsEnd(to, g).Unix()}, args...)
+		rows, err = s.db.Query(query, args...)
+	}
+	if err != nil {
+		return nil, trace.WrapError(err)
+	}
+	defer rows.Close()
+
+	var points []analytics.Point
+	for rows.Next() {
+		var bucket, clicks int64
+		if err := rows.Scan(&bucket, &clicks); err != nil {
+			return nil, trace.WrapError(err)
+		}
+		points = append(points, analytics.Point{Time: time.Unix(bucket, 0).UTC(), Clicks: clicks})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, trace.WrapError(err)
+	}
+	return points, nil
+}
+
+func (s *clickStore) Top(from, to time.Time, limit int, f analytics.Filter) ([]analytics.AliasClicks, error) {
+	var rows *sql.Rows
+	var err error
+	if f.IsEmpty() {
+		rows, err = s.topStmt.Query(analytics.Hour.Truncate(from).Unix(), to.Unix(), limit)
+	} else {
+		condition, args := filterCondition(f)
+		query := fmt.Sprintf(`
+			SELECT alias, COUNT(*) AS total FROM clicks
+			WHERE clicked_at >= ? AND clicked_at < ? AND %s
+			GROUP BY alias
+			ORDER BY total DESC, alias
+			LIMIT ?`, condition)
+		args = append([]any{analytics.Hour.Truncate(from).Unix(), bucketsEnd(to, analytics.Hour).Unix()}, args...)
+		rows, err = s.db.Query(query, append(args, limit)...)
+	}
+	if err != nil {
+		return nil, trace.WrapError(err)
+	}
+	defer rows.Close()
+
+	var top []analytics.AliasClicks
+	for rows.Next() {
+		var a analytics.AliasClicks
+		if err := rows.Scan(&a.Alias, &a.Clicks); err != nil {
+			return nil, trace.WrapError(err)
+		}
+		top = append(top, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, trace.WrapError(err)
+	}
+	return top, nil
+}
@@ -0,0 +1,160 @@
+package sqlite
+
+import (
+	"fmt"
+	"github.com/sajoniks/GoShort/internal/analytics"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var day = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestStore(t *testing.T) analytics.Store {
+	s, err := NewClickStore(filepath.Join(t.TempDir(), "analytics.sqlite"))
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func addClicks(t *testing.T, s analytics.Store, alias string, times ...time.Time) {
+	for _, tm := range times {
+		require.NoError(t, s.AddClick(analytics.Click{
+			Alias:  alias,
+			URL:    "https://example.com",
+			Time:   tm,
+			Source: fmt.Sprintf("%s/%d", alias, tm.UnixNano()),
+		}))
+	}
+}
+
+func TestClickStore_Series(t *testing.T) {
+	s := newTestStore(t)
+	addClicks(t, s, "aaaa",
+		day.Add(time.Minute),
+		day.Add(time.Minute*59),
+		day.Add(time.Hour*2),
+		day.Add(time.Hour*25),
+	)
+	addClicks(t, s, "bbbb", day.Add(time.Minute))
+
+	hourly, err := s.Series("aaaa", day, day.Add(time.Hour*24), analytics.Hour, analytics.Filter{})
+	require.NoError(t, err)
+	require.Equal(t, []analytics.Point{
+		{Time: day, Clicks: 2},
+		{Time: day.Add(time.Hour * 2), Clicks: 1},
+	}, hourly)
+
+	// from is truncated to the bucket
+	daily, err := s.Series("aaaa", day.Add(time.Hour*12), day.Add(time.Hour*48), analytics.Day, analytics.Filter{})
+	require.NoError(t, err)
+	require.Equal(t, []analytics.Point{
+		{Time: day, Clicks: 3},
+		{Time: day.Add(time.Hour * 24), Clicks: 1},
+	}, daily)
+
+	empty, err := s.Series("cccc", day, day.Add(time.Hour*24), analytics.Hour, analytics.Filter{})
+	require.NoError(t, err)
+	require.Empty(t, empty)
+}
+
+func TestClickStore_DuplicateSource(t *testing.T) {
+	s := newTestStore(t)
+	c := analytics.Click{Alias: "aaaa", URL: "https://example.com", Time: day, Source: "url.events/0/1"}
+	require.NoError(t, s.AddClick(c))
+	// redelivered message is counted once
+	require.NoError(t, s.AddClick(c))
+
+	points, err := s.Series("aaaa", day, day.Add(time.Hour), analytics.Hour, analytics.Filter{})
+	require.NoError(t, err)
+	require.Equal(t, []analytics.Point{{Time: day, Clicks: 1}}, points)
+
+	require.ErrorIs(t, s.AddClick(analytics.Click{Source: "url.events/0/2"}), analytics.ErrAliasEmpty)
+}
+
+func TestClickStore_Top(t *testing.T) {
+	s := newTestStore(t)
+	addClicks(t, s, "aaaa", day, day.Add(time.Minute))
+	addClicks(t, s, "bbbb", day, day.Add(time.Minute), day.Add(time.Minute*2))
+	addClicks(t, s, "cccc", day.Add(time.Hour))
+	// outside of the range
+	addClicks(t, s, "dddd", day.Add(-time.Hour), day.Add(time.Hour*24), day.Add(time.Hour*25))
+
+	top, err := s.Top(day, day.Add(time.Hour*24), 10, analytics.Filter{})
+	require.NoError(t, err)
+	require.Equal(t, []analytics.AliasClicks{
+		{Alias: "bbbb", Clicks: 3},
+		{Alias: "aaaa", Clicks: 2},
+		{Alias: "cccc", Clicks: 1},
+	}, top)
+
+	top, err = s.Top(day, day.Add(time.Hour*24), 1, analytics.Filter{})
+	require.NoError(t, err)
+	require.Equal(t, []analytics.AliasClicks{{Alias: "bbbb", Clicks: 3}}, top)
+}
+
+func TestClickStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analytics.sqlite")
+	s, err := NewClickStore(path)
+	require.NoError(t, err)
+	addClicks(t, s, "aaaa", day)
+	s.Close()
+
+	// migrations are applied once, clicks are persisted
+	s, err = NewClickStore(path)
+	require.NoError(t, err)
+	defer s.Close()
+	points, err := s.Series("aaaa", day, day.Add(time.Hour), analytics.Hour, analytics.Filter{})
+	require.NoError(t, err)
+	require.Len(t, points, 1)
+}
+
+func TestClickStore_Filter(t *testing.T) {
+	s := newTestStore(t)
+	bot := true
+	for i, c := range []analytics.Click{
+		{Alias: "aaaa", Time: day, Country: "DE", Browser: "Firefox", OS: "Linux", Language: "de"},
+		{Alias: "aaaa", Time: day.Add(time.Minute), Country: "DE", Browser: "Chrome", OS: "Android"},
+		{Alias: "aaaa", Time: day.Add(time.Hour * 2), Country: "US", Browser: "Chrome", ReferrerHost: "news.example.org"},
+		{Alias: "aaaa", Time: day.Add(time.Hour * 3), Bot: true, Browser: "Other"},
+		{Alias: "bbbb", Time: day, Country: "DE", Browser: "Chrome"},
+	} {
+		c.Source = fmt.Sprint(i)
+		require.NoError(t, s.AddClick(c))
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter analytics.Filter
+		want   []analytics.Point
+	}{
+		{"country", analytics.Filter{Country: "de"}, []analytics.Point{{Time: day, Clicks: 2}}},
+		{"browser", analytics.Filter{Browser: "Chrome"}, []analytics.Point{
+			{Time: day, Clicks: 1},
+			{Time: day.Add(time.Hour * 2), Clicks: 1},
+		}},
+		{"country and browser", analytics.Filter{Country: "DE", Browser: "Chrome"}, []analytics.Point{{Time: day, Clicks: 1}}},
+		{"referrer", analytics.Filter{ReferrerHost: "news.example.org"}, []analytics.Point{{Time: day.Add(time.Hour * 2), Clicks: 1}}},
+		{"bot", analytics.Filter{Bot: &bot}, []analytics.Point{{Time: day.Add(time.Hour * 3), Clicks: 1}}},
+		{"language", analytics.Filter{Language: "de", OS: "Linux"}, []analytics.Point{{Time: day, Clicks: 1}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// the last bucket is counted whole like the rollups
+			points, err := s.Series("aaaa", day, day.Add(time.Hour*3+time.Minute), analytics.Hour, tc.filter)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, points)
+		})
+	}
+
+	daily, err := s.Series("aaaa", day, day.Add(time.Hour*24), analytics.Day, analytics.Filter{Browser: "chrome"})
+	require.NoError(t, err)
+	require.Equal(t, []analytics.Point{{Time: day, Clicks: 2}}, daily)
+
+	top, err := s.Top(day, day.Add(time.Hour*24), 10, analytics.Filter{Country: "DE"})
+	require.NoError(t, err)
+	require.Equal(t, []analytics.AliasClicks{
+		{Alias: "aaaa", Clicks: 2},
+		{Alias: "bbbb", Clicks: 1},
+	}, top)
+}
@@ -0,0 +1,104 @@
+package analytics
+
+import (
+	"golang.org/x/text/language"
+	"strings"
+)
+
+// UserAgent is the client described by the User-Agent header
+type UserAgent struct {
+	// Browser is the browser family, e.g. "Chrome". It is "Other" for unknown clients and empty for empty header
+	Browser string
+	// OS is the operating system family, e.g. "Android". It is "Other" for unknown systems and empty for empty header
+	OS  string
+	Bot bool
+}
+
+// botMarkers are lowercase substrings of user agents of crawlers, monitors and http libraries
+var botMarkers = []string{
+	"bot", "crawl", "spider", "slurp", "preview", "monitor", "headless",
+	"curl/", "wget/", "python-requests", "go-http-client", "okhttp", "java/", "httpclient",
+}
+
+// browsers are checked in order, because user agents mention browsers they are compatible with
+var browsers = []struct {
+	marker, name string
+}{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"Edge/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Opera", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"YaBrowser/", "Yandex"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Chromium/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"MSIE ", "Internet Explorer"},
+	{"Trident/", "Internet Explorer"},
+}
+
+// systems are checked in order, because Android user agents mention Linux and iOS ones mention Mac OS X
+var systems = []struct {
+	marker, name string
+}{
+	{"Windows", "Windows"},
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"iPod", "iOS"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// ParseUserAgent detects browser and operating system families of the user agent
+func ParseUserAgent(ua string) UserAgent {
+	if ua == "" {
+		return UserAgent{}
+	}
+
+	result := UserAgent{Browser: "Other", OS: "Other"}
+	lower := strings.ToLower(ua)
+	for _, marker := range botMarkers {
+		if strings.Contains(lower, marker) {
+			result.Bot = true
+			break
+		}
+	}
+	for _, b := range browsers {
+		if strings.Contains(ua, b.marker) {
+			result.Browser = b.name
+			break
+		}
+	}
+	for _, s := range systems {
+		if strings.Contains(ua, s.marker) {
+			result.OS = s.name
+			break
+		}
+	}
+	return result
+}
+
+var wildcardLanguage = language.MustParseBase("mul")
+
+// PrimaryLanguage returns the base language of the most preferred tag of the Accept-Language header, e.g. "en".
+// Empty string is returned if header is empty or malformed
+func PrimaryLanguage(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return ""
+	}
+	base, confidence := tags[0].Base()
+	// wildcard "*" is parsed as "mul"
+	if confidence == language.No || base == wildcardLanguage {
+		return ""
+	}
+	return base.String()
+}
@@ -0,0 +1,61 @@
+package analytics
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	for _, tc := range []struct {
+		ua   string
+		want UserAgent
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/125.0.0.0 Safari/537.36",
+			UserAgent{Browser: "Chrome", OS: "Windows"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/125.0.0.0 Safari/537.36 Edg/125.0.2535.67",
+			UserAgent{Browser: "Edge", OS: "Windows"},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15",
+			UserAgent{Browser: "Safari", OS: "macOS"},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/125.0.6422.80 Mobile/15E148 Safari/604.1",
+			UserAgent{Browser: "Chrome", OS: "iOS"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/25.0 Chrome/121.0.0.0 Mobile Safari/537.36",
+			UserAgent{Browser: "Samsung Internet", OS: "Android"},
+		},
+		{
+			"Mozilla/5.0 (X11; Linux x86_64; rv:126.0) Gecko/20100101 Firefox/126.0",
+			UserAgent{Browser: "Firefox", OS: "Linux"},
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			UserAgent{Browser: "Other", OS: "Other", Bot: true},
+		},
+		{
+			"curl/8.5.0",
+			UserAgent{Browser: "Other", OS: "Other", Bot: true},
+		},
+		{"", UserAgent{}},
+	} {
+		require.Equal(t, tc.want, ParseUserAgent(tc.ua), tc.ua)
+	}
+}
+
+func TestPrimaryLanguage(t *testing.T) {
+	for header, want := range map[string]string{
+		"de-DE,de;q=0.9,en;q=0.8": "de",
+		"en;q=0.5, fr-CA":         "fr",
+		"*":                       "",
+		"":                        "",
+		"not a language;;":        "",
+	} {
+		require.Equal(t, want, PrimaryLanguage(header), header)
+	}
+}
@@ -1,5 +0,0 @@
-package event
-
-type BaseEvent struct {
-	Type string `json:"type"`
-}
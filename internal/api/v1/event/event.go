@@ -0,0 +1,54 @@
+package event
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event is the payload of the Envelope
+type Event interface {
+	// EventType is the name of the event, e.g. "url_add"
+	EventType() string
+	// EventVersion is the version of the payload schema, starting from 1.
+	// It is incremented on every incompatible change of the payload
+	EventVersion() int
+}
+
+// Envelope is the message every event is sent in.
+//
+// Messages of older producers have no envelope: they are payloads with "type" field.
+// Such messages are decoded as the version 0 of their type, with the whole message as the data
+type Envelope struct {
+	// Id is unique for every event, consumers can use it to drop duplicates
+	Id         string    `json:"id"`
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Producer is the name of the service that created the event
+	Producer string          `json:"producer"`
+	Data     json.RawMessage `json:"data"`
+}
+
+const (
+	// ContentTypeJson is the content type of envelopes encoded by Registry.Encode
+	ContentTypeJson = "application/json"
+	// ContentTypeProtobuf is the content type of envelopes encoded by Registry.EncodeProtobuf
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Keyed is implemented by events that must be consumed in order with other events of the same key
+type Keyed interface {
+	EventKey() string
+}
+
+// ProtoEvent is the event that has protobuf schema and can be encoded by Registry.EncodeProtobuf.
+// Pointer to the event must implement ProtoUnmarshaler
+type ProtoEvent interface {
+	Event
+	MarshalProto() ([]byte, error)
+}
+
+// ProtoUnmarshaler decodes the event from its protobuf schema
+type ProtoUnmarshaler interface {
+	UnmarshalProto(data []byte) error
+}
@@ -0,0 +1,222 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sajoniks/GoShort/internal/api/v1/event/eventpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reflect"
+	"time"
+)
+
+var (
+	// ErrUnknownType is returned for events of types that are not registered
+	ErrUnknownType = errors.New("unknown event type")
+	// ErrUnknownVersion is returned for events of versions that are not registered and can not be upcasted,
+	// e.g. events of newer producers
+	ErrUnknownVersion = errors.New("unknown event version")
+	ErrMalformed      = errors.New("malformed event")
+	// ErrNoProtoSchema is returned for protobuf encoding of events that have no protobuf schema
+	ErrNoProtoSchema = errors.New("event has no protobuf schema")
+)
+
+// Upcaster converts data of the event version to the data of the next version.
+// Upcasters convert json data only, protobuf events are decoded with the registered version
+type Upcaster func(data json.RawMessage) (json.RawMessage, error)
+
+// Identity is the upcaster of versions with the compatible data
+func Identity(data json.RawMessage) (json.RawMessage, error) {
+	return data, nil
+}
+
+type typeVersion struct {
+	eventType string
+	version   int
+}
+
+// Registry maps event types and versions to Go types. Producers encode events with the registry,
+// consumers decode them with the registry of the same types, so both share the definition of the events
+type Registry struct {
+	producer  string
+	types     map[typeVersion]reflect.Type
+	upcasters map[typeVersion]Upcaster
+}
+
+// NewRegistry creates empty registry, producer is the name of the service that encodes events
+func NewRegistry(producer string) *Registry {
+	return &Registry{
+		producer:  producer,
+		types:     make(map[typeVersion]reflect.Type),
+		upcasters: make(map[typeVersion]Upcaster),
+	}
+}
+
+// Register registers the type of e for its type and version. Decoded events have the type of e
+func (r *Registry) Register(e Event) {
+	r.types[typeVersion{e.EventType(), e.EventVersion()}] = reflect.TypeOf(e)
+}
+
+// RegisterUpcaster registers conversion of the event data of the version to the next version.
+// Events of older versions are upcasted until the version of registered type is reached
+func (r *Registry) RegisterUpcaster(eventType string, version int, up Upcaster) {
+	r.upcasters[typeVersion{eventType, version}] = up
+}
+
+// Encode creates envelope of e and returns its json
+func (r *Registry) Encode(e Event) ([]byte, error) {
+	env, err := r.newEnvelope(e)
+	if err != nil {
+		return nil, err
+	}
+	if env.Data, err = json.Marshal(e); err != nil {
+		return nil, err
+	}
+	return json.Marshal(env)
+}
+
+// EncodeProtobuf creates envelope of e and returns its protobuf encoding, e must implement ProtoEvent
+func (r *Registry) EncodeProtobuf(e Event) ([]byte, error) {
+	env, err := r.newEnvelope(e)
+	if err != nil {
+		return nil, err
+	}
+	pe, ok := e.(ProtoEvent)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s version %d", ErrNoProtoSchema, env.Type, env.Version)
+	}
+	if env.Data, err = pe.MarshalProto(); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&eventpb.Envelope{
+		Id:         env.Id,
+		Type:       env.Type,
+		Version:    int32(env.Version),
+		OccurredAt: timestamppb.New(env.OccurredAt),
+		Producer:   env.Producer,
+		Data:       env.Data,
+	})
+}
+
+// occurredAt returns the time of the protobuf timestamp, zero time is returned if it is not set
+func occurredAt(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+func (r *Registry) newEnvelope(e Event) (Envelope, error) {
+	key := typeVersion{e.EventType(), e.EventVersion()}
+	if _, ok := r.types[key]; !ok {
+		return Envelope{}, fmt.Errorf("%w: %s version %d", ErrUnknownType, key.eventType, key.version)
+	}
+	return Envelope{
+		Id:         uuid.New().String(),
+		Type:       key.eventType,
+		Version:    key.version,
+		OccurredAt: time.Now().UTC(),
+		Producer:   r.producer,
+	}, nil
+}
+
+// DecodeContent decodes message of the content type, messages without content type are json
+func (r *Registry) DecodeContent(contentType string, message []byte) (Envelope, Event, error) {
+	switch contentType {
+	case "", ContentTypeJson:
+		return r.Decode(message)
+	case ContentTypeProtobuf:
+		return r.DecodeProtobuf(message)
+	default:
+		return Envelope{}, nil, fmt.Errorf("%w: unsupported content type %q", ErrMalformed, contentType)
+	}
+}
+
+// Decode decodes message into the envelope and the event of the registered type.
+// Data of older versions is upcasted to the registered version, Envelope.Version is the version of the message
+func (r *Registry) Decode(message []byte) (Envelope, Event, error) {
+	var env Envelope
+	if err := json.Unmarshal(message, &env); err != nil {
+		return Envelope{}, nil, errors.Join(ErrMalformed, err)
+	}
+	if env.Type == "" {
+		return env, nil, fmt.Errorf("%w: event has no type", ErrMalformed)
+	}
+	data := env.Data
+	if env.Version == 0 && len(data) == 0 {
+		// message of the producer without envelopes
+		data = message
+	}
+
+	version := env.Version
+	t, ok := r.types[typeVersion{env.Type, version}]
+	for !ok {
+		up, found := r.upcasters[typeVersion{env.Type, version}]
+		if !found {
+			if !r.hasType(env.Type) {
+				return env, nil, fmt.Errorf("%w: %s", ErrUnknownType, env.Type)
+			}
+			return env, nil, fmt.Errorf("%w: %s version %d", ErrUnknownVersion, env.Type, env.Version)
+		}
+		var err error
+		if data, err = up(data); err != nil {
+			return env, nil, fmt.Errorf("%w: upcasting %s version %d: %w", ErrMalformed, env.Type, version, err)
+		}
+		version++
+		t, ok = r.types[typeVersion{env.Type, version}]
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return env, nil, errors.Join(ErrMalformed, err)
+	}
+	return env, v.Elem().Interface().(Event), nil
+}
+
+// DecodeProtobuf decodes protobuf message into the envelope and the event of the registered type.
+// Events are not upcasted, the version of the message must be registered
+func (r *Registry) DecodeProtobuf(message []byte) (Envelope, Event, error) {
+	var pb eventpb.Envelope
+	if err := proto.Unmarshal(message, &pb); err != nil {
+		return Envelope{}, nil, errors.Join(ErrMalformed, err)
+	}
+	env := Envelope{
+		Id:         pb.Id,
+		Type:       pb.Type,
+		Version:    int(pb.Version),
+		OccurredAt: occurredAt(pb.OccurredAt),
+		Producer:   pb.Producer,
+		Data:       pb.Data,
+	}
+	if env.Type == "" {
+		return env, nil, fmt.Errorf("%w: event has no type", ErrMalformed)
+	}
+	t, ok := r.types[typeVersion{env.Type, env.Version}]
+	if !ok {
+		if !r.hasType(env.Type) {
+			return env, nil, fmt.Errorf("%w: %s", ErrUnknownType, env.Type)
+		}
+		return env, nil, fmt.Errorf("%w: %s version %d", ErrUnknownVersion, env.Type, env.Version)
+	}
+
+	v := reflect.New(t)
+	u, ok := v.Interface().(ProtoUnmarshaler)
+	if !ok {
+		return env, nil, fmt.Errorf("%w: %s version %d", ErrNoProtoSchema, env.Type, env.Version)
+	}
+	if err := u.UnmarshalProto(env.Data); err != nil {
+		return env, nil, errors.Join(ErrMalformed, err)
+	}
+	return env, v.Elem().Interface().(Event), nil
+}
+
+func (r *Registry) hasType(eventType string) bool {
+	for key := range r.types {
+		if key.eventType == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package event
+
+import (
+	"encoding/json"
+	"github.com/sajoniks/GoShort/internal/api/v1/event/eventpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+	"time"
+)
+
+// renamedEvent is the version 2 of the event, its version 1 had "name" field instead of "title"
+type renamedEvent struct {
+	Title string `json:"title"`
+}
+
+func (renamedEvent) EventType() string { return "renamed" }
+func (renamedEvent) EventVersion() int { return 2 }
+
+// protoEvent has protobuf schema, its data is the string value
+type protoEvent struct {
+	Name string `json:"name"`
+}
+
+func (protoEvent) EventType() string { return "proto" }
+func (protoEvent) EventVersion() int { return 1 }
+
+func (e protoEvent) MarshalProto() ([]byte, error) {
+	return proto.Marshal(wrapperspb.String(e.Name))
+}
+
+func (e *protoEvent) UnmarshalProto(data []byte) error {
+	var v wrapperspb.StringValue
+	if err := proto.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	e.Name = v.Value
+	return nil
+}
+
+func newTestRegistry() *Registry {
+	r := NewRegistry("test")
+	r.Register(renamedEvent{})
+	r.Register(protoEvent{})
+	r.RegisterUpcaster("renamed", 0, Identity)
+	r.RegisterUpcaster("renamed", 1, func(data json.RawMessage) (json.RawMessage, error) {
+		var v1 struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return nil, err
+		}
+		return json.Marshal(renamedEvent{Title: v1.Name})
+	})
+	return r
+}
+
+func TestRegistry_EncodeDecode(t *testing.T) {
+	r := newTestRegistry()
+
+	message, err := r.Encode(renamedEvent{Title: "a"})
+	require.NoError(t, err)
+
+	env, e, err := r.Decode(message)
+	require.NoError(t, err)
+	require.Equal(t, renamedEvent{Title: "a"}, e)
+	require.NotEmpty(t, env.Id)
+	require.Equal(t, "renamed", env.Type)
+	require.Equal(t, 2, env.Version)
+	require.Equal(t, "test", env.Producer)
+	require.WithinDuration(t, time.Now(), env.OccurredAt, time.Minute)
+
+	// every event has its own id
+	other, err := r.Encode(renamedEvent{Title: "a"})
+	require.NoError(t, err)
+	otherEnv, _, err := r.Decode(other)
+	require.NoError(t, err)
+	require.NotEqual(t, env.Id, otherEnv.Id)
+}
+
+func TestRegistry_Upcast(t *testing.T) {
+	r := newTestRegistry()
+
+	env, e, err := r.Decode([]byte(`{"id":"1","type":"renamed","version":1,"data":{"name":"a"}}`))
+	require.NoError(t, err)
+	require.Equal(t, renamedEvent{Title: "a"}, e)
+	// envelope keeps the version of the message
+	require.Equal(t, 1, env.Version)
+
+	// message without envelope is the version 0
+	env, e, err = r.Decode([]byte(`{"type":"renamed","name":"b"}`))
+	require.NoError(t, err)
+	require.Equal(t, renamedEvent{Title: "b"}, e)
+	require.Equal(t, 0, env.Version)
+}
+
+func TestRegistry_Errors(t *testing.T) {
+	r := newTestRegistry()
+
+	for _, tc := range []struct {
+		name    string
+		message string
+		err     error
+	}{
+		{"unknown type", `{"type":"other","version":1,"data":{}}`, ErrUnknownType},
+		{"newer version", `{"type":"renamed","version":3,"data":{}}`, ErrUnknownVersion},
+		{"not json", `not json`, ErrMalformed},
+		{"no type", `{"version":1,"data":{}}`, ErrMalformed},
+		{"malformed data", `{"type":"renamed","version":2,"data":{"title":1}}`, ErrMalformed},
+		{"malformed upcasted data", `{"type":"renamed","version":1,"data":{"name":1}}`, ErrMalformed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := r.Decode([]byte(tc.message))
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	_, err := NewRegistry("test").Encode(renamedEvent{})
+	require.ErrorIs(t, err, ErrUnknownType)
+}
+
+func TestRegistry_Protobuf(t *testing.T) {
+	r := newTestRegistry()
+
+	message, err := r.EncodeProtobuf(protoEvent{Name: "a"})
+	require.NoError(t, err)
+
+	env, e, err := r.DecodeContent(ContentTypeProtobuf, message)
+	require.NoError(t, err)
+	require.Equal(t, protoEvent{Name: "a"}, e)
+	require.NotEmpty(t, env.Id)
+	require.Equal(t, "proto", env.Type)
+	require.Equal(t, 1, env.Version)
+	require.Equal(t, "test", env.Producer)
+	require.WithinDuration(t, time.Now(), env.OccurredAt, time.Minute)
+
+	// occurred_at is optional in protobuf
+	data, err := protoEvent{Name: "a"}.MarshalProto()
+	require.NoError(t, err)
+	message, err = proto.Marshal(&eventpb.Envelope{Type: "proto", Version: 1, Data: data})
+	require.NoError(t, err)
+	env, e, err = r.DecodeProtobuf(message)
+	require.NoError(t, err)
+	require.Equal(t, protoEvent{Name: "a"}, e)
+	require.True(t, env.OccurredAt.IsZero())
+
+	// the same event is decoded from json
+	message, err = r.Encode(protoEvent{Name: "a"})
+	require.NoError(t, err)
+	_, e, err = r.DecodeContent("", message)
+	require.NoError(t, err)
+	require.Equal(t, protoEvent{Name: "a"}, e)
+}
+
+func TestRegistry_ProtobufErrors(t *testing.T) {
+	r := newTestRegistry()
+
+	_, err := r.EncodeProtobuf(renamedEvent{Title: "a"})
+	require.ErrorIs(t, err, ErrNoProtoSchema)
+
+	// protobuf events are not upcasted
+	message, err := proto.Marshal(&eventpb.Envelope{Type: "renamed", Version: 1})
+	require.NoError(t, err)
+	_, _, err = r.DecodeProtobuf(message)
+	require.ErrorIs(t, err, ErrUnknownVersion)
+
+	message, err = proto.Marshal(&eventpb.Envelope{Type: "unknown", Version: 1})
+	require.NoError(t, err)
+	_, _, err = r.DecodeProtobuf(message)
+	require.ErrorIs(t, err, ErrUnknownType)
+
+	message, err = proto.Marshal(&eventpb.Envelope{Type: "renamed", Version: 2})
+	require.NoError(t, err)
+	_, _, err = r.DecodeProtobuf(message)
+	require.ErrorIs(t, err, ErrNoProtoSchema)
+
+	_, _, err = r.DecodeProtobuf([]byte("{not protobuf"))
+	require.ErrorIs(t, err, ErrMalformed)
+
+	_, _, err = r.DecodeContent("text/plain", []byte("a"))
+	require.ErrorIs(t, err, ErrMalformed)
+}
@@ -0,0 +1,77 @@
+package urls
+
+import (
+	"github.com/sajoniks/GoShort/internal/api/v1/event/urls/urlspb"
+	"google.golang.org/protobuf/proto"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative urlspb/urls.proto
+//go:generate protoc --go_out=.. --go_opt=paths=source_relative --proto_path=.. ../eventpb/envelope.proto
+
+func (e AddedEvent) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&urlspb.AddedEvent{Source: e.Source, Alias: e.Alias})
+}
+
+func (e *AddedEvent) UnmarshalProto(data []byte) error {
+	var pb urlspb.AddedEvent
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+	*e = AddedEvent{Source: pb.Source, Alias: pb.Alias}
+	return nil
+}
+
+func (e AccessedEvent) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&urlspb.AccessedEvent{
+		Url:            e.URL,
+		Alias:          e.Alias,
+		Referrer:       e.Referrer,
+		UserAgent:      e.UserAgent,
+		Ip:             e.IP,
+		RequestId:      e.RequestId,
+		AcceptLanguage: e.AcceptLanguage,
+	})
+}
+
+func (e *AccessedEvent) UnmarshalProto(data []byte) error {
+	var pb urlspb.AccessedEvent
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+	*e = AccessedEvent{
+		URL:            pb.Url,
+		Alias:          pb.Alias,
+		Referrer:       pb.Referrer,
+		UserAgent:      pb.UserAgent,
+		IP:             pb.Ip,
+		RequestId:      pb.RequestId,
+		AcceptLanguage: pb.AcceptLanguage,
+	}
+	return nil
+}
+
+func (e UpdatedEvent) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&urlspb.UpdatedEvent{Source: e.Source, Alias: e.Alias})
+}
+
+func (e *UpdatedEvent) UnmarshalProto(data []byte) error {
+	var pb urlspb.UpdatedEvent
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+	*e = UpdatedEvent{Source: pb.Source, Alias: pb.Alias}
+	return nil
+}
+
+func (e DeletedEvent) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&urlspb.DeletedEvent{Alias: e.Alias})
+}
+
+func (e *DeletedEvent) UnmarshalProto(data []byte) error {
+	var pb urlspb.DeletedEvent
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+	*e = DeletedEvent{Alias: pb.Alias}
+	return nil
+}
@@ -5,25 +5,63 @@ import "github.com/sajoniks/GoShort/internal/api/v1/event"
 const (
 	EventTagUrlAdded    = "url_add"
 	EventTagUrlAccessed = "url_access"
+	EventTagUrlUpdated  = "url_updated"
+	EventTagUrlDeleted  = "url_deleted"
 )
 
 type AddedEvent struct {
-	event.BaseEvent
 	Source string `json:"source"`
 	Alias  string `json:"alias"`
 }
 
+func (AddedEvent) EventType() string  { return EventTagUrlAdded }
+func (AddedEvent) EventVersion() int  { return 1 }
+func (e AddedEvent) EventKey() string { return e.Alias }
+
+// AccessedEvent is sent on every redirect. Time of the access is the time the event occurred at
 type AccessedEvent struct {
-	event.BaseEvent
-	URL   string `json:"url"`
+	URL       string `json:"url"`
+	Alias     string `json:"alias"`
+	Referrer  string `json:"referrer,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	// IP is the anonymized ip of the client, it identifies the network of the client only
+	IP             string `json:"ip,omitempty"`
+	RequestId      string `json:"request_id,omitempty"`
+	AcceptLanguage string `json:"accept_language,omitempty"`
+}
+
+func (AccessedEvent) EventType() string  { return EventTagUrlAccessed }
+func (AccessedEvent) EventVersion() int  { return 1 }
+func (e AccessedEvent) EventKey() string { return e.Alias }
+
+type UpdatedEvent struct {
+	Source string `json:"source"`
+	Alias  string `json:"alias"`
+}
+
+func (UpdatedEvent) EventType() string  { return EventTagUrlUpdated }
+func (UpdatedEvent) EventVersion() int  { return 1 }
+func (e UpdatedEvent) EventKey() string { return e.Alias }
+
+type DeletedEvent struct {
 	Alias string `json:"alias"`
 }
 
+func (DeletedEvent) EventType() string  { return EventTagUrlDeleted }
+func (DeletedEvent) EventVersion() int  { return 1 }
+func (e DeletedEvent) EventKey() string { return e.Alias }
+
+// Register registers url events in r. Events sent without envelope are upcasted to the version 1,
+// their fields are the same
+func Register(r *event.Registry) {
+	for _, e := range []event.Event{AddedEvent{}, AccessedEvent{}, UpdatedEvent{}, DeletedEvent{}} {
+		r.Register(e)
+		r.RegisterUpcaster(e.EventType(), 0, event.Identity)
+	}
+}
+
 func NewAddedEvent(src, alias string) AddedEvent {
 	return AddedEvent{
-		BaseEvent: event.BaseEvent{
-			Type: EventTagUrlAdded,
-		},
 		Source: src,
 		Alias:  alias,
 	}
@@ -31,10 +69,20 @@ func NewAddedEvent(src, alias string) AddedEvent {
 
 func NewAccessedEvent(url, alias string) AccessedEvent {
 	return AccessedEvent{
-		BaseEvent: event.BaseEvent{
-			Type: EventTagUrlAccessed,
-		},
 		URL:   url,
 		Alias: alias,
 	}
 }
+
+func NewUpdatedEvent(src, alias string) UpdatedEvent {
+	return UpdatedEvent{
+		Source: src,
+		Alias:  alias,
+	}
+}
+
+func NewDeletedEvent(alias string) DeletedEvent {
+	return DeletedEvent{
+		Alias: alias,
+	}
+}
@@ -0,0 +1,59 @@
+package urls
+
+import (
+	"github.com/sajoniks/GoShort/internal/api/v1/event"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRegister_LegacyEvents(t *testing.T) {
+	r := event.NewRegistry("test")
+	Register(r)
+
+	// events were sent without envelope before
+	for message, want := range map[string]event.Event{
+		`{"type":"url_add","source":"https://example.com","alias":"a"}`:                               NewAddedEvent("https://example.com", "a"),
+		`{"type":"url_access","url":"https://example.com","alias":"a","time":"2024-05-01T00:00:00Z"}`: NewAccessedEvent("https://example.com", "a"),
+		`{"type":"url_updated","source":"https://example.com","alias":"a"}`:                           NewUpdatedEvent("https://example.com", "a"),
+		`{"type":"url_deleted","alias":"a"}`:                                                          NewDeletedEvent("a"),
+	} {
+		env, e, err := r.Decode([]byte(message))
+		require.NoError(t, err, message)
+		require.Equal(t, 0, env.Version)
+		require.Equal(t, want, e)
+	}
+}
+
+func TestRegister_RoundTrip(t *testing.T) {
+	r := event.NewRegistry("test")
+	Register(r)
+
+	for _, e := range []event.Event{
+		NewAddedEvent("https://example.com", "a"),
+		AccessedEvent{
+			URL:            "https://example.com",
+			Alias:          "a",
+			Referrer:       "https://ref.example.com",
+			UserAgent:      "Mozilla/5.0",
+			IP:             "203.0.113.0",
+			RequestId:      "request",
+			AcceptLanguage: "en-US",
+		},
+		NewUpdatedEvent("https://example.com", "a"),
+		NewDeletedEvent("a"),
+	} {
+		message, err := r.Encode(e)
+		require.NoError(t, err)
+		env, decoded, err := r.Decode(message)
+		require.NoError(t, err)
+		require.Equal(t, 1, env.Version)
+		require.Equal(t, e, decoded)
+
+		message, err = r.EncodeProtobuf(e)
+		require.NoError(t, err)
+		env, decoded, err = r.DecodeProtobuf(message)
+		require.NoError(t, err)
+		require.Equal(t, 1, env.Version)
+		require.Equal(t, e, decoded)
+	}
+}
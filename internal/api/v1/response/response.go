@@ -5,6 +5,7 @@ import "fmt"
 type BaseResponse struct {
 	Ok    bool   `json:"ok"`
 	Error string `json:"description,omitempty"`
+	Code  string `json:"code,omitempty"`
 }
 
 func Ok() BaseResponse {
@@ -20,6 +21,14 @@ func ErrorMsg(msg string) BaseResponse {
 	}
 }
 
+func ErrorCode(code, msg string) BaseResponse {
+	return BaseResponse{
+		Ok:    false,
+		Error: msg,
+		Code:  code,
+	}
+}
+
 func Error(err error) BaseResponse {
 	return BaseResponse{
 		Ok:    false,
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const keyPrefix = "gs_"
+
+var (
+	ErrKeyNotFound = errors.New("api key does not exist")
+	ErrKeyExists   = errors.New("api key already exists")
+	ErrOwnerEmpty  = errors.New("owner is empty")
+)
+
+type ApiKey struct {
+	ID        int64
+	Owner     string
+	CreatedAt time.Time
+}
+
+// KeyStore keeps hashes of api keys and their owners. Plain keys are never stored
+type KeyStore interface {
+	AddApiKey(owner, keyHash string) (int64, error)
+	// GetApiKeyOwner returns owner of the key hash or ErrKeyNotFound
+	GetApiKeyOwner(keyHash string) (string, error)
+	ListApiKeys() ([]ApiKey, error)
+	DeleteApiKey(id int64) error
+}
+
+// GenerateKey creates a new random api key
+func GenerateKey() (string, error) {
+	rnd := make([]byte, 32)
+	if _, err := rand.Read(rnd); err != nil {
+		return "", err
+	}
+	return keyPrefix + hex.EncodeToString(rnd), nil
+}
+
+// HashKey returns the hash of the key as it is kept in KeyStore.
+// Keys are random and long enough, so there is no need for salted slow hashes
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,14 +7,86 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 )
 
 type AppConfig struct {
-	Server    ServerConfig        `yaml:"server"`
-	Database  DbConfig            `yaml:"database,omitempty"`
-	Cache     CacheConfig         `yaml:"cache,omitempty"`
-	Messaging MessagingConfig     `yaml:"mq,omitempty"`
-	Metrics   MetricsServerConfig `yaml:"metrics,omitempty"`
+	Server     ServerConfig        `yaml:"server"`
+	Database   DbConfig            `yaml:"database,omitempty"`
+	Cache      CacheConfig         `yaml:"cache,omitempty"`
+	Messaging  MessagingConfig     `yaml:"mq,omitempty"`
+	Metrics    MetricsServerConfig `yaml:"metrics,omitempty"`
+	Aliases    AliasConfig         `yaml:"aliases,omitempty"`
+	Expiry     ExpiryConfig        `yaml:"expiry,omitempty"`
+	Auth       AuthConfig          `yaml:"auth,omitempty"`
+	RateLimit  RateLimitConfig     `yaml:"rate-limit,omitempty"`
+	Validation ValidationConfig    `yaml:"validation,omitempty"`
+	Batch      BatchConfig         `yaml:"batch,omitempty"`
+	Analytics  AnalyticsConfig     `yaml:"analytics,omitempty"`
+}
+
+type AnalyticsConfig struct {
+	// GeoIPPath is the path to the MaxMind country database, e.g. GeoLite2-Country.mmdb.
+	// Countries of clicks are not resolved if it is empty
+	GeoIPPath string `yaml:"geoip-path,omitempty"`
+}
+
+type BatchConfig struct {
+	// MaxItems is the maximum number of urls in a single batch request
+	MaxItems int `yaml:"max-items,omitempty"`
+}
+
+type ValidationConfig struct {
+	// SelfHosts are public host names of the service, in addition to server host
+	SelfHosts []string `yaml:"self-hosts,omitempty"`
+	// BlocklistPath is the path to the file with blocked domains, one per line
+	BlocklistPath           string        `yaml:"blocklist-path,omitempty"`
+	BlocklistReloadInterval time.Duration `yaml:"blocklist-reload-interval,omitempty"`
+}
+
+type RateLimitConfig struct {
+	// Backend is either "memory" for a single instance, or "redis" to share limits between instances
+	Backend  string `yaml:"backend"`
+	RedisURL string `yaml:"redis-url,omitempty"`
+	// Routes are limits per route name. Routes without limits are not limited
+	Routes map[string]RouteRateLimitConfig `yaml:"routes,omitempty"`
+}
+
+type RouteRateLimitConfig struct {
+	// Rate is the number of requests per second
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+type AuthConfig struct {
+	// Required rejects requests without api key. Otherwise, such requests are anonymous
+	Required bool `yaml:"required"`
+}
+
+type ExpiryConfig struct {
+	// MaxTTL is the longest lifetime of the link with expiry, 10 years by default
+	MaxTTL time.Duration `yaml:"max-ttl,omitempty"`
+}
+
+type AliasConfig struct {
+	MinLength int      `yaml:"min-length,omitempty"`
+	MaxLength int      `yaml:"max-length,omitempty"`
+	Reserved  []string `yaml:"reserved,omitempty"`
+	// Dedupe returns existing alias when the same owner shortens the same url again.
+	// It is best-effort, concurrent requests with the same url may still create separate aliases
+	Dedupe    bool                 `yaml:"dedupe,omitempty"`
+	Generator AliasGeneratorConfig `yaml:"generator,omitempty"`
+}
+
+type AliasGeneratorConfig struct {
+	// Strategy is one of "hash", "counter", "random" or "words"
+	Strategy string `yaml:"strategy,omitempty"`
+	// Length is the length of random aliases, or the minimal length of counter aliases
+	Length int `yaml:"length,omitempty"`
+	// Alphabet is the set of characters of random aliases
+	Alphabet string `yaml:"alphabet,omitempty"`
+	// Separator joins words of word pair aliases
+	Separator string `yaml:"separator,omitempty"`
 }
 
 type MetricsServerConfig struct {
@@ -23,7 +95,11 @@ type MetricsServerConfig struct {
 }
 
 type DbConfig struct {
+	// Driver is "sqlite", "postgres" or "memory". Memory store is not persisted and is intended for local runs
+	Driver           string `yaml:"driver,omitempty"`
 	ConnectionString string `yaml:"connection-string"`
+	// CleanupInterval is the period of expired urls removal
+	CleanupInterval time.Duration `yaml:"cleanup-interval,omitempty"`
 }
 
 type ServerConfig struct {
@@ -32,10 +108,57 @@ type ServerConfig struct {
 
 type MessagingConfig struct {
 	Kafka KafkaMessagingConfig `yaml:"kafka,omitempty"`
+	// Outbox configures publishing of events through the store outbox
+	Outbox OutboxConfig `yaml:"outbox,omitempty"`
+}
+
+type OutboxConfig struct {
+	// Enabled writes events to the store outbox, from where they are published to the topic of the first Kafka writer
+	Enabled bool `yaml:"enabled,omitempty"`
+	// BatchSize is the maximal number of messages published at once, 100 by default
+	BatchSize int `yaml:"batch-size,omitempty"`
+	// PollInterval is the time outbox is checked for new messages, 1s by default
+	PollInterval time.Duration `yaml:"poll-interval,omitempty"`
+	// MaxBackoff limits the delay between failed attempts to publish messages, 30s by default
+	MaxBackoff time.Duration `yaml:"max-backoff,omitempty"`
 }
 
 type CacheConfig struct {
-	Host string `yaml:"host"`
+	// Backend is either "http" to use the cache service at Host, or "redis" to use Redis at RedisURL directly
+	Backend string `yaml:"backend,omitempty"`
+	// Host is the address of the cache service. Urls are not cached if it is empty
+	Host     string `yaml:"host,omitempty"`
+	RedisURL string `yaml:"redis-url,omitempty"`
+	// TTL is the time urls are kept in Redis, 24h by default
+	TTL time.Duration `yaml:"ttl,omitempty"`
+	// NegativeTTL is the time missing and expired aliases are kept in Redis, 30s by default
+	NegativeTTL time.Duration `yaml:"negative-ttl,omitempty"`
+	// Client configures requests to the cache service of the "http" backend
+	Client CacheClientConfig `yaml:"client,omitempty"`
+	// Local is the in-process cache in front of the cache backend
+	Local LocalCacheConfig `yaml:"local,omitempty"`
+}
+
+type CacheClientConfig struct {
+	// Timeout limits a single request to the cache service, 500ms by default
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// MaxAttempts is the number of attempts of every request including the first one, 3 by default
+	MaxAttempts int `yaml:"max-attempts,omitempty"`
+	// RetryBackoff is the base delay between attempts, 50ms by default. It doubles after every attempt
+	RetryBackoff time.Duration `yaml:"retry-backoff,omitempty"`
+	// BreakerFailures is the number of consecutive failed requests that stops requests to the cache service, 5 by default
+	BreakerFailures int `yaml:"breaker-failures,omitempty"`
+	// BreakerCooldown is the time cache service is not requested after the breaker opens, 10s by default
+	BreakerCooldown time.Duration `yaml:"breaker-cooldown,omitempty"`
+}
+
+type LocalCacheConfig struct {
+	// Size is the maximal number of urls kept in process memory. Local cache is disabled if it is 0
+	Size int `yaml:"size,omitempty"`
+	// TTL is the time urls are kept in process memory, 1m by default
+	TTL time.Duration `yaml:"ttl,omitempty"`
+	// InvalidationRedisURL is Redis used to drop urls changed by other instances from the local cache
+	InvalidationRedisURL string `yaml:"invalidation-redis-url,omitempty"`
 }
 
 type KafkaMessagingConfig struct {
@@ -48,11 +171,40 @@ type KafkaReaderConfig struct {
 	Brokers  []string `yaml:"brokers"`
 	GroupId  string   `yaml:"group-id"`
 	MaxBytes int      `yaml:"max-bytes,omitempty"`
+	// Retry is the policy of messages that failed handling. Used by readers with manual commits only
+	Retry RetryConfig `yaml:"retry,omitempty"`
+	// DeadLetterTopic receives messages that failed all attempts. Such messages are dropped if it is empty
+	DeadLetterTopic string `yaml:"dead-letter-topic,omitempty"`
+}
+
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts including the first one, 3 by default
+	MaxAttempts int `yaml:"max-attempts,omitempty"`
+	// Backoff is the delay after the first failed attempt, 1s by default. It doubles after every attempt
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+	// MaxBackoff limits the delay between attempts, 30s by default
+	MaxBackoff time.Duration `yaml:"max-backoff,omitempty"`
 }
 
 type KafkaWriterConfig struct {
 	Topic   string   `yaml:"topic"`
 	Brokers []string `yaml:"brokers"`
+	// Encoding of the messages is either "json" or "protobuf", json by default
+	Encoding string `yaml:"encoding,omitempty"`
+	// BatchSize is the maximal number of messages sent to a partition at once, 100 by default
+	BatchSize int `yaml:"batch-size,omitempty"`
+	// BatchTimeout is the time incomplete batch waits for more messages, 10ms by default
+	BatchTimeout time.Duration `yaml:"batch-timeout,omitempty"`
+	// Compression is one of "none", "gzip", "snappy", "lz4" or "zstd", none by default
+	Compression string `yaml:"compression,omitempty"`
+	// RequiredAcks is one of "none", "one" or "all", all by default
+	RequiredAcks string `yaml:"required-acks,omitempty"`
+	// Async writes do not wait for the broker, failed writes are logged only.
+	// Outbox relay always waits for the broker
+	Async bool `yaml:"async,omitempty"`
+	// Key is the strategy of message keys, either "alias" or "none", alias by default.
+	// Messages of the same key are sent to the same partition, so events of an alias are consumed in order
+	Key string `yaml:"key,omitempty"`
 }
 
 func MustLoad() *AppConfig {
@@ -14,7 +14,7 @@ import (
 	"net/http"
 )
 
-func NewGetUrlHandler(store urlstore.Store, kafka *mq.KafkaWriterWorker) http.Handler {
+func NewGetUrlHandler(store urlstore.Store, kafka mq.KafkaWriterWorkerInterface) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log := middleware.GetLogging(r.Context())
 		vars := mux.Vars(r)
@@ -32,10 +32,16 @@ func NewGetUrlHandler(store urlstore.Store, kafka *mq.KafkaWriterWorker) http.Ha
 		url, err := store.GetURL(alias)
 		if err != nil {
 			log.Error("get url error", zap.Error(trace.WrapError(err)))
+			if errors.Is(err, urlstore.ErrUrlExpired) {
+				resp = response.ErrorMsg("requested url has expired")
+				_ = helper.WriteProblemJsonStatus(w, http.StatusGone, &resp)
+				return
+			}
+
 			if errors.Is(err, urlstore.ErrUrlNotFound) {
 				resp = response.ErrorMsg("requested url was not found")
 			} else {
-				w.WriteHeader(http.StatusInternalServerError)
+				helper.WriteStoreErrorStatus(w, err)
 				resp = response.ErrorMsg("server error")
 			}
 			_ = helper.WriteProblemJson(w, &resp)
@@ -44,7 +50,13 @@ func NewGetUrlHandler(store urlstore.Store, kafka *mq.KafkaWriterWorker) http.Ha
 
 		log = log.With(zap.String("url", url))
 
-		kafka.AddJsonMessage(urls.NewAccessedEvent(url, alias))
+		event := urls.NewAccessedEvent(url, alias)
+		event.Referrer = r.Referer()
+		event.UserAgent = r.UserAgent()
+		event.IP = helper.AnonymizeIP(helper.ClientIP(r))
+		event.RequestId = r.Header.Get("X-Request-ID")
+		event.AcceptLanguage = r.Header.Get("Accept-Language")
+		kafka.AddJsonMessage(event)
 
 		log.Info("access url")
 		http.Redirect(w, r, url, http.StatusFound)
@@ -5,46 +5,54 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/gorilla/mux"
+	"github.com/sajoniks/GoShort/internal/api/v1/event/urls"
 	"github.com/sajoniks/GoShort/internal/api/v1/response"
 	"github.com/sajoniks/GoShort/internal/http-server/middleware"
+	"github.com/sajoniks/GoShort/internal/mq"
 	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/store/memory"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 var store urlstore.Store
 var router *mux.Router
 
-type mockGetStore struct {
-	items map[string]string
+// busyStore fails reads of the "busy" alias like a store under load
+type busyStore struct {
+	urlstore.Store
 }
 
-func (m *mockGetStore) SaveURL(src, alias string) (string, error) {
-	panic("not supported")
-}
-
-func (m *mockGetStore) GetURL(alias string) (string, error) {
-	if url, ok := m.items[alias]; ok {
-		return url, nil
-	} else {
-		return "", urlstore.ErrUrlNotFound
+func (b *busyStore) GetURL(alias string) (string, error) {
+	if alias == "busy" {
+		return "", urlstore.ErrStoreBusy
 	}
+	return b.Store.GetURL(alias)
 }
 
 func TestMain(m *testing.M) {
-	store = &mockGetStore{
-		items: map[string]string{
-			"aaaa": "https://www.example.com",
-			"bbbb": "http://www.example.com",
-		},
+	store = &busyStore{Store: memory.NewMemoryStore()}
+	for _, item := range []struct {
+		alias, url string
+		expiresAt  time.Time
+	}{
+		{"aaaa", "https://www.example.com", time.Time{}},
+		{"bbbb", "http://www.example.com", time.Time{}},
+		{"dddd", "https://www.example.com/sale", time.Now().Add(-time.Hour)},
+	} {
+		if _, err := store.SaveURL(item.url, item.alias, urlstore.WithExpiry(item.expiresAt)); err != nil {
+			log.Fatalf("failed to prepare store: %v", err)
+		}
 	}
 
 	router = mux.NewRouter()
-	router.Handle("/{alias}", NewGetUrlHandler(store))
+	router.Handle("/{alias}", NewGetUrlHandler(store, mq.NewWriterNoOp()))
 
 	os.Exit(m.Run())
 }
@@ -73,6 +81,11 @@ func TestGetHandler(t *testing.T) {
 			alias:   "",
 			respErr: "empty alias",
 		},
+		{
+			name:    "expired",
+			alias:   "dddd",
+			respErr: "requested url has expired",
+		},
 	}
 
 	logger := zap.NewNop()
@@ -91,7 +104,7 @@ func TestGetHandler(t *testing.T) {
 				require.Equal(t, http.StatusFound, rr.Code)
 			} else {
 
-				require.True(t, rr.Code == http.StatusOK || rr.Code == http.StatusInternalServerError || rr.Code == http.StatusNotFound)
+				require.True(t, rr.Code == http.StatusOK || rr.Code == http.StatusInternalServerError || rr.Code == http.StatusNotFound || rr.Code == http.StatusGone)
 
 				if rr.Code != http.StatusNotFound {
 					require.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
@@ -106,3 +119,61 @@ func TestGetHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestGetHandler_StoreBusy(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/busy", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, zap.NewNop()))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	require.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	var resp response.BaseResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	require.Equal(t, "server error", resp.Error)
+}
+
+// eventRecorder keeps messages instead of sending them
+type eventRecorder struct {
+	messages []any
+}
+
+func (e *eventRecorder) AddJsonMessage(m any) {
+	e.messages = append(e.messages, m)
+}
+
+func (e *eventRecorder) AddJsonMessages(ms ...any) {
+	e.messages = append(e.messages, ms...)
+}
+
+func TestGetHandler_AccessedEvent(t *testing.T) {
+	events := &eventRecorder{}
+	r := mux.NewRouter()
+	r.Handle("/{alias}", NewGetUrlHandler(store, events))
+
+	req := httptest.NewRequest(http.MethodGet, "/aaaa", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, zap.NewNop()))
+	req.RemoteAddr = "203.0.113.195:5123"
+	req.Header.Set("Referer", "https://news.example.org/post/1")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:126.0) Gecko/20100101 Firefox/126.0")
+	req.Header.Set("X-Request-ID", "req-1")
+	req.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusFound, rr.Code)
+
+	require.Len(t, events.messages, 1)
+	event, ok := events.messages[0].(urls.AccessedEvent)
+	require.True(t, ok)
+	require.Equal(t, "aaaa", event.Alias)
+	require.Equal(t, "https://www.example.com", event.URL)
+	require.Equal(t, "https://news.example.org/post/1", event.Referrer)
+	require.Contains(t, event.UserAgent, "Firefox/126.0")
+	// client ip is not sent as is
+	require.Equal(t, "203.0.113.0", event.IP)
+	require.Equal(t, "req-1", event.RequestId)
+	require.Equal(t, "de-DE,de;q=0.9", event.AcceptLanguage)
+}
@@ -0,0 +1,58 @@
+package remove
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/sajoniks/GoShort/internal/api/v1/event/urls"
+	"github.com/sajoniks/GoShort/internal/api/v1/response"
+	"github.com/sajoniks/GoShort/internal/http-server/helper"
+	"github.com/sajoniks/GoShort/internal/http-server/middleware"
+	"github.com/sajoniks/GoShort/internal/mq"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+func NewDeleteUrlHandler(store urlstore.Store, kafka mq.KafkaWriterWorkerInterface) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := middleware.GetLogging(r.Context())
+		vars := mux.Vars(r)
+		alias := vars["alias"]
+
+		if alias == "" {
+			log.Error("empty alias")
+			_ = helper.WriteProblemJson(w, response.ErrorMsg("empty alias"))
+			return
+		}
+
+		log = log.With(zap.String("alias", alias))
+
+		var resp response.BaseResponse
+		err := store.DeleteURL(alias, middleware.GetPrincipal(r.Context()))
+		if err != nil {
+			log.Error("delete url error", zap.Error(trace.WrapError(err)))
+			if errors.Is(err, urlstore.ErrNotOwner) {
+				resp = response.ErrorMsg("url belongs to another owner")
+				_ = helper.WriteProblemJsonStatus(w, http.StatusForbidden, &resp)
+				return
+			}
+
+			if errors.Is(err, urlstore.ErrUrlNotFound) {
+				resp = response.ErrorMsg("requested url was not found")
+			} else {
+				helper.WriteStoreErrorStatus(w, err)
+				resp = response.ErrorMsg("server error")
+			}
+			_ = helper.WriteProblemJson(w, &resp)
+			return
+		}
+
+		kafka.AddJsonMessage(urls.NewDeletedEvent(alias))
+
+		log.Info("deleted url")
+
+		resp = response.Ok()
+		_ = helper.WriteJson(w, &resp)
+	})
+}
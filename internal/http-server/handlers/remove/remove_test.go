@@ -0,0 +1,101 @@
+package remove
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/sajoniks/GoShort/internal/api/v1/response"
+	"github.com/sajoniks/GoShort/internal/http-server/middleware"
+	"github.com/sajoniks/GoShort/internal/mq"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/store/memory"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+var store urlstore.Store
+var router *mux.Router
+
+func TestMain(m *testing.M) {
+	store = memory.NewMemoryStore()
+	for _, item := range []struct{ alias, url, owner string }{
+		{"aaaa", "https://www.example.com", "alice"},
+		{"bbbb", "https://www.example.org", "bob"},
+	} {
+		if _, err := store.SaveURL(item.url, item.alias, urlstore.WithOwner(item.owner)); err != nil {
+			log.Fatalf("failed to prepare store: %v", err)
+		}
+	}
+
+	router = mux.NewRouter()
+	router.Methods(http.MethodDelete).Path("/{alias}").Handler(NewDeleteUrlHandler(store, mq.NewWriterNoOp()))
+
+	os.Exit(m.Run())
+}
+
+func TestDeleteHandler(t *testing.T) {
+	tt := []struct {
+		name    string
+		alias   string
+		code    int
+		respErr string
+	}{
+		{
+			name:    "another owner",
+			alias:   "bbbb",
+			code:    http.StatusForbidden,
+			respErr: "url belongs to another owner",
+		},
+		{
+			name:  "success",
+			alias: "aaaa",
+			code:  http.StatusOK,
+		},
+		{
+			name:    "already deleted",
+			alias:   "aaaa",
+			code:    http.StatusOK,
+			respErr: "requested url was not found",
+		},
+		{
+			name:    "not found",
+			alias:   "cccc",
+			code:    http.StatusOK,
+			respErr: "requested url was not found",
+		},
+	}
+
+	logger := zap.NewNop()
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/"+tc.alias, nil)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, logger))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.PrincipalCtxKey, "alice"))
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			var resp response.BaseResponse
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+
+			require.Equal(t, tc.code, rr.Code)
+
+			if tc.respErr == "" {
+				require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+				require.Equal(t, true, resp.Ok)
+				_, err := store.GetURL(tc.alias)
+				require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+			} else {
+				require.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+				require.Equal(t, false, resp.Ok)
+				require.Equal(t, tc.respErr, resp.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package save
+
+import (
+	"errors"
+	"github.com/sajoniks/GoShort/internal/aliasgen"
+	"github.com/sajoniks/GoShort/internal/config"
+	"strings"
+)
+
+const (
+	defaultAliasMinLength = 3
+	defaultAliasMaxLength = 64
+	// maxAliasAttempts is the number of tries to get a free generated alias
+	maxAliasAttempts = 5
+)
+
+var (
+	ErrAliasTooShort   = errors.New("alias is too short")
+	ErrAliasTooLong    = errors.New("alias is too long")
+	ErrAliasCharset    = errors.New("alias contains invalid characters")
+	ErrAliasReserved   = errors.New("alias is reserved")
+	ErrAliasGeneration = errors.New("unable to generate alias")
+)
+
+// defaultReservedAliases are the words that clash with service routes
+var defaultReservedAliases = []string{
+	"admin",
+	"api",
+	"batch",
+	"health",
+	"metrics",
+	"set",
+	"stats",
+}
+
+// AliasPolicy validates user provided aliases.
+// Allowed characters are the same as in generated aliases: latin letters, digits, '-' and '_'
+type AliasPolicy struct {
+	minLength int
+	maxLength int
+	reserved  map[string]struct{}
+}
+
+// NewAliasPolicy creates AliasPolicy from the config.
+// Missing length limits are replaced with defaults, reserved words are appended to the default list
+func NewAliasPolicy(cfg *config.AliasConfig) *AliasPolicy {
+	p := &AliasPolicy{
+		minLength: cfg.MinLength,
+		maxLength: cfg.MaxLength,
+		reserved:  make(map[string]struct{}),
+	}
+	if p.minLength <= 0 {
+		p.minLength = defaultAliasMinLength
+	}
+	if p.maxLength <= 0 {
+		p.maxLength = defaultAliasMaxLength
+	}
+	for _, w := range defaultReservedAliases {
+		p.reserved[w] = struct{}{}
+	}
+	for _, w := range cfg.Reserved {
+		p.reserved[strings.ToLower(strings.TrimSpace(w))] = struct{}{}
+	}
+	return p
+}
+
+func isAliasChar(c rune) bool {
+	return (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9') ||
+		c == '-' || c == '_'
+}
+
+// Validate checks alias against the policy
+func (p *AliasPolicy) Validate(alias string) error {
+	if len(alias) < p.minLength {
+		return ErrAliasTooShort
+	}
+	if len(alias) > p.maxLength {
+		return ErrAliasTooLong
+	}
+	for _, c := range alias {
+		if !isAliasChar(c) {
+			return ErrAliasCharset
+		}
+	}
+	if p.IsReserved(alias) {
+		return ErrAliasReserved
+	}
+	return nil
+}
+
+// IsReserved reports whether alias is one of the reserved words
+func (p *AliasPolicy) IsReserved(alias string) bool {
+	_, ok := p.reserved[strings.ToLower(alias)]
+	return ok
+}
+
+// generateAlias creates alias for src that is not reserved by the policy
+func generateAlias(generator aliasgen.Generator, policy *AliasPolicy, src string) (string, error) {
+	for i := 0; i < maxAliasAttempts; i++ {
+		alias, err := generator.Generate(src)
+		if err != nil {
+			return "", err
+		}
+		if !policy.IsReserved(alias) {
+			return alias, nil
+		}
+	}
+	return "", ErrAliasGeneration
+}
@@ -0,0 +1,336 @@
+package save
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/sajoniks/GoShort/internal/aliasgen"
+	"github.com/sajoniks/GoShort/internal/api/v1/event/urls"
+	resp "github.com/sajoniks/GoShort/internal/api/v1/response"
+	"github.com/sajoniks/GoShort/internal/http-server/helper"
+	"github.com/sajoniks/GoShort/internal/http-server/middleware"
+	"github.com/sajoniks/GoShort/internal/mq"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"github.com/sajoniks/GoShort/internal/validate"
+	"go.uber.org/zap"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+)
+
+const defaultBatchMaxItems = 1000
+
+var (
+	ErrBatchEmpty    = errors.New("batch is empty")
+	ErrBatchTooLarge = errors.New("batch is too large")
+	ErrBatchNotArray = errors.New("batch must be a json array")
+)
+
+type BatchItem struct {
+	URL   string `json:"url"`
+	Alias string `json:"alias,omitempty"`
+	// ExpiresIn is the link lifetime in seconds
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+	// ExpiresAt is the absolute link expiry time in RFC 3339 format
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type BatchItemResult struct {
+	resp.BaseResponse
+	// URL is the url of the request item
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Existing is set if alias of already shortened url is returned
+	Existing bool `json:"existing,omitempty"`
+}
+
+type ResponseBatch struct {
+	resp.BaseResponse
+	// Results are in the same order as request items
+	Results []BatchItemResult `json:"results,omitempty"`
+}
+
+// isNdjson reports whether request body is a stream of newline delimited json objects
+func isNdjson(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-ndjson" || mediaType == "application/jsonl"
+}
+
+// decodeBatch reads items from json array or NDJSON stream.
+// Reading stops with ErrBatchTooLarge as soon as maxItems is exceeded
+func decodeBatch(body io.Reader, ndjson bool, maxItems int) ([]BatchItem, error) {
+	dec := json.NewDecoder(body)
+	if !ndjson {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if d, ok := tok.(json.Delim); !ok || d != '[' {
+			return nil, ErrBatchNotArray
+		}
+	}
+
+	var items []BatchItem
+	for ndjson || dec.More() {
+		var item BatchItem
+		if err := dec.Decode(&item); err != nil {
+			if ndjson && errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if len(items) == maxItems {
+			return nil, ErrBatchTooLarge
+		}
+		items = append(items, item)
+	}
+
+	if !ndjson {
+		// closing bracket
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// saveErrorResponse creates item response for the error returned by the store
+func saveErrorResponse(err error, customAlias bool) resp.BaseResponse {
+	switch {
+	case customAlias && errors.Is(err, urlstore.ErrAliasExists):
+		return resp.ErrorMsg("alias is already taken")
+	case errors.Is(err, urlstore.ErrUrlExists) || errors.Is(err, urlstore.ErrAliasExists):
+		return resp.ErrorMsg("url with alias is already added")
+	case errors.Is(err, urlstore.ErrUrlEmpty):
+		return resp.ErrorMsg("url is empty")
+	default:
+		return resp.ErrorMsg("server error")
+	}
+}
+
+// NewBatchSaveUrlHandler creates handler that shortens multiple urls at once.
+// Items are validated the same way as in NewSaveUrlHandler and saved with a single store call,
+// only items with already taken generated aliases are saved again.
+// Every item gets its own result, so a failed item does not fail the whole batch
+func NewBatchSaveUrlHandler(
+	baseHost string,
+	store urlstore.Store,
+	kafka mq.KafkaWriterWorkerInterface,
+	aliasPolicy *AliasPolicy,
+	expiryPolicy *ExpiryPolicy,
+	aliasGenerator aliasgen.Generator,
+	validator *validate.Validator,
+	dedupe bool,
+	maxItems int,
+) http.HandlerFunc {
+	if maxItems <= 0 {
+		maxItems = defaultBatchMaxItems
+	}
+
+	f := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := middleware.GetLogging(r.Context())
+
+		items, err := decodeBatch(r.Body, isNdjson(r), maxItems)
+		if err != nil {
+			log.Error("error on decode batch", zap.Error(trace.WrapError(err)))
+
+			if errors.Is(err, ErrBatchTooLarge) {
+				_ = helper.WriteProblemJsonStatus(w, http.StatusRequestEntityTooLarge, &ResponseBatch{
+					BaseResponse: resp.Error(err),
+				})
+			} else if errors.Is(err, io.EOF) {
+				_ = helper.WriteProblemJson(w, &ResponseBatch{
+					BaseResponse: resp.ErrorMsg("empty request body"),
+				})
+			} else if errors.Is(err, ErrBatchNotArray) {
+				_ = helper.WriteProblemJson(w, &ResponseBatch{
+					BaseResponse: resp.Error(err),
+				})
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				_ = helper.WriteProblemJson(w, &ResponseBatch{
+					BaseResponse: resp.ErrorMsg("error decoding request content"),
+				})
+			}
+			return
+		}
+		if len(items) == 0 {
+			_ = helper.WriteProblemJson(w, &ResponseBatch{
+				BaseResponse: resp.Error(ErrBatchEmpty),
+			})
+			return
+		}
+
+		log = log.With(zap.Int("batch_size", len(items)))
+		owner := middleware.GetPrincipal(r.Context())
+
+		now := time.Now()
+		results := make([]BatchItemResult, len(items))
+		pending := make([]urlstore.BatchItem, 0, len(items))
+		pendingIdx := make([]int, 0, len(items))
+
+		// with deduplication, repeated urls in the batch get the alias of their first occurrence
+		firstIdx := make(map[string]int)
+		duplicateOf := make(map[int]int)
+
+		for i, item := range items {
+			res := &results[i]
+			res.URL = item.URL
+
+			if item.URL == "" {
+				res.BaseResponse = resp.ErrorMsg("invalid url")
+				continue
+			}
+
+			destination, err := validator.Validate(item.URL)
+			if err != nil {
+				res.BaseResponse = helper.ValidationErrorResponse(err)
+				continue
+			}
+			src := destination.String()
+
+			expiresAt, err := expiryPolicy.ExpiryTime(item.ExpiresIn, item.ExpiresAt, now)
+			if err != nil {
+				res.BaseResponse = resp.Error(err)
+				continue
+			}
+
+			var alias string
+			if item.Alias != "" {
+				if err := aliasPolicy.Validate(item.Alias); err != nil {
+					res.BaseResponse = resp.Error(err)
+					continue
+				}
+				alias = item.Alias
+			} else {
+				// only links without expiry are deduplicated, like in NewSaveUrlHandler
+				if dedupe && expiresAt.IsZero() {
+					if j, ok := firstIdx[src]; ok {
+						duplicateOf[i] = j
+						continue
+					}
+					existing, err := store.FindAlias(src, owner)
+					if err == nil {
+						res.BaseResponse = resp.Ok()
+						res.Alias = path.Join(baseHost, existing)
+						res.Existing = true
+						continue
+					}
+					if !errors.Is(err, urlstore.ErrUrlNotFound) {
+						log.Error("find alias error", zap.Error(trace.WrapError(err)))
+
+						helper.WriteStoreErrorStatus(w, err)
+						_ = helper.WriteProblemJson(w, &ResponseBatch{
+							BaseResponse: resp.ErrorMsg("server error"),
+						})
+						return
+					}
+					firstIdx[src] = i
+				}
+				alias, err = generateAlias(aliasGenerator, aliasPolicy, src)
+				if err != nil {
+					log.Error("generate alias error", zap.Error(trace.WrapError(err)))
+					res.BaseResponse = resp.ErrorMsg("server error")
+					continue
+				}
+			}
+
+			opts := []urlstore.SaveOption{urlstore.WithOwner(owner)}
+			if !expiresAt.IsZero() {
+				opts = append(opts, urlstore.WithExpiry(expiresAt))
+			}
+			pending = append(pending, urlstore.BatchItem{
+				Source:  src,
+				Alias:   alias,
+				Options: urlstore.NewSaveOptions(opts...),
+			})
+			pendingIdx = append(pendingIdx, i)
+		}
+
+		// items with taken generated aliases are saved again with new aliases
+		saved := make([]urlstore.BatchResult, len(pending))
+		retry := make([]int, len(pending))
+		for k := range pending {
+			retry[k] = k
+		}
+		var sentWithUrls bool
+		for attempt := 1; len(retry) > 0; attempt++ {
+			batch := make([]urlstore.BatchItem, len(retry))
+			for n, k := range retry {
+				batch[n] = pending[k]
+				// events are written together with the urls if the writer uses the store outbox
+				var eventOpt urlstore.SaveOption
+				eventOpt, sentWithUrls = mq.WithJsonMessages(kafka, urls.NewAddedEvent(pending[k].Source, pending[k].Alias))
+				eventOpt(&batch[n].Options)
+			}
+			batchSaved, err := store.SaveURLs(batch)
+			if err != nil {
+				log.Error("save urls error", zap.Error(trace.WrapError(err)))
+
+				helper.WriteStoreErrorStatus(w, err)
+				_ = helper.WriteProblemJson(w, &ResponseBatch{
+					BaseResponse: resp.ErrorMsg("server error"),
+				})
+				return
+			}
+
+			var next []int
+			for n, k := range retry {
+				saved[k] = batchSaved[n]
+				if items[pendingIdx[k]].Alias != "" || attempt == maxAliasAttempts || !errors.Is(batchSaved[n].Err, urlstore.ErrAliasExists) {
+					continue
+				}
+				alias, err := generateAlias(aliasGenerator, aliasPolicy, pending[k].Source)
+				if err != nil {
+					log.Error("generate alias error", zap.Error(trace.WrapError(err)))
+					continue
+				}
+				log.Warn("generated alias is taken, retrying", zap.String("alias", pending[k].Alias), zap.Int("attempt", attempt))
+				pending[k].Alias = alias
+				next = append(next, k)
+			}
+			retry = next
+		}
+
+		events := make([]any, 0, len(pending))
+		for k, s := range saved {
+			i := pendingIdx[k]
+			if s.Err != nil {
+				log.Error("save url error",
+					zap.String("alias", pending[k].Alias),
+					zap.Error(trace.WrapError(s.Err)),
+				)
+				results[i].BaseResponse = saveErrorResponse(s.Err, items[i].Alias != "")
+				continue
+			}
+			results[i].BaseResponse = resp.Ok()
+			results[i].Alias = path.Join(baseHost, pending[k].Alias)
+			if expiresAt := pending[k].Options.ExpiresAt; !expiresAt.IsZero() {
+				results[i].ExpiresAt = &expiresAt
+			}
+			events = append(events, urls.NewAddedEvent(pending[k].Source, pending[k].Alias))
+		}
+
+		for i, j := range duplicateOf {
+			results[i].BaseResponse = results[j].BaseResponse
+			results[i].Alias = results[j].Alias
+			results[i].Existing = results[j].Ok
+		}
+
+		log.Info("added batch of aliases", zap.Int("added", len(events)))
+
+		if !sentWithUrls {
+			kafka.AddJsonMessages(events...)
+		}
+
+		_ = helper.WriteJson(w, &ResponseBatch{
+			BaseResponse: resp.Ok(),
+			Results:      results,
+		})
+	})
+
+	return f
+}
@@ -0,0 +1,259 @@
+package save
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sajoniks/GoShort/internal/aliasgen"
+	"github.com/sajoniks/GoShort/internal/api/v1/event/urls"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/sajoniks/GoShort/internal/http-server/middleware"
+	"github.com/sajoniks/GoShort/internal/mq"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/store/memory"
+	"github.com/sajoniks/GoShort/internal/validate"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveBatch(t *testing.T, handler http.Handler, contentType, body string) (*httptest.ResponseRecorder, ResponseBatch) {
+	req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, zap.NewNop()))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.PrincipalCtxKey, "batcher"))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var resp ResponseBatch
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	return rr, resp
+}
+
+func TestBatchSaveHandler(t *testing.T) {
+	handler := NewBatchSaveUrlHandler("", store, mq.NewWriterNoOp(), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, false, 10)
+
+	rr, resp := serveBatch(t, handler, "application/json", `[
+		{"url": "https://batch.example.com/1"},
+		{"url": "https://batch.example.com/2", "alias": "batch-two"},
+		{"url": "www.example.com"},
+		{"url": "http://10.0.0.1/"},
+		{"url": "https://batch.example.com/5", "alias": "aaaa"},
+		{"url": "https://batch.example.com/6", "alias": "api"}
+	]`)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.True(t, resp.Ok)
+	require.Len(t, resp.Results, 6)
+
+	require.True(t, resp.Results[0].Ok)
+	require.NotEmpty(t, resp.Results[0].Alias)
+	require.Equal(t, "https://batch.example.com/1", resp.Results[0].URL)
+
+	require.True(t, resp.Results[1].Ok)
+	require.Equal(t, "batch-two", resp.Results[1].Alias)
+
+	require.False(t, resp.Results[2].Ok)
+	require.Equal(t, validate.ErrInvalidUrl.Code, resp.Results[2].Code)
+
+	require.False(t, resp.Results[3].Ok)
+	require.Equal(t, validate.ErrPrivateAddress.Code, resp.Results[3].Code)
+
+	require.False(t, resp.Results[4].Ok)
+	require.Equal(t, "alias is already taken", resp.Results[4].Error)
+
+	require.False(t, resp.Results[5].Ok)
+	require.Equal(t, ErrAliasReserved.Error(), resp.Results[5].Error)
+
+	require.Equal(t, "https://batch.example.com/2", mustGetURL(t, "batch-two"))
+}
+
+func TestBatchSaveHandler_Ndjson(t *testing.T) {
+	handler := NewBatchSaveUrlHandler("", store, mq.NewWriterNoOp(), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, false, 10)
+
+	rr, resp := serveBatch(t, handler, "application/x-ndjson",
+		"{\"url\": \"https://ndjson.example.com/1\"}\n\n{\"url\": \"https://ndjson.example.com/2\", \"alias\": \"ndjson-two\"}\n")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Len(t, resp.Results, 2)
+	require.True(t, resp.Results[0].Ok)
+	require.True(t, resp.Results[1].Ok)
+	require.Equal(t, "ndjson-two", resp.Results[1].Alias)
+}
+
+func TestBatchSaveHandler_Dedupe(t *testing.T) {
+	handler := NewBatchSaveUrlHandler("", store, mq.NewWriterNoOp(), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, true, 10)
+
+	_, resp := serveBatch(t, handler, "application/json", `[
+		{"url": "https://dedupe.example.com/batch"},
+		{"url": "https://DEDUPE.example.com/batch"}
+	]`)
+	require.Len(t, resp.Results, 2)
+	require.True(t, resp.Results[0].Ok)
+	require.False(t, resp.Results[0].Existing)
+	require.True(t, resp.Results[1].Ok)
+	require.True(t, resp.Results[1].Existing)
+	require.Equal(t, resp.Results[0].Alias, resp.Results[1].Alias)
+
+	// saved by previous batch
+	_, resp = serveBatch(t, handler, "application/json", `[{"url": "https://dedupe.example.com/batch"}]`)
+	require.Len(t, resp.Results, 1)
+	require.True(t, resp.Results[0].Existing)
+}
+
+func TestBatchSaveHandler_Expiry(t *testing.T) {
+	maxSeconds := int64(defaultMaxTTL / time.Second)
+	tt := []struct {
+		name    string
+		item    string
+		respErr string
+	}{
+		{
+			name: "expires in",
+			item: `{"url": "https://expiry.example.com/a", "expires_in": 60}`,
+		},
+		{
+			name: "expires in the maximum",
+			item: fmt.Sprintf(`{"url": "https://expiry.example.com/b", "expires_in": %d}`, maxSeconds),
+		},
+		{
+			name:    "expires in over the maximum",
+			item:    fmt.Sprintf(`{"url": "https://expiry.example.com/c", "expires_in": %d}`, maxSeconds+1),
+			respErr: ErrExpiryTooFar.Error(),
+		},
+		{
+			name:    "expires in overflows duration",
+			item:    fmt.Sprintf(`{"url": "https://expiry.example.com/d", "expires_in": %d}`, int64(math.MaxInt64/time.Second)+1),
+			respErr: ErrExpiryTooFar.Error(),
+		},
+		{
+			name:    "expires at over the maximum",
+			item:    `{"url": "https://expiry.example.com/e", "expires_at": "9999-01-01T00:00:00Z"}`,
+			respErr: ErrExpiryTooFar.Error(),
+		},
+		{
+			name:    "negative expires in",
+			item:    `{"url": "https://expiry.example.com/f", "expires_in": -1}`,
+			respErr: ErrExpiryInvalid.Error(),
+		},
+	}
+
+	handler := NewBatchSaveUrlHandler("", store, mq.NewWriterNoOp(), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, true, 10)
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rr, resp := serveBatch(t, handler, "application/json", "["+tc.item+"]")
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Len(t, resp.Results, 1)
+
+			res := resp.Results[0]
+			if tc.respErr == "" {
+				require.True(t, res.Ok)
+				require.NotNil(t, res.ExpiresAt)
+				require.True(t, res.ExpiresAt.After(time.Now()))
+			} else {
+				require.False(t, res.Ok)
+				require.Equal(t, tc.respErr, res.Error)
+			}
+		})
+	}
+}
+
+func TestBatchSaveHandler_Invalid(t *testing.T) {
+	tt := []struct {
+		name        string
+		contentType string
+		body        string
+		code        int
+		respErr     string
+	}{
+		{
+			name:        "too large",
+			contentType: "application/json",
+			body:        `[{"url": "https://a.com"}, {"url": "https://b.com"}, {"url": "https://c.com"}]`,
+			code:        http.StatusRequestEntityTooLarge,
+			respErr:     ErrBatchTooLarge.Error(),
+		},
+		{
+			name:        "empty array",
+			contentType: "application/json",
+			body:        `[]`,
+			code:        http.StatusOK,
+			respErr:     ErrBatchEmpty.Error(),
+		},
+		{
+			name:        "empty stream",
+			contentType: "application/x-ndjson",
+			body:        "",
+			code:        http.StatusOK,
+			respErr:     ErrBatchEmpty.Error(),
+		},
+		{
+			name:        "empty body",
+			contentType: "application/json",
+			body:        "",
+			code:        http.StatusOK,
+			respErr:     "empty request body",
+		},
+		{
+			name:        "not an array",
+			contentType: "application/json",
+			body:        `{"url": "https://a.com"}`,
+			code:        http.StatusOK,
+			respErr:     ErrBatchNotArray.Error(),
+		},
+	}
+
+	handler := NewBatchSaveUrlHandler("", store, mq.NewWriterNoOp(), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, false, 2)
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rr, resp := serveBatch(t, handler, tc.contentType, tc.body)
+
+			require.Equal(t, tc.code, rr.Code)
+			require.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+			require.False(t, resp.Ok)
+			require.Equal(t, tc.respErr, resp.Error)
+		})
+	}
+}
+
+func TestBatchSaveHandler_GeneratedAliasRetry(t *testing.T) {
+	generator := &sequenceGenerator{aliases: []string{"batch-gen", "batch-gen", "batch-gen-2"}}
+	handler := NewBatchSaveUrlHandler("", store, mq.NewWriterNoOp(), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), generator, validator, false, 10)
+
+	_, resp := serveBatch(t, handler, "application/json", `[
+		{"url": "https://retry.example.com/1"},
+		{"url": "https://retry.example.com/2"}
+	]`)
+	require.Len(t, resp.Results, 2)
+	require.True(t, resp.Results[0].Ok)
+	require.Equal(t, "batch-gen", resp.Results[0].Alias)
+	require.True(t, resp.Results[1].Ok)
+	require.Equal(t, "batch-gen-2", resp.Results[1].Alias)
+}
+
+func TestBatchSaveHandler_Outbox(t *testing.T) {
+	outboxStore := memory.NewMemoryStore()
+	outbox := outboxStore.(urlstore.Outbox)
+	registry := newTestRegistry()
+	handler := NewBatchSaveUrlHandler("", outboxStore, mq.NewOutboxWriter(outbox, mq.NewJsonEncoder(registry), mq.EventKey, zap.NewNop()), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, false, 10)
+
+	_, resp := serveBatch(t, handler, "application/json", `[
+		{"url": "https://outbox.example.com/1", "alias": "outbox-one"},
+		{"url": "https://outbox.example.com/2", "alias": "outbox-one"},
+		{"url": "https://outbox.example.com/3", "alias": "outbox-three"}
+	]`)
+	require.True(t, resp.Ok)
+
+	pending, err := outbox.PendingMessages(10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	requireEvent(t, registry, pending[0].Payload, urls.NewAddedEvent("https://outbox.example.com/1", "outbox-one"))
+	requireEvent(t, registry, pending[1].Payload, urls.NewAddedEvent("https://outbox.example.com/3", "outbox-three"))
+}
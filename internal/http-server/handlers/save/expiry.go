@@ -0,0 +1,58 @@
+package save
+
+import (
+	"errors"
+	"github.com/sajoniks/GoShort/internal/config"
+	"time"
+)
+
+// defaultMaxTTL is the longest link lifetime when it is not configured
+const defaultMaxTTL = time.Hour * 24 * 365 * 10
+
+var (
+	ErrExpiryAmbiguous = errors.New("only one of expires_in and expires_at can be set")
+	ErrExpiryInvalid   = errors.New("expiry must be in the future")
+	ErrExpiryTooFar    = errors.New("expiry is too far in the future")
+)
+
+// ExpiryPolicy validates link lifetimes requested by clients
+type ExpiryPolicy struct {
+	maxTTL time.Duration
+}
+
+// NewExpiryPolicy creates ExpiryPolicy from the config. Missing maximum lifetime is replaced with default
+func NewExpiryPolicy(cfg *config.ExpiryConfig) *ExpiryPolicy {
+	p := &ExpiryPolicy{maxTTL: cfg.MaxTTL}
+	if p.maxTTL <= 0 {
+		p.maxTTL = defaultMaxTTL
+	}
+	return p
+}
+
+// ExpiryTime returns absolute expiry time of the link with lifetime expiresIn in seconds, or expiring at expiresAt.
+// Zero time is returned if link never expires. Links must not live longer than the maximum lifetime
+func (p *ExpiryPolicy) ExpiryTime(expiresIn int64, expiresAt *time.Time, now time.Time) (time.Time, error) {
+	if expiresIn != 0 && expiresAt != nil {
+		return time.Time{}, ErrExpiryAmbiguous
+	}
+	if expiresIn != 0 {
+		if expiresIn < 0 {
+			return time.Time{}, ErrExpiryInvalid
+		}
+		// seconds are checked before the conversion, so large values do not overflow the duration
+		if expiresIn > int64(p.maxTTL/time.Second) {
+			return time.Time{}, ErrExpiryTooFar
+		}
+		return now.Add(time.Duration(expiresIn) * time.Second).UTC(), nil
+	}
+	if expiresAt != nil {
+		if !expiresAt.After(now) {
+			return time.Time{}, ErrExpiryInvalid
+		}
+		if expiresAt.Sub(now) > p.maxTTL {
+			return time.Time{}, ErrExpiryTooFar
+		}
+		return expiresAt.UTC(), nil
+	}
+	return time.Time{}, nil
+}
@@ -1,12 +1,8 @@
 package save
 
 import (
-	"bytes"
-	"crypto/rand"
-	"crypto/sha512"
-	"encoding/base64"
 	"errors"
-	"fmt"
+	"github.com/sajoniks/GoShort/internal/aliasgen"
 	"github.com/sajoniks/GoShort/internal/api/v1/event/urls"
 	resp "github.com/sajoniks/GoShort/internal/api/v1/response"
 	"github.com/sajoniks/GoShort/internal/http-server/helper"
@@ -14,65 +10,43 @@ import (
 	"github.com/sajoniks/GoShort/internal/mq"
 	"github.com/sajoniks/GoShort/internal/store/interface"
 	"github.com/sajoniks/GoShort/internal/trace"
+	"github.com/sajoniks/GoShort/internal/validate"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
 	"path"
-	"regexp"
-	"sync"
 	"time"
 )
 
-// vars related to alias generation
-var (
-	aliasMutex         sync.Mutex
-	aliasSha512        = sha512.New()
-	aliasBuf           bytes.Buffer
-	aliasBase64Encoder = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_").WithPadding(base64.NoPadding)
-)
-
-func generateAlias(url string) string {
-	rnd := make([]byte, 8)
-	if _, err := rand.Read(rnd); err != nil {
-		return ""
-	}
-
-	aliasMutex.Lock()
-	defer aliasMutex.Unlock()
-
-	// url|timestamp|random bytes [8]
-	// https://example.com|1234567890|jq2ef-=k
-	fmt.Fprintf(&aliasBuf, "%s|%d|%s", url, time.Now().UTC().UnixNano(), rnd)
-
-	_, err := aliasSha512.Write(aliasBuf.Bytes())
-	aliasBuf.Reset()
-
-	if err != nil {
-		return ""
-	}
-	hsh := aliasSha512.Sum(nil)[:8]
-	aliasSha512.Reset()
-
-	return aliasBase64Encoder.EncodeToString(hsh)
-}
-
 type RequestSave struct {
-	URL string `json:"url"`
+	URL   string `json:"url"`
+	Alias string `json:"alias,omitempty"`
+	// ExpiresIn is the link lifetime in seconds
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+	// ExpiresAt is the absolute link expiry time in RFC 3339 format
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Dedupe overrides the configured deduplication mode
+	Dedupe *bool `json:"dedupe,omitempty"`
 }
 
 type ResponseSave struct {
 	resp.BaseResponse
-	Alias string `json:"alias,omitempty"`
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Existing is set if alias of already shortened url is returned
+	Existing bool `json:"existing,omitempty"`
 }
 
 func NewSaveUrlHandler(
 	baseHost string,
 	store urlstore.Store,
 	kafka mq.KafkaWriterWorkerInterface,
+	aliasPolicy *AliasPolicy,
+	expiryPolicy *ExpiryPolicy,
+	aliasGenerator aliasgen.Generator,
+	validator *validate.Validator,
+	dedupe bool,
 ) http.HandlerFunc {
-	urlRegex :=
-		regexp.MustCompile("^(http:\\/\\/www\\.|https:\\/\\/www\\.|http:\\/\\/|https:\\/\\/|\\/|\\/\\/){1}[A-z0-9_-]*?[:]?[A-z0-9_-]*?[@]?[A-z0-9]+([\\-\\.]{1}[a-z0-9]+)*\\.[a-z]{2,5}(:[0-9]{1,5})?(\\/.*)?$")
-
 	f := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log := middleware.GetLogging(r.Context())
 
@@ -107,27 +81,117 @@ func NewSaveUrlHandler(
 			return
 		}
 
-		if !urlRegex.MatchString(reqBody.URL) {
-			reqResp.BaseResponse = resp.ErrorMsg("invalid url")
-			log.Error("validation error", zap.String("error", reqResp.Error))
+		destination, err := validator.Validate(reqBody.URL)
+		if err != nil {
+			reqResp.BaseResponse = helper.ValidationErrorResponse(err)
+			log.Error("validation error", zap.String("error", reqResp.Error), zap.String("code", reqResp.Code))
 
 			_ = helper.WriteProblemJson(w, &reqResp)
 			return
 		}
 
-		alias := generateAlias(reqBody.URL)
+		// store the normalized form of the url
+		reqBody.URL = destination.String()
+
+		expiresAt, err := expiryPolicy.ExpiryTime(reqBody.ExpiresIn, reqBody.ExpiresAt, time.Now())
+		if err != nil {
+			reqResp.BaseResponse = resp.Error(err)
+			log.Error("validation error", zap.String("error", reqResp.Error))
+
+			_ = helper.WriteProblemJsonStatus(w, http.StatusBadRequest, &reqResp)
+			return
+		}
+
+		customAlias := reqBody.Alias != ""
+		owner := middleware.GetPrincipal(r.Context())
+
+		// only links with generated aliases and without expiry are deduplicated.
+		// Deduplication is best-effort: concurrent requests may both miss the existing alias and create two links
+		dedupeRequest := dedupe
+		if reqBody.Dedupe != nil {
+			dedupeRequest = *reqBody.Dedupe
+		}
+		if dedupeRequest && !customAlias && expiresAt.IsZero() {
+			existing, err := store.FindAlias(reqBody.URL, owner)
+			if err == nil {
+				log.Info("found existing alias", zap.String("alias", existing))
+
+				reqResp.BaseResponse = resp.Ok()
+				reqResp.Alias = path.Join(baseHost, existing)
+				reqResp.Existing = true
+				_ = helper.WriteJson(w, &reqResp)
+				return
+			}
+			if !errors.Is(err, urlstore.ErrUrlNotFound) {
+				log.Error("find alias error", zap.Error(trace.WrapError(err)))
+
+				helper.WriteStoreErrorStatus(w, err)
+				reqResp.BaseResponse = resp.ErrorMsg("server error")
+				_ = helper.WriteProblemJson(w, &reqResp)
+				return
+			}
+		}
+
+		if customAlias {
+			if err := aliasPolicy.Validate(reqBody.Alias); err != nil {
+				reqResp.BaseResponse = resp.Error(err)
+				log.Error("validation error", zap.String("alias", reqBody.Alias), zap.String("error", reqResp.Error))
+
+				_ = helper.WriteProblemJson(w, &reqResp)
+				return
+			}
+		}
+
+		saveOpts := []urlstore.SaveOption{urlstore.WithOwner(owner)}
+		if !expiresAt.IsZero() {
+			saveOpts = append(saveOpts, urlstore.WithExpiry(expiresAt))
+			reqResp.ExpiresAt = &expiresAt
+		}
+
+		var alias, id string
+		var sentWithUrl bool
+		// generated alias is retried with a new one when it is already taken
+		for attempt := 1; ; attempt++ {
+			if customAlias {
+				alias = reqBody.Alias
+			} else {
+				alias, err = generateAlias(aliasGenerator, aliasPolicy, reqBody.URL)
+				if err != nil {
+					log.Error("generate alias error", zap.Error(trace.WrapError(err)))
+
+					w.WriteHeader(http.StatusInternalServerError)
+					reqResp.BaseResponse = resp.ErrorMsg("server error")
+					_ = helper.WriteProblemJson(w, &reqResp)
+					return
+				}
+			}
+
+			// event is written together with the url if the writer uses the store outbox
+			var eventOpt urlstore.SaveOption
+			eventOpt, sentWithUrl = mq.WithJsonMessages(kafka, urls.NewAddedEvent(reqBody.URL, alias))
+			id, err = store.SaveURL(reqBody.URL, alias, append(saveOpts, eventOpt)...)
+			if customAlias || attempt == maxAliasAttempts || !errors.Is(err, urlstore.ErrAliasExists) {
+				break
+			}
+			log.Warn("generated alias is taken, retrying", zap.String("alias", alias), zap.Int("attempt", attempt))
+		}
 
 		log = log.With(zap.String("alias", alias))
 
-		id, err := store.SaveURL(reqBody.URL, alias)
 		if err != nil {
 			log.Error("save url error", zap.Error(trace.WrapError(err)))
-			if errors.Is(err, urlstore.ErrUrlExists) {
+			if customAlias && errors.Is(err, urlstore.ErrAliasExists) {
+				reqResp.BaseResponse = resp.ErrorMsg("alias is already taken")
+				_ = helper.WriteProblemJsonStatus(w, http.StatusConflict, &reqResp)
+				return
+			}
+
+			if errors.Is(err, urlstore.ErrUrlExists) || errors.Is(err, urlstore.ErrAliasExists) {
 				reqResp.BaseResponse = resp.ErrorMsg("url with alias is already added")
 			} else if errors.Is(err, urlstore.ErrUrlEmpty) {
 				reqResp.BaseResponse = resp.ErrorMsg("url is empty")
 			} else {
-				w.WriteHeader(http.StatusInternalServerError)
+				helper.WriteStoreErrorStatus(w, err)
 				reqResp.BaseResponse = resp.ErrorMsg("server error")
 			}
 
@@ -141,7 +205,9 @@ func NewSaveUrlHandler(
 			zap.String("id", id),
 		)
 
-		kafka.AddJsonMessage(urls.NewAddedEvent(reqBody.URL, reqResp.Alias))
+		if !sentWithUrl {
+			kafka.AddJsonMessage(urls.NewAddedEvent(reqBody.URL, alias))
+		}
 
 		reqResp.BaseResponse = resp.Ok()
 		reqResp.Alias = path.Join(baseHost, alias)
@@ -5,52 +5,46 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/sajoniks/GoShort/internal/aliasgen"
+	"github.com/sajoniks/GoShort/internal/api/v1/event"
+	"github.com/sajoniks/GoShort/internal/api/v1/event/urls"
+	"github.com/sajoniks/GoShort/internal/config"
 	"github.com/sajoniks/GoShort/internal/http-server/middleware"
 	"github.com/sajoniks/GoShort/internal/mq"
 	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/store/memory"
+	"github.com/sajoniks/GoShort/internal/validate"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"log"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 var store urlstore.Store
+var validator *validate.Validator
 
-type mockSaveStore struct {
-	items map[string]string
-}
-
-func (m *mockSaveStore) SaveURL(src, alias string) (string, error) {
-	if strings.TrimSpace(src) == "" {
-		return "", urlstore.ErrUrlEmpty
-	}
-	if strings.TrimSpace(alias) == "" {
-		return "", urlstore.ErrAliasEmpty
-	}
-	if _, ok := m.items[alias]; ok {
-		return "", urlstore.ErrUrlExists
-	}
-	for _, v := range m.items {
-		if v == src {
-			return "", urlstore.ErrUrlExists
-		}
+func TestMain(m *testing.M) {
+	store = memory.NewMemoryStore()
+	if _, err := store.SaveURL("https://www.foo.bar", "aaaa"); err != nil {
+		log.Fatalf("failed to prepare store: %v", err)
 	}
-	m.items[alias] = src
-	return "1", nil
-}
-
-func (m *mockSaveStore) GetURL(alias string) (string, error) {
-	panic("not supported")
+	validator = validate.New(
+		validate.SelfReference("short.example.com:8080"),
+		validate.PrivateAddress(),
+	)
+	os.Exit(m.Run())
 }
 
-func TestMain(m *testing.M) {
-	store = &mockSaveStore{items: map[string]string{
-		"aaaa": "https://www.foo.bar",
-	}}
-	os.Exit(m.Run())
+func mustGetURL(t *testing.T, alias string) string {
+	src, err := store.GetURL(alias)
+	require.NoError(t, err)
+	return src
 }
 
 func TestSaveHandler(t *testing.T) {
@@ -68,9 +62,25 @@ func TestSaveHandler(t *testing.T) {
 			url:  "http://www.example.com",
 		},
 		{
-			name:    "duplicate entry",
-			url:     "https://www.foo.bar",
-			respErr: "url with alias is already added",
+			name: "success for long tld",
+			url:  "https://british.museum",
+		},
+		{
+			name: "success for idn",
+			url:  "https://bücher.de",
+		},
+		{
+			name: "success for ipv6",
+			url:  "http://[2001:db8::1]/",
+		},
+		{
+			name:    "fail for scheme relative",
+			url:     "//www.example.com",
+			respErr: "invalid url",
+		},
+		{
+			name: "success for already shortened url",
+			url:  "https://www.foo.bar",
 		},
 		{
 			name:    "fail without scheme",
@@ -124,7 +134,7 @@ func TestSaveHandler(t *testing.T) {
 
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			handler := NewSaveUrlHandler("", store, mq.NewWriterNoOp())
+			handler := NewSaveUrlHandler("", store, mq.NewWriterNoOp(), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, false)
 			b := &bytes.Buffer{}
 			fmt.Fprintf(b, `{"url": "%s"}`, tc.url)
 
@@ -151,3 +161,362 @@ func TestSaveHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestSaveHandler_CustomAlias(t *testing.T) {
+	tt := []struct {
+		name    string
+		url     string
+		alias   string
+		code    int
+		respErr string
+	}{
+		{
+			name:  "success",
+			url:   "https://www.example.com/sale",
+			alias: "spring-sale",
+			code:  http.StatusOK,
+		},
+		{
+			name:    "alias taken",
+			url:     "https://www.example.com/other",
+			alias:   "aaaa",
+			code:    http.StatusConflict,
+			respErr: "alias is already taken",
+		},
+		{
+			name:    "alias too short",
+			url:     "https://www.example.com",
+			alias:   "ab",
+			code:    http.StatusOK,
+			respErr: ErrAliasTooShort.Error(),
+		},
+		{
+			name:    "alias too long",
+			url:     "https://www.example.com",
+			alias:   strings.Repeat("a", 65),
+			code:    http.StatusOK,
+			respErr: ErrAliasTooLong.Error(),
+		},
+		{
+			name:    "alias invalid characters",
+			url:     "https://www.example.com",
+			alias:   "spring sale!",
+			code:    http.StatusOK,
+			respErr: ErrAliasCharset.Error(),
+		},
+		{
+			name:    "alias reserved",
+			url:     "https://www.example.com",
+			alias:   "Metrics",
+			code:    http.StatusOK,
+			respErr: ErrAliasReserved.Error(),
+		},
+		{
+			name:    "alias reserved in config",
+			url:     "https://www.example.com",
+			alias:   "login",
+			code:    http.StatusOK,
+			respErr: ErrAliasReserved.Error(),
+		},
+	}
+
+	logger := zap.NewNop()
+	policy := NewAliasPolicy(&config.AliasConfig{Reserved: []string{"Login"}})
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewSaveUrlHandler("", store, mq.NewWriterNoOp(), policy, NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, false)
+			b := &bytes.Buffer{}
+			require.NoError(t, json.NewEncoder(b).Encode(&RequestSave{URL: tc.url, Alias: tc.alias}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", b)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, logger))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			var resp ResponseSave
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+
+			require.Equal(t, tc.code, rr.Code)
+			if tc.respErr == "" {
+				require.Equal(t, true, resp.Ok)
+				require.Equal(t, tc.alias, resp.Alias)
+			} else {
+				require.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+				require.Equal(t, tc.respErr, resp.Error)
+				require.Equal(t, false, resp.Ok)
+			}
+		})
+	}
+}
+
+func TestSaveHandler_Expiry(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour).Truncate(time.Second)
+	farFuture := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		name    string
+		body    RequestSave
+		respErr string
+	}{
+		{
+			name: "expires in",
+			body: RequestSave{URL: "https://www.example.com/a", ExpiresIn: 60},
+		},
+		{
+			name: "expires at",
+			body: RequestSave{URL: "https://www.example.com/b", ExpiresAt: &future},
+		},
+		{
+			name:    "both set",
+			body:    RequestSave{URL: "https://www.example.com/c", ExpiresIn: 60, ExpiresAt: &future},
+			respErr: ErrExpiryAmbiguous.Error(),
+		},
+		{
+			name:    "negative expires in",
+			body:    RequestSave{URL: "https://www.example.com/d", ExpiresIn: -1},
+			respErr: ErrExpiryInvalid.Error(),
+		},
+		{
+			name:    "expires at in the past",
+			body:    RequestSave{URL: "https://www.example.com/e", ExpiresAt: &past},
+			respErr: ErrExpiryInvalid.Error(),
+		},
+		{
+			name: "expires in the maximum",
+			body: RequestSave{URL: "https://www.example.com/f", ExpiresIn: int64(defaultMaxTTL / time.Second)},
+		},
+		{
+			name:    "expires in over the maximum",
+			body:    RequestSave{URL: "https://www.example.com/g", ExpiresIn: int64(defaultMaxTTL/time.Second) + 1},
+			respErr: ErrExpiryTooFar.Error(),
+		},
+		{
+			name:    "expires in overflows duration",
+			body:    RequestSave{URL: "https://www.example.com/h", ExpiresIn: int64(math.MaxInt64/time.Second) + 1},
+			respErr: ErrExpiryTooFar.Error(),
+		},
+		{
+			name:    "expires in overflows to now",
+			body:    RequestSave{URL: "https://www.example.com/i", ExpiresIn: 1 << 62},
+			respErr: ErrExpiryTooFar.Error(),
+		},
+		{
+			name:    "expires at over the maximum",
+			body:    RequestSave{URL: "https://www.example.com/j", ExpiresAt: &farFuture},
+			respErr: ErrExpiryTooFar.Error(),
+		},
+	}
+
+	logger := zap.NewNop()
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewSaveUrlHandler("", store, mq.NewWriterNoOp(), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, false)
+			b := &bytes.Buffer{}
+			require.NoError(t, json.NewEncoder(b).Encode(&tc.body))
+
+			req := httptest.NewRequest(http.MethodPost, "/", b)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, logger))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			var resp ResponseSave
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+
+			if tc.respErr == "" {
+				require.Equal(t, http.StatusOK, rr.Code)
+				require.Equal(t, true, resp.Ok)
+				require.NotNil(t, resp.ExpiresAt)
+				require.True(t, resp.ExpiresAt.After(time.Now()))
+			} else {
+				require.Equal(t, http.StatusBadRequest, rr.Code)
+				require.Equal(t, tc.respErr, resp.Error)
+				require.Equal(t, false, resp.Ok)
+			}
+		})
+	}
+}
+
+func TestSaveHandler_UnsafeUrl(t *testing.T) {
+	tt := []struct {
+		name string
+		url  string
+		code string
+	}{
+		{
+			name: "self reference",
+			url:  "https://short.example.com/aaaa",
+			code: validate.ErrSelfReference.Code,
+		},
+		{
+			name: "loopback",
+			url:  "http://127.0.0.1:8080/",
+			code: validate.ErrPrivateAddress.Code,
+		},
+		{
+			name: "private",
+			url:  "http://10.0.0.1/admin",
+			code: validate.ErrPrivateAddress.Code,
+		},
+		{
+			name: "link local",
+			url:  "http://169.254.169.254/latest/meta-data",
+			code: validate.ErrPrivateAddress.Code,
+		},
+	}
+
+	logger := zap.NewNop()
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewSaveUrlHandler("", store, mq.NewWriterNoOp(), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, false)
+			b := &bytes.Buffer{}
+			require.NoError(t, json.NewEncoder(b).Encode(&RequestSave{URL: tc.url}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", b)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, logger))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			var resp ResponseSave
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+
+			require.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+			require.Equal(t, false, resp.Ok)
+			require.Equal(t, tc.code, resp.Code)
+		})
+	}
+}
+
+func TestSaveHandler_NormalizedUrl(t *testing.T) {
+	handler := NewSaveUrlHandler("", store, mq.NewWriterNoOp(), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, false)
+	b := &bytes.Buffer{}
+	require.NoError(t, json.NewEncoder(b).Encode(&RequestSave{URL: "https://BÜCHER.Example.NET/Path", Alias: "normalized"}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", b)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, zap.NewNop()))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "https://xn--bcher-kva.example.net/Path", mustGetURL(t, "normalized"))
+}
+
+func TestSaveHandler_Dedupe(t *testing.T) {
+	logger := zap.NewNop()
+
+	save := func(t *testing.T, dedupe bool, owner string, body RequestSave) ResponseSave {
+		handler := NewSaveUrlHandler("", store, mq.NewWriterNoOp(), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, dedupe)
+		b := &bytes.Buffer{}
+		require.NoError(t, json.NewEncoder(b).Encode(&body))
+
+		req := httptest.NewRequest(http.MethodPost, "/", b)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, logger))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.PrincipalCtxKey, owner))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var resp ResponseSave
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		return resp
+	}
+
+	first := save(t, true, "alice", RequestSave{URL: "https://www.example.com/campaign", Alias: "campaign"})
+	require.True(t, first.Ok)
+	require.False(t, first.Existing)
+
+	t.Run("same owner", func(t *testing.T) {
+		resp := save(t, true, "alice", RequestSave{URL: "https://WWW.example.com/campaign"})
+		require.True(t, resp.Ok)
+		require.True(t, resp.Existing)
+		require.Equal(t, "campaign", resp.Alias)
+	})
+
+	t.Run("per request", func(t *testing.T) {
+		enabled := true
+		resp := save(t, false, "alice", RequestSave{URL: "https://www.example.com/campaign", Dedupe: &enabled})
+		require.True(t, resp.Ok)
+		require.True(t, resp.Existing)
+		require.Equal(t, "campaign", resp.Alias)
+	})
+
+	t.Run("another owner", func(t *testing.T) {
+		resp := save(t, true, "bob", RequestSave{URL: "https://www.example.com/campaign"})
+		require.False(t, resp.Existing)
+		require.NotEqual(t, "campaign", resp.Alias)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		resp := save(t, false, "alice", RequestSave{URL: "https://www.example.com/campaign"})
+		require.False(t, resp.Existing)
+		require.NotEqual(t, "campaign", resp.Alias)
+	})
+}
+
+// sequenceGenerator returns aliases in order
+type sequenceGenerator struct {
+	aliases []string
+}
+
+func (g *sequenceGenerator) Generate(string) (string, error) {
+	alias := g.aliases[0]
+	g.aliases = g.aliases[1:]
+	return alias, nil
+}
+
+func TestSaveHandler_GeneratedAliasRetry(t *testing.T) {
+	// "aaaa" is taken, "stats" is reserved
+	generator := &sequenceGenerator{aliases: []string{"aaaa", "stats", "retried"}}
+	handler := NewSaveUrlHandler("", store, mq.NewWriterNoOp(), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), generator, validator, false)
+	b := &bytes.Buffer{}
+	require.NoError(t, json.NewEncoder(b).Encode(&RequestSave{URL: "https://www.example.com/retry"}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", b)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, zap.NewNop()))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var resp ResponseSave
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+
+	require.True(t, resp.Ok)
+	require.Equal(t, "retried", resp.Alias)
+	require.Empty(t, generator.aliases)
+}
+
+func newTestRegistry() *event.Registry {
+	registry := event.NewRegistry("test")
+	urls.Register(registry)
+	return registry
+}
+
+// requireEvent decodes the outbox message and compares its event
+func requireEvent(t *testing.T, registry *event.Registry, payload []byte, want event.Event) {
+	env, e, err := registry.Decode(payload)
+	require.NoError(t, err)
+	require.Equal(t, "test", env.Producer)
+	require.Equal(t, want, e)
+}
+
+func TestSaveHandler_Outbox(t *testing.T) {
+	outboxStore := memory.NewMemoryStore()
+	outbox := outboxStore.(urlstore.Outbox)
+	registry := newTestRegistry()
+	handler := NewSaveUrlHandler("", outboxStore, mq.NewOutboxWriter(outbox, mq.NewJsonEncoder(registry), mq.EventKey, zap.NewNop()), NewAliasPolicy(&config.AliasConfig{}), NewExpiryPolicy(&config.ExpiryConfig{}), aliasgen.NewHashGenerator(), validator, false)
+
+	for _, alias := range []string{"outbox", "outbox"} {
+		b := &bytes.Buffer{}
+		require.NoError(t, json.NewEncoder(b).Encode(&RequestSave{URL: "https://outbox.example.com", Alias: alias}))
+		req := httptest.NewRequest(http.MethodPost, "/", b)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, zap.NewNop()))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// event is written once with the saved url, failed save writes nothing
+	pending, err := outbox.PendingMessages(10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	requireEvent(t, registry, pending[0].Payload, urls.NewAddedEvent("https://outbox.example.com", "outbox"))
+}
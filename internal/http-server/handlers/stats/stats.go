@@ -0,0 +1,207 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/sajoniks/GoShort/internal/analytics"
+	"github.com/sajoniks/GoShort/internal/api/v1/response"
+	"github.com/sajoniks/GoShort/internal/http-server/helper"
+	"github.com/sajoniks/GoShort/internal/http-server/middleware"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxPoints limits the number of buckets of a single series
+	maxPoints = 2000
+
+	defaultTopLimit = 10
+	maxTopLimit     = 100
+)
+
+var (
+	ErrInvalidTime  = errors.New("time must be RFC 3339 or YYYY-MM-DD")
+	ErrInvalidRange = errors.New("from must be before to")
+	ErrRangeTooWide = fmt.Errorf("range has more than %d buckets", maxPoints)
+	ErrInvalidLimit = fmt.Errorf("limit must be from 1 to %d", maxTopLimit)
+	ErrInvalidBot   = errors.New("bot must be true or false")
+)
+
+type SeriesResponse struct {
+	response.BaseResponse
+	Alias       string                `json:"alias,omitempty"`
+	Granularity analytics.Granularity `json:"granularity,omitempty"`
+	From        time.Time             `json:"from"`
+	To          time.Time             `json:"to"`
+	Total       int64                 `json:"total"`
+	// Points include every bucket of the range, buckets without clicks too
+	Points []analytics.Point `json:"points"`
+}
+
+type TopResponse struct {
+	response.BaseResponse
+	From    time.Time               `json:"from"`
+	To      time.Time               `json:"to"`
+	Aliases []analytics.AliasClicks `json:"aliases"`
+}
+
+// parseTime parses RFC 3339 time or date, empty value is returned as zero time
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, ErrInvalidTime
+}
+
+// parseRange parses "from" and "to" query parameters. To is now by default, from is span before to
+func parseRange(r *http.Request, span time.Duration) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+	from, err := parseTime(query.Get("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parseTime(query.Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if from.IsZero() {
+		from = to.Add(-span)
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, ErrInvalidRange
+	}
+	return from, to, nil
+}
+
+// parseFilter parses filter query parameters "country", "browser", "os", "referrer", "language" and "bot"
+func parseFilter(r *http.Request) (analytics.Filter, error) {
+	query := r.URL.Query()
+	f := analytics.Filter{
+		Country:      query.Get("country"),
+		Browser:      query.Get("browser"),
+		OS:           query.Get("os"),
+		ReferrerHost: query.Get("referrer"),
+		Language:     query.Get("language"),
+	}
+	if value := query.Get("bot"); value != "" {
+		bot, err := strconv.ParseBool(value)
+		if err != nil {
+			return analytics.Filter{}, ErrInvalidBot
+		}
+		f.Bot = &bot
+	}
+	return f, nil
+}
+
+// defaultSpan is the default range of the series of the granularity
+func defaultSpan(g analytics.Granularity) time.Duration {
+	if g == analytics.Day {
+		return time.Hour * 24 * 30
+	}
+	return time.Hour * 24
+}
+
+// NewSeriesHandler creates handler of the click series of the alias.
+// Query parameters are "from", "to", "granularity", which is either "hour" (default) or "day", and filters
+// of parseFilter
+func NewSeriesHandler(store analytics.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alias := mux.Vars(r)["alias"]
+		log := middleware.GetLogging(r.Context()).With(zap.String("alias", alias))
+
+		granularity, err := analytics.ParseGranularity(r.URL.Query().Get("granularity"))
+		if err != nil {
+			_ = helper.WriteProblemJsonStatus(w, http.StatusBadRequest, response.Error(err))
+			return
+		}
+		from, to, err := parseRange(r, defaultSpan(granularity))
+		if err != nil {
+			_ = helper.WriteProblemJsonStatus(w, http.StatusBadRequest, response.Error(err))
+			return
+		}
+		if to.Sub(granularity.Truncate(from)) > granularity.Duration()*maxPoints {
+			_ = helper.WriteProblemJsonStatus(w, http.StatusBadRequest, response.Error(ErrRangeTooWide))
+			return
+		}
+		filter, err := parseFilter(r)
+		if err != nil {
+			_ = helper.WriteProblemJsonStatus(w, http.StatusBadRequest, response.Error(err))
+			return
+		}
+
+		points, err := store.Series(alias, from, to, granularity, filter)
+		if err != nil {
+			log.Error("get series error", zap.Error(trace.WrapError(err)))
+			_ = helper.WriteProblemJsonStatus(w, http.StatusInternalServerError, response.ErrorMsg("server error"))
+			return
+		}
+
+		resp := SeriesResponse{
+			BaseResponse: response.Ok(),
+			Alias:        alias,
+			Granularity:  granularity,
+			From:         from,
+			To:           to,
+			Points:       analytics.FillSeries(points, from, to, granularity),
+		}
+		for _, p := range points {
+			resp.Total += p.Clicks
+		}
+		_ = helper.WriteJson(w, &resp)
+	})
+}
+
+// NewTopHandler creates handler of the aliases with the most clicks.
+// Query parameters are "from", "to" (the last 24 hours by default), "limit" and filters of parseFilter
+func NewTopHandler(store analytics.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := middleware.GetLogging(r.Context())
+
+		limit := defaultTopLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxTopLimit {
+				_ = helper.WriteProblemJsonStatus(w, http.StatusBadRequest, response.Error(ErrInvalidLimit))
+				return
+			}
+			limit = n
+		}
+		from, to, err := parseRange(r, time.Hour*24)
+		if err != nil {
+			_ = helper.WriteProblemJsonStatus(w, http.StatusBadRequest, response.Error(err))
+			return
+		}
+		filter, err := parseFilter(r)
+		if err != nil {
+			_ = helper.WriteProblemJsonStatus(w, http.StatusBadRequest, response.Error(err))
+			return
+		}
+
+		top, err := store.Top(from, to, limit, filter)
+		if err != nil {
+			log.Error("get top error", zap.Error(trace.WrapError(err)))
+			_ = helper.WriteProblemJsonStatus(w, http.StatusInternalServerError, response.ErrorMsg("server error"))
+			return
+		}
+
+		_ = helper.WriteJson(w, &TopResponse{
+			BaseResponse: response.Ok(),
+			From:         from,
+			To:           to,
+			Aliases:      append([]analytics.AliasClicks{}, top...),
+		})
+	})
+}
@@ -0,0 +1,162 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/sajoniks/GoShort/internal/analytics"
+	"github.com/sajoniks/GoShort/internal/analytics/sqlite"
+	"github.com/sajoniks/GoShort/internal/api/v1/response"
+	"github.com/sajoniks/GoShort/internal/http-server/middleware"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var day = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestRouter(t *testing.T) *mux.Router {
+	store, err := sqlite.NewClickStore(filepath.Join(t.TempDir(), "analytics.sqlite"))
+	require.NoError(t, err)
+	t.Cleanup(store.Close)
+
+	for i, c := range []struct {
+		alias   string
+		at      time.Duration
+		country string
+		bot     bool
+	}{
+		{"aaaa", time.Minute, "DE", false},
+		{"aaaa", time.Hour*2 + time.Minute, "US", false},
+		{"aaaa", time.Hour * 26, "DE", false},
+		{"bbbb", time.Minute, "US", true},
+		{"bbbb", time.Minute * 2, "US", true},
+		{"bbbb", time.Minute * 3, "DE", false},
+	} {
+		require.NoError(t, store.AddClick(analytics.Click{
+			Alias:   c.alias,
+			URL:     "https://example.com",
+			Time:    day.Add(c.at),
+			Source:  fmt.Sprint(i),
+			Country: c.country,
+			Bot:     c.bot,
+		}))
+	}
+
+	router := mux.NewRouter()
+	router.Handle("/stats/top", NewTopHandler(store)).Methods(http.MethodGet)
+	router.Handle("/stats/{alias}", NewSeriesHandler(store)).Methods(http.MethodGet)
+	return router
+}
+
+func get(t *testing.T, router *mux.Router, target string, v any) int {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, zap.NewNop()))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(v))
+	return rr.Code
+}
+
+func TestSeriesHandler(t *testing.T) {
+	router := newTestRouter(t)
+
+	var resp SeriesResponse
+	code := get(t, router, "/stats/aaaa?from=2024-05-01&to=2024-05-01T04:00:00Z", &resp)
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, resp.Ok)
+	require.Equal(t, analytics.Hour, resp.Granularity)
+	require.Equal(t, int64(2), resp.Total)
+	require.Equal(t, []analytics.Point{
+		{Time: day, Clicks: 1},
+		{Time: day.Add(time.Hour), Clicks: 0},
+		{Time: day.Add(time.Hour * 2), Clicks: 1},
+		{Time: day.Add(time.Hour * 3), Clicks: 0},
+	}, resp.Points)
+
+	resp = SeriesResponse{}
+	code = get(t, router, "/stats/aaaa?from=2024-05-01&to=2024-05-03&granularity=day", &resp)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, int64(3), resp.Total)
+	require.Equal(t, []analytics.Point{
+		{Time: day, Clicks: 2},
+		{Time: day.Add(time.Hour * 24), Clicks: 1},
+	}, resp.Points)
+}
+
+func TestSeriesHandler_BadRequest(t *testing.T) {
+	router := newTestRouter(t)
+
+	for _, tc := range []struct {
+		query   string
+		respErr error
+	}{
+		{"granularity=week", analytics.ErrInvalidGranularity},
+		{"from=yesterday", ErrInvalidTime},
+		{"from=2024-05-02&to=2024-05-01", ErrInvalidRange},
+		{"from=2020-01-01&to=2024-05-01", ErrRangeTooWide},
+		{"bot=maybe", ErrInvalidBot},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			var resp response.BaseResponse
+			code := get(t, router, "/stats/aaaa?"+tc.query, &resp)
+			require.Equal(t, http.StatusBadRequest, code)
+			require.False(t, resp.Ok)
+			require.Equal(t, tc.respErr.Error(), resp.Error)
+		})
+	}
+}
+
+func TestTopHandler(t *testing.T) {
+	router := newTestRouter(t)
+
+	var resp TopResponse
+	code := get(t, router, "/stats/top?from=2024-05-01&to=2024-05-02", &resp)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []analytics.AliasClicks{
+		{Alias: "bbbb", Clicks: 3},
+		{Alias: "aaaa", Clicks: 2},
+	}, resp.Aliases)
+
+	resp = TopResponse{}
+	code = get(t, router, "/stats/top?from=2024-05-01&to=2024-05-02&bot=false", &resp)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []analytics.AliasClicks{
+		{Alias: "aaaa", Clicks: 2},
+		{Alias: "bbbb", Clicks: 1},
+	}, resp.Aliases)
+
+	resp = TopResponse{}
+	code = get(t, router, "/stats/top?from=2024-05-01&to=2024-05-02&limit=1", &resp)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, resp.Aliases, 1)
+
+	// nothing was clicked in the last 24 hours
+	resp = TopResponse{}
+	code = get(t, router, "/stats/top", &resp)
+	require.Equal(t, http.StatusOK, code)
+	require.Empty(t, resp.Aliases)
+
+	var errResp response.BaseResponse
+	code = get(t, router, "/stats/top?limit=1000", &errResp)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, ErrInvalidLimit.Error(), errResp.Error)
+}
+
+func TestSeriesHandler_Filter(t *testing.T) {
+	router := newTestRouter(t)
+
+	var resp SeriesResponse
+	code := get(t, router, "/stats/aaaa?from=2024-05-01&to=2024-05-03&granularity=day&country=de", &resp)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, int64(2), resp.Total)
+	require.Equal(t, []analytics.Point{
+		{Time: day, Clicks: 1},
+		{Time: day.Add(time.Hour * 24), Clicks: 1},
+	}, resp.Points)
+}
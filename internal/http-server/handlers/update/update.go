@@ -0,0 +1,101 @@
+package update
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/sajoniks/GoShort/internal/api/v1/event/urls"
+	resp "github.com/sajoniks/GoShort/internal/api/v1/response"
+	"github.com/sajoniks/GoShort/internal/http-server/helper"
+	"github.com/sajoniks/GoShort/internal/http-server/middleware"
+	"github.com/sajoniks/GoShort/internal/mq"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"github.com/sajoniks/GoShort/internal/validate"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+)
+
+type RequestUpdate struct {
+	URL string `json:"url"`
+}
+
+type ResponseUpdate struct {
+	resp.BaseResponse
+	URL string `json:"url,omitempty"`
+}
+
+func NewUpdateUrlHandler(store urlstore.Store, kafka mq.KafkaWriterWorkerInterface, validator *validate.Validator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := middleware.GetLogging(r.Context())
+		vars := mux.Vars(r)
+		alias := vars["alias"]
+
+		var reqResp ResponseUpdate
+		if alias == "" {
+			log.Error("empty alias")
+			reqResp.BaseResponse = resp.ErrorMsg("empty alias")
+			_ = helper.WriteProblemJson(w, &reqResp)
+			return
+		}
+
+		log = log.With(zap.String("alias", alias))
+
+		var reqBody RequestUpdate
+		if err := helper.DecodeJson(r.Body, &reqBody); err != nil {
+			log.Error("error on decode json", zap.Error(trace.WrapError(err)))
+
+			if errors.Is(err, io.EOF) {
+				reqResp.BaseResponse = resp.ErrorMsg("empty request body")
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				reqResp.BaseResponse = resp.ErrorMsg("error decoding request content")
+			}
+			_ = helper.WriteProblemJson(w, &reqResp)
+			return
+		}
+
+		log = log.With(zap.String("source_url", reqBody.URL))
+
+		destination, err := validator.Validate(reqBody.URL)
+		if err != nil {
+			reqResp.BaseResponse = helper.ValidationErrorResponse(err)
+			log.Error("validation error", zap.String("error", reqResp.Error), zap.String("code", reqResp.Code))
+
+			_ = helper.WriteProblemJson(w, &reqResp)
+			return
+		}
+
+		// store the normalized form of the url
+		reqBody.URL = destination.String()
+
+		err = store.UpdateURL(alias, reqBody.URL, middleware.GetPrincipal(r.Context()))
+		if err != nil {
+			log.Error("update url error", zap.Error(trace.WrapError(err)))
+			if errors.Is(err, urlstore.ErrNotOwner) {
+				reqResp.BaseResponse = resp.ErrorMsg("url belongs to another owner")
+				_ = helper.WriteProblemJsonStatus(w, http.StatusForbidden, &reqResp)
+				return
+			}
+
+			if errors.Is(err, urlstore.ErrUrlNotFound) {
+				reqResp.BaseResponse = resp.ErrorMsg("requested url was not found")
+			} else if errors.Is(err, urlstore.ErrUrlEmpty) {
+				reqResp.BaseResponse = resp.ErrorMsg("url is empty")
+			} else {
+				helper.WriteStoreErrorStatus(w, err)
+				reqResp.BaseResponse = resp.ErrorMsg("server error")
+			}
+			_ = helper.WriteProblemJson(w, &reqResp)
+			return
+		}
+
+		kafka.AddJsonMessage(urls.NewUpdatedEvent(reqBody.URL, alias))
+
+		log.Info("updated url")
+
+		reqResp.BaseResponse = resp.Ok()
+		reqResp.URL = reqBody.URL
+		_ = helper.WriteJson(w, &reqResp)
+	})
+}
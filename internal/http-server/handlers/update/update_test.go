@@ -0,0 +1,118 @@
+package update
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/sajoniks/GoShort/internal/http-server/middleware"
+	"github.com/sajoniks/GoShort/internal/mq"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/store/memory"
+	"github.com/sajoniks/GoShort/internal/validate"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+var store urlstore.Store
+var router *mux.Router
+
+func TestMain(m *testing.M) {
+	store = memory.NewMemoryStore()
+	for _, item := range []struct{ alias, url, owner string }{
+		{"aaaa", "https://www.example.com", "alice"},
+		{"bbbb", "https://www.example.com", "bob"},
+	} {
+		if _, err := store.SaveURL(item.url, item.alias, urlstore.WithOwner(item.owner)); err != nil {
+			log.Fatalf("failed to prepare store: %v", err)
+		}
+	}
+
+	router = mux.NewRouter()
+	router.Methods(http.MethodPatch).Path("/{alias}").Handler(NewUpdateUrlHandler(store, mq.NewWriterNoOp(), validate.New(validate.PrivateAddress())))
+
+	os.Exit(m.Run())
+}
+
+func TestUpdateHandler(t *testing.T) {
+	tt := []struct {
+		name    string
+		alias   string
+		url     string
+		respErr string
+	}{
+		{
+			name:  "success",
+			alias: "aaaa",
+			url:   "https://www.example.org",
+		},
+		{
+			name:    "another owner",
+			alias:   "bbbb",
+			url:     "https://www.example.org",
+			respErr: "url belongs to another owner",
+		},
+		{
+			name:    "not found",
+			alias:   "cccc",
+			url:     "https://www.example.org",
+			respErr: "requested url was not found",
+		},
+		{
+			name:    "invalid url",
+			alias:   "aaaa",
+			url:     "example",
+			respErr: "invalid url",
+		},
+		{
+			name:    "private address",
+			alias:   "aaaa",
+			url:     "http://192.168.0.1/admin",
+			respErr: "url points to a private address",
+		},
+		{
+			name:    "empty url",
+			alias:   "aaaa",
+			url:     "",
+			respErr: "invalid url",
+		},
+	}
+
+	logger := zap.NewNop()
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			fmt.Fprintf(b, `{"url": "%s"}`, tc.url)
+
+			req := httptest.NewRequest(http.MethodPatch, "/"+tc.alias, b)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.LoggerCtxKey, logger))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.PrincipalCtxKey, "alice"))
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			var resp ResponseUpdate
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+
+			if tc.respErr == "" {
+				require.Equal(t, http.StatusOK, rr.Code)
+				require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+				require.Equal(t, true, resp.Ok)
+				src, err := store.GetURL(tc.alias)
+				require.NoError(t, err)
+				require.Equal(t, tc.url, src)
+			} else {
+				require.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+				require.Equal(t, false, resp.Ok)
+				require.Equal(t, tc.respErr, resp.Error)
+			}
+		})
+	}
+}
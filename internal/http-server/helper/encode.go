@@ -33,3 +33,20 @@ func WriteProblemJson(w http.ResponseWriter, v any) error {
 	_, err := w.Write(b.Bytes())
 	return err
 }
+
+// WriteProblemJsonStatus is the same as WriteProblemJson, but also writes status code.
+// Content-Type header is set before the status code is written
+func WriteProblemJsonStatus(w http.ResponseWriter, status int, v any) error {
+	b := bytes.Buffer{}
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(true)
+	enc.SetIndent("", "")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_, err := w.Write(b.Bytes())
+	return err
+}
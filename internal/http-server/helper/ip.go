@@ -0,0 +1,27 @@
+package helper
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns remote ip of the request, nil is returned if remote address is not an ip
+func ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// AnonymizeIP truncates ip so it no longer identifies the client, but still identifies its network:
+// the last octet of IPv4 and the last 80 bits of IPv6 are zeroed. Empty string is returned for nil ip
+func AnonymizeIP(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,28 @@
+package helper
+
+import (
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	for ip, want := range map[string]string{
+		"203.0.113.195":                        "203.0.113.0",
+		"::ffff:203.0.113.195":                 "203.0.113.0",
+		"2001:db8:85a3:8d3:1319:8a2e:370:7348": "2001:db8:85a3::",
+	} {
+		require.Equal(t, want, AnonymizeIP(net.ParseIP(ip)), ip)
+	}
+	require.Empty(t, AnonymizeIP(nil))
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.195:5123"
+	require.Equal(t, "203.0.113.195", ClientIP(r).String())
+
+	r.RemoteAddr = "unix"
+	require.Nil(t, ClientIP(r))
+}
@@ -0,0 +1,18 @@
+package helper
+
+import (
+	"errors"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"net/http"
+)
+
+// WriteStoreErrorStatus writes status code for unexpected store error.
+// Retryable errors are reported as 503 with Retry-After header, others as 500
+func WriteStoreErrorStatus(w http.ResponseWriter, err error) {
+	if errors.Is(err, urlstore.ErrStoreBusy) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+}
@@ -0,0 +1,16 @@
+package helper
+
+import (
+	"errors"
+	"github.com/sajoniks/GoShort/internal/api/v1/response"
+	"github.com/sajoniks/GoShort/internal/validate"
+)
+
+// ValidationErrorResponse creates error response with the code of validate.Error
+func ValidationErrorResponse(err error) response.BaseResponse {
+	var vErr *validate.Error
+	if errors.As(err, &vErr) {
+		return response.ErrorCode(vErr.Code, vErr.Message)
+	}
+	return response.ErrorMsg("invalid url")
+}
@@ -8,3 +8,7 @@ import (
 type HttpMetricsService interface {
 	RecordHttp(status int, r *http.Request, d time.Duration)
 }
+
+type RateLimitMetricsService interface {
+	RecordRejected(route string)
+}
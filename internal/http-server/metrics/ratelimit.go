@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sajoniks/GoShort/internal/http-server/metrics/interface"
+)
+
+type noOpRateLimitMetrics struct {
+}
+
+func NewNoOpRateLimitMetrics() metricsinterface.RateLimitMetricsService {
+	return &noOpRateLimitMetrics{}
+}
+
+func (n noOpRateLimitMetrics) RecordRejected(route string) {
+}
+
+type RateLimitMetrics struct {
+	rejected *prometheus.CounterVec
+}
+
+func NewRateLimitMetrics(reg prometheus.Registerer) *RateLimitMetrics {
+	m := RateLimitMetrics{}
+	m.rejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "goshort",
+		Subsystem: "api",
+		Name:      "rate_limited",
+		Help:      "count of requests rejected by rate limiter",
+	}, []string{"route"})
+	reg.MustRegister(m.rejected)
+	return &m
+}
+
+func (m *RateLimitMetrics) RecordRejected(route string) {
+	m.rejected.With(prometheus.Labels{"route": route}).Add(1)
+}
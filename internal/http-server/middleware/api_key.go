@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/sajoniks/GoShort/internal/api/v1/response"
+	"github.com/sajoniks/GoShort/internal/auth"
+	"github.com/sajoniks/GoShort/internal/http-server/helper"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+const (
+	PrincipalCtxKey = "principalCtxKey"
+)
+
+// GetPrincipal returns owner of the api key used in request.
+// Empty string is returned for anonymous requests
+func GetPrincipal(ctx context.Context) string {
+	if v, ok := ctx.Value(PrincipalCtxKey).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// apiKeyFromRequest reads api key from "Authorization: Bearer <key>" or "X-API-Key: <key>" headers
+func apiKeyFromRequest(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if scheme, key, ok := strings.Cut(h, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(key)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// NewApiKeyAuth finds the principal of the request by its api key.
+//
+// Requests with unknown keys are always rejected. Requests without key are rejected only if required is set,
+// otherwise they are served as anonymous
+func NewApiKeyAuth(keys auth.KeyStore, required bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := apiKeyFromRequest(r)
+			if key == "" {
+				if required {
+					w.Header().Set("WWW-Authenticate", "Bearer")
+					_ = helper.WriteProblemJsonStatus(w, http.StatusUnauthorized, response.ErrorMsg("api key is required"))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			owner, err := keys.GetApiKeyOwner(auth.HashKey(key))
+			if err != nil {
+				if errors.Is(err, auth.ErrKeyNotFound) {
+					w.Header().Set("WWW-Authenticate", "Bearer")
+					_ = helper.WriteProblemJsonStatus(w, http.StatusUnauthorized, response.ErrorMsg("invalid api key"))
+				} else {
+					if logger, ok := r.Context().Value(LoggerCtxKey).(*zap.Logger); ok {
+						logger.Error("api key lookup error", zap.Error(trace.WrapError(err)))
+					}
+					_ = helper.WriteProblemJsonStatus(w, http.StatusInternalServerError, response.ErrorMsg("server error"))
+				}
+				return
+			}
+
+			if logger, ok := r.Context().Value(LoggerCtxKey).(*zap.Logger); ok {
+				r = r.WithContext(context.WithValue(r.Context(), LoggerCtxKey, logger.With(zap.String("principal", owner))))
+			}
+			r = r.WithContext(context.WithValue(r.Context(), PrincipalCtxKey, owner))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
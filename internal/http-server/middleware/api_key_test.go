@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"github.com/sajoniks/GoShort/internal/auth"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockKeyStore struct {
+	owners map[string]string
+}
+
+func (m *mockKeyStore) AddApiKey(owner, keyHash string) (int64, error) {
+	panic("not supported")
+}
+
+func (m *mockKeyStore) GetApiKeyOwner(keyHash string) (string, error) {
+	if owner, ok := m.owners[keyHash]; ok {
+		return owner, nil
+	}
+	return "", auth.ErrKeyNotFound
+}
+
+func (m *mockKeyStore) ListApiKeys() ([]auth.ApiKey, error) {
+	panic("not supported")
+}
+
+func (m *mockKeyStore) DeleteApiKey(id int64) error {
+	panic("not supported")
+}
+
+func TestApiKeyAuth(t *testing.T) {
+	keys := &mockKeyStore{owners: map[string]string{
+		auth.HashKey("alice-key"): "alice",
+	}}
+
+	tt := []struct {
+		name      string
+		required  bool
+		header    string
+		value     string
+		code      int
+		principal string
+	}{
+		{
+			name:      "bearer key",
+			required:  true,
+			header:    "Authorization",
+			value:     "Bearer alice-key",
+			code:      http.StatusOK,
+			principal: "alice",
+		},
+		{
+			name:      "x-api-key",
+			required:  true,
+			header:    "X-API-Key",
+			value:     "alice-key",
+			code:      http.StatusOK,
+			principal: "alice",
+		},
+		{
+			name:     "invalid key",
+			required: false,
+			header:   "X-API-Key",
+			value:    "bob-key",
+			code:     http.StatusUnauthorized,
+		},
+		{
+			name:     "missing key",
+			required: true,
+			code:     http.StatusUnauthorized,
+		},
+		{
+			name:     "anonymous",
+			required: false,
+			code:     http.StatusOK,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var principal string
+			handler := NewApiKeyAuth(keys, tc.required)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal = GetPrincipal(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.code, rr.Code)
+			require.Equal(t, tc.principal, principal)
+			if tc.code == http.StatusUnauthorized {
+				require.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/sajoniks/GoShort/internal/api/v1/response"
+	"github.com/sajoniks/GoShort/internal/http-server/helper"
+	"github.com/sajoniks/GoShort/internal/http-server/metrics/interface"
+	"github.com/sajoniks/GoShort/internal/ratelimit"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"go.uber.org/zap"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// clientKey identifies the client of the request: principal of the api key, or remote ip for anonymous requests
+func clientKey(r *http.Request) string {
+	if principal := GetPrincipal(r.Context()); principal != "" {
+		return "key:" + principal
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// NewRateLimit limits requests to the route per client.
+// Must be applied after NewApiKeyAuth to limit clients by their api keys.
+//
+// Rejected requests get HTTP 429 with Retry-After header.
+// If limiter fails, request is allowed
+func NewRateLimit(
+	route string,
+	limiter ratelimit.Limiter,
+	limit ratelimit.Limit,
+	metrics metricsinterface.RateLimitMetricsService,
+) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := clientKey(r)
+
+			res, err := limiter.Allow(r.Context(), route+":"+key, limit)
+			if err != nil {
+				if logger, ok := r.Context().Value(LoggerCtxKey).(*zap.Logger); ok {
+					logger.Error("rate limiter error", zap.Error(trace.WrapError(err)))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !res.Allowed {
+				metrics.RecordRejected(route)
+				if logger, ok := r.Context().Value(LoggerCtxKey).(*zap.Logger); ok {
+					logger.Warn("rate limited", zap.String("client", key), zap.Duration("retry_after", res.RetryAfter))
+				}
+
+				retryAfter := int(math.Ceil(res.RetryAfter.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+				_ = helper.WriteProblemJsonStatus(w, http.StatusTooManyRequests, response.ErrorMsg("too many requests"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
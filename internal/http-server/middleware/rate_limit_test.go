@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"github.com/sajoniks/GoShort/internal/http-server/metrics"
+	"github.com/sajoniks/GoShort/internal/ratelimit"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	limit := ratelimit.Limit{Rate: 1, Burst: 2}
+	handler := NewRateLimit("save", ratelimit.NewMemoryLimiter(), limit, metrics.NewNoOpRateLimitMetrics())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	require.Equal(t, http.StatusOK, send("10.0.0.1:1000").Code)
+	require.Equal(t, http.StatusOK, send("10.0.0.1:1001").Code)
+
+	rr := send("10.0.0.1:1002")
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	require.Equal(t, "1", rr.Header().Get("Retry-After"))
+	require.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+
+	require.Equal(t, http.StatusOK, send("10.0.0.2:1000").Code)
+}
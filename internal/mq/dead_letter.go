@@ -0,0 +1,170 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of the dead-lettered message. The original headers are kept too
+const (
+	HeaderDeadLetterError     = "dlq-error"
+	HeaderDeadLetterTopic     = "dlq-topic"
+	HeaderDeadLetterPartition = "dlq-partition"
+	HeaderDeadLetterOffset    = "dlq-offset"
+	HeaderDeadLetterAttempts  = "dlq-attempts"
+
+	deadLetterHeaderPrefix = "dlq-"
+)
+
+// newReliableWriter creates writer that waits for all replicas to acknowledge messages,
+// because the messages are removed from their source once written
+func newReliableWriter(brokers []string, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:  kafka.TCP(brokers...),
+		Topic: topic,
+		// messages keep their partition of the key
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// batches are collected by callers, writer does not need to wait for more messages
+		BatchTimeout: time.Millisecond * 10,
+	}
+}
+
+// withoutDeadLetterHeaders returns headers without the headers added by DeadLetterWriter
+func withoutDeadLetterHeaders(headers []kafka.Header) []kafka.Header {
+	var result []kafka.Header
+	for _, h := range headers {
+		if !strings.HasPrefix(h.Key, deadLetterHeaderPrefix) {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+// headerValue returns value of the last header with the key
+func headerValue(headers []kafka.Header, key string) string {
+	var value string
+	for _, h := range headers {
+		if h.Key == key {
+			value = string(h.Value)
+		}
+	}
+	return value
+}
+
+// DeadLetterWriter writes messages that could not be handled to the dead-letter topic
+type DeadLetterWriter struct {
+	writer messageWriter
+}
+
+func NewDeadLetterWriter(brokers []string, topic string) *DeadLetterWriter {
+	return &DeadLetterWriter{writer: newReliableWriter(brokers, topic)}
+}
+
+// Write writes m that failed attempts times with cause to the dead-letter topic.
+// Message keeps its key, value and headers, origin of the message and the error are added as headers
+func (w *DeadLetterWriter) Write(ctx context.Context, m kafka.Message, attempts int, cause error) error {
+	headers := append(withoutDeadLetterHeaders(m.Headers),
+		kafka.Header{Key: HeaderDeadLetterError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDeadLetterTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderDeadLetterPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderDeadLetterOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: HeaderDeadLetterAttempts, Value: []byte(strconv.Itoa(attempts))},
+	)
+	err := w.writer.WriteMessages(ctx, kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	})
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	return nil
+}
+
+func (w *DeadLetterWriter) Close() error {
+	return w.writer.Close()
+}
+
+// DeadLetterReplayer sends messages of the dead-letter topic back to their original topics
+type DeadLetterReplayer struct {
+	reader messageFetcher
+	writer messageWriter
+	logger *zap.Logger
+}
+
+// NewDeadLetterReplayer creates replayer of the dead-letter topic of the reader config.
+// Replayed offsets are committed by a separate consumer group, so every message is replayed once
+func NewDeadLetterReplayer(config *config.KafkaReaderConfig, logger *zap.Logger) (*DeadLetterReplayer, error) {
+	if config.DeadLetterTopic == "" {
+		return nil, errors.New("dead-letter topic is not configured")
+	}
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  config.Brokers,
+		GroupID:  config.GroupId + "-dlq-replay",
+		Topic:    config.DeadLetterTopic,
+		MaxBytes: config.MaxBytes,
+	})
+	return newDeadLetterReplayer(r, newReliableWriter(config.Brokers, ""), logger.With(
+		zap.String("topic", config.DeadLetterTopic),
+		zap.Strings("addr", config.Brokers),
+	)), nil
+}
+
+func newDeadLetterReplayer(reader messageFetcher, writer messageWriter, logger *zap.Logger) *DeadLetterReplayer {
+	return &DeadLetterReplayer{
+		reader: reader,
+		writer: writer,
+		logger: logger,
+	}
+}
+
+// Replay sends messages back until there is no new message for idle, and returns the number of replayed messages
+func (r *DeadLetterReplayer) Replay(ctx context.Context, idle time.Duration) (int, error) {
+	replayed := 0
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, idle)
+		m, err := r.reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				return replayed, nil
+			}
+			return replayed, trace.WrapError(err)
+		}
+
+		topic := headerValue(m.Headers, HeaderDeadLetterTopic)
+		if topic == "" {
+			r.logger.Error("message has no original topic, skipped",
+				zap.Int("partition", m.Partition),
+				zap.Int64("offset", m.Offset),
+			)
+		} else {
+			err = r.writer.WriteMessages(ctx, kafka.Message{
+				Topic:   topic,
+				Key:     m.Key,
+				Value:   m.Value,
+				Headers: withoutDeadLetterHeaders(m.Headers),
+			})
+			if err != nil {
+				return replayed, trace.WrapError(err)
+			}
+			replayed++
+		}
+
+		if err := r.reader.CommitMessages(ctx, m); err != nil {
+			return replayed, trace.WrapError(err)
+		}
+	}
+}
+
+func (r *DeadLetterReplayer) Close() error {
+	return errors.Join(r.reader.Close(), r.writer.Close())
+}
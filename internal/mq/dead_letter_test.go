@@ -0,0 +1,61 @@
+package mq
+
+import (
+	"context"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterReplayer_Replay(t *testing.T) {
+	f := newFakeFetcher()
+	w := &fakeWriter{}
+	r := newDeadLetterReplayer(f, w, zap.NewNop())
+	defer func() { _ = r.Close() }()
+
+	f.messages <- kafka.Message{
+		Offset: 0,
+		Key:    []byte("key"),
+		Value:  []byte("payload"),
+		Headers: []kafka.Header{
+			{Key: "k", Value: []byte("v")},
+			{Key: HeaderDeadLetterError, Value: []byte("malformed")},
+			{Key: HeaderDeadLetterTopic, Value: []byte("url.events")},
+			{Key: HeaderDeadLetterOffset, Value: []byte("7")},
+		},
+	}
+	// message without the original topic is skipped
+	f.messages <- kafka.Message{Offset: 1, Value: []byte("unknown")}
+
+	replayed, err := r.Replay(context.Background(), time.Millisecond*50)
+	require.NoError(t, err)
+	require.Equal(t, 1, replayed)
+	require.Len(t, f.committed(), 2)
+
+	messages, _ := w.written()
+	require.Len(t, messages, 1)
+	require.Equal(t, "url.events", messages[0].Topic)
+	require.Equal(t, "key", string(messages[0].Key))
+	require.Equal(t, "payload", string(messages[0].Value))
+	require.Equal(t, []kafka.Header{{Key: "k", Value: []byte("v")}}, messages[0].Headers)
+}
+
+func TestDeadLetterReplayer_WriteError(t *testing.T) {
+	f := newFakeFetcher()
+	w := &fakeWriter{failures: 1}
+	r := newDeadLetterReplayer(f, w, zap.NewNop())
+	defer func() { _ = r.Close() }()
+
+	f.messages <- kafka.Message{
+		Value:   []byte("payload"),
+		Headers: []kafka.Header{{Key: HeaderDeadLetterTopic, Value: []byte("url.events")}},
+	}
+
+	// message that is not replayed is not committed
+	replayed, err := r.Replay(context.Background(), time.Millisecond*50)
+	require.Error(t, err)
+	require.Zero(t, replayed)
+	require.Empty(t, f.committed())
+}
@@ -0,0 +1,84 @@
+package mq
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sajoniks/GoShort/internal/api/v1/event"
+	"github.com/segmentio/kafka-go"
+)
+
+// ContentTypeHeader is the header with the content type of the message value.
+// Messages without it are json
+const ContentTypeHeader = "content-type"
+
+// Encoding names used in config
+const (
+	EncodingJson     = "json"
+	EncodingProtobuf = "protobuf"
+)
+
+// Encoder encodes values of the messages sent by writers. Messages are sent with ContentTypeHeader
+// of the encoder, so consumers can decode messages of different encodings
+type Encoder interface {
+	ContentType() string
+	Encode(m any) ([]byte, error)
+}
+
+// NewEncoder creates encoder of the configured encoding. Json encoding is used by default
+func NewEncoder(encoding string, registry *event.Registry) (Encoder, error) {
+	switch encoding {
+	case "", EncodingJson:
+		return NewJsonEncoder(registry), nil
+	case EncodingProtobuf:
+		return NewProtobufEncoder(registry), nil
+	default:
+		return nil, fmt.Errorf("unknown message encoding %q", encoding)
+	}
+}
+
+type jsonEncoder struct {
+	registry *event.Registry
+}
+
+// NewJsonEncoder creates encoder of events in json envelopes of the registry, other messages are marshaled as is
+func NewJsonEncoder(registry *event.Registry) Encoder {
+	return &jsonEncoder{registry: registry}
+}
+
+func (e *jsonEncoder) ContentType() string {
+	return event.ContentTypeJson
+}
+
+func (e *jsonEncoder) Encode(m any) ([]byte, error) {
+	if ev, ok := m.(event.Event); ok {
+		return e.registry.Encode(ev)
+	}
+	return json.Marshal(m)
+}
+
+type protobufEncoder struct {
+	registry *event.Registry
+}
+
+// NewProtobufEncoder creates encoder of events in protobuf envelopes of the registry.
+// Events must implement event.ProtoEvent, other messages can not be encoded
+func NewProtobufEncoder(registry *event.Registry) Encoder {
+	return &protobufEncoder{registry: registry}
+}
+
+func (e *protobufEncoder) ContentType() string {
+	return event.ContentTypeProtobuf
+}
+
+func (e *protobufEncoder) Encode(m any) ([]byte, error) {
+	ev, ok := m.(event.Event)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T is not an event", event.ErrNoProtoSchema, m)
+	}
+	return e.registry.EncodeProtobuf(ev)
+}
+
+// DecodeEvent decodes the event of m with the registry, encoding is selected by ContentTypeHeader of m
+func DecodeEvent(registry *event.Registry, m kafka.Message) (event.Envelope, event.Event, error) {
+	return registry.DecodeContent(headerValue(m.Headers, ContentTypeHeader), m.Value)
+}
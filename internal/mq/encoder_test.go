@@ -0,0 +1,63 @@
+package mq
+
+import (
+	"github.com/sajoniks/GoShort/internal/api/v1/event"
+	"github.com/sajoniks/GoShort/internal/api/v1/event/urls"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewEncoder(t *testing.T) {
+	registry := event.NewRegistry("test")
+	for encoding, contentType := range map[string]string{
+		"":               event.ContentTypeJson,
+		EncodingJson:     event.ContentTypeJson,
+		EncodingProtobuf: event.ContentTypeProtobuf,
+	} {
+		e, err := NewEncoder(encoding, registry)
+		require.NoError(t, err)
+		require.Equal(t, contentType, e.ContentType())
+	}
+
+	_, err := NewEncoder("xml", registry)
+	require.Error(t, err)
+}
+
+func TestDecodeEvent(t *testing.T) {
+	registry := event.NewRegistry("test")
+	urls.Register(registry)
+	added := urls.NewAddedEvent("https://example.com", "a")
+
+	for _, encoding := range []string{EncodingJson, EncodingProtobuf} {
+		e, err := NewEncoder(encoding, registry)
+		require.NoError(t, err)
+		value, err := e.Encode(added)
+		require.NoError(t, err)
+
+		_, decoded, err := DecodeEvent(registry, kafka.Message{
+			Value:   value,
+			Headers: []kafka.Header{{Key: ContentTypeHeader, Value: []byte(e.ContentType())}},
+		})
+		require.NoError(t, err, encoding)
+		require.Equal(t, added, decoded)
+	}
+
+	// messages without content type are json
+	value, err := registry.Encode(added)
+	require.NoError(t, err)
+	_, decoded, err := DecodeEvent(registry, kafka.Message{Value: value})
+	require.NoError(t, err)
+	require.Equal(t, added, decoded)
+}
+
+func TestProtobufEncoder_NotEvent(t *testing.T) {
+	e := NewProtobufEncoder(event.NewRegistry("test"))
+	_, err := e.Encode(map[string]string{"type": "url_add"})
+	require.ErrorIs(t, err, event.ErrNoProtoSchema)
+
+	// json encoder marshals other messages as is
+	value, err := NewJsonEncoder(event.NewRegistry("test")).Encode(map[string]string{"type": "url_add"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"url_add"}`, string(value))
+}
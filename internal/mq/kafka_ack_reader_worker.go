@@ -0,0 +1,318 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// messageFetcher is the part of kafka.Reader used by KafkaAckReaderWorker
+type messageFetcher interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// deliveryResult is the outcome of the message handling reported by the consumer
+type deliveryResult struct {
+	err error
+	// rejected message is not delivered again
+	rejected bool
+}
+
+// Delivery is the message received by KafkaAckReaderWorker.
+// Consumer must call one of Ack, Nack or Reject after the message is handled, only the first call counts
+type Delivery struct {
+	kafka.Message
+	// Attempt is the number of the delivery of the message, starting from 1
+	Attempt int
+	once    sync.Once
+	done    chan deliveryResult
+}
+
+// Ack reports that the message was handled, its offset is committed
+func (d *Delivery) Ack() {
+	d.once.Do(func() { d.done <- deliveryResult{} })
+}
+
+// Nack reports that handling failed, the message is delivered again according to the retry policy.
+// Message that failed all attempts is written to the dead-letter topic
+func (d *Delivery) Nack(err error) {
+	d.once.Do(func() { d.done <- deliveryResult{err: deliveryError(err)} })
+}
+
+// Reject reports that the message can never be handled, e.g. it is malformed.
+// Message is written to the dead-letter topic without further attempts
+func (d *Delivery) Reject(err error) {
+	d.once.Do(func() { d.done <- deliveryResult{err: deliveryError(err), rejected: true} })
+}
+
+// partitionQueue keeps fetched messages of a partition until they are delivered.
+// Push never blocks, so a partition waiting for the retry of its message does not stop fetching of other partitions
+type partitionQueue struct {
+	mx       sync.Mutex
+	messages []kafka.Message
+	// ready has a value when messages were pushed since the last pop
+	ready chan struct{}
+}
+
+func newPartitionQueue() *partitionQueue {
+	return &partitionQueue{ready: make(chan struct{}, 1)}
+}
+
+func (q *partitionQueue) push(m kafka.Message) {
+	q.mx.Lock()
+	q.messages = append(q.messages, m)
+	q.mx.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop waits for the oldest message of the queue, false is returned if ctx is done before that
+func (q *partitionQueue) pop(ctx context.Context) (kafka.Message, bool) {
+	for {
+		q.mx.Lock()
+		if len(q.messages) > 0 {
+			m := q.messages[0]
+			q.messages[0] = kafka.Message{}
+			q.messages = q.messages[1:]
+			q.mx.Unlock()
+			return m, true
+		}
+		q.mx.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, false
+		case <-q.ready:
+		}
+	}
+}
+
+func deliveryError(err error) error {
+	if err == nil {
+		return errors.New("message is not acknowledged")
+	}
+	return err
+}
+
+type KafkaAckReaderWorker struct {
+	reader messageFetcher
+	logger *zap.Logger
+	retry  RetryPolicy
+	// deadLetter is nil if dead-letter topic is not configured
+	deadLetter *DeadLetterWriter
+	C          <-chan *Delivery
+	ch         chan *Delivery
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewKafkaAckReaderWorker creates a new instance of KafkaAckReaderWorker that asynchronously reads messages
+// from Kafka. This worker uses "at least once" message processing - offset of the message is committed
+// only after the consumer has acknowledged it, so messages are received again after a crash or a rebalance.
+//
+// # Provided logger is wrapped with namespace, so there is no need to provide already wrapped logger
+//
+// KafkaAckReaderWorker spawns a goroutine that fetches messages from the Kafka and a goroutine per partition,
+// that sends messages of the partition to KafkaAckReaderWorker.C channel one by one:
+// the next message is sent only after the previous one is acknowledged, so messages of a partition
+// are handled in order. Not acknowledged message is sent again according to the retry policy of the config.
+// Message that failed all attempts is written to the dead-letter topic, if it is configured, and committed.
+// Messages of the partition are kept in memory while it waits for the retry, other partitions are not blocked.
+func NewKafkaAckReaderWorker(config *config.KafkaReaderConfig, logger *zap.Logger) *KafkaAckReaderWorker {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  config.Brokers,
+		GroupID:  config.GroupId,
+		Topic:    config.Topic,
+		MaxBytes: config.MaxBytes,
+	})
+	var deadLetter *DeadLetterWriter
+	if config.DeadLetterTopic != "" {
+		deadLetter = NewDeadLetterWriter(config.Brokers, config.DeadLetterTopic)
+	}
+	return newKafkaAckReaderWorker(r, NewRetryPolicy(&config.Retry), deadLetter, logger.With(
+		zap.String("topic", r.Config().Topic),
+		zap.Strings("addr", r.Config().Brokers),
+		zap.String("consumer-group", r.Config().GroupID),
+	))
+}
+
+func newKafkaAckReaderWorker(reader messageFetcher, retry RetryPolicy, deadLetter *DeadLetterWriter, logger *zap.Logger) *KafkaAckReaderWorker {
+	ch := make(chan *Delivery)
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &KafkaAckReaderWorker{
+		reader:     reader,
+		logger:     logger,
+		retry:      retry,
+		deadLetter: deadLetter,
+		C:          ch,
+		ch:         ch,
+		cancel:     cancel,
+	}
+
+	w.wg.Add(1)
+	go w.fetch(ctx)
+	return w
+}
+
+// fetch reads messages and passes them to the goroutines of their partitions
+func (w *KafkaAckReaderWorker) fetch(ctx context.Context) {
+	defer w.wg.Done()
+
+	partitions := make(map[int]*partitionQueue)
+	for {
+		m, err := w.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				w.logger.Info("shutting down reader")
+				return
+			}
+			w.logger.Error("error fetching message", zap.Error(trace.WrapError(err)))
+			sleep(ctx, time.Second)
+			continue
+		}
+
+		w.logger.Info("receive message",
+			zap.Int("partition", m.Partition),
+			zap.Int64("offset", m.Offset),
+			zap.ByteString("key", m.Key),
+		)
+
+		partition, ok := partitions[m.Partition]
+		if !ok {
+			partition = newPartitionQueue()
+			partitions[m.Partition] = partition
+			w.wg.Add(1)
+			go w.handlePartition(ctx, partition)
+		}
+		partition.push(m)
+	}
+}
+
+// handlePartition delivers messages of a single partition in order
+func (w *KafkaAckReaderWorker) handlePartition(ctx context.Context, messages *partitionQueue) {
+	defer w.wg.Done()
+
+	for {
+		m, ok := messages.pop(ctx)
+		if !ok || !w.deliver(ctx, m) {
+			return
+		}
+	}
+}
+
+// sleep waits for d, false is returned if ctx is done before that
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// deliver sends m to the consumer until it is acknowledged or has failed all attempts, then commits its offset.
+// False is returned if the worker was shut down before that
+func (w *KafkaAckReaderWorker) deliver(ctx context.Context, m kafka.Message) bool {
+	log := w.logger.With(zap.Int("partition", m.Partition), zap.Int64("offset", m.Offset))
+	for attempt := 1; ; attempt++ {
+		d := &Delivery{Message: m, Attempt: attempt, done: make(chan deliveryResult, 1)}
+		select {
+		case <-ctx.Done():
+			return false
+		case w.ch <- d:
+		}
+
+		var res deliveryResult
+		select {
+		case <-ctx.Done():
+			return false
+		case res = <-d.done:
+		}
+		if res.err == nil {
+			break
+		}
+
+		if res.rejected || attempt >= w.retry.MaxAttempts {
+			if !w.writeDeadLetter(ctx, m, attempt, res.err, log) {
+				return false
+			}
+			break
+		}
+
+		delay := w.retry.Delay(attempt)
+		log.Warn("message is not acknowledged, redelivering",
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_in", delay),
+			zap.Error(res.err),
+		)
+		if !sleep(ctx, delay) {
+			return false
+		}
+	}
+
+	// failed commit is covered by the commit of the next offset, otherwise the message is received again
+	if err := w.reader.CommitMessages(ctx, m); err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		log.Error("error committing message", zap.Error(trace.WrapError(err)))
+	}
+	return true
+}
+
+// writeDeadLetter writes m that failed attempts times to the dead-letter topic. Failed writes are retried,
+// so the message is not committed until it is written. False is returned if the worker was shut down before that
+func (w *KafkaAckReaderWorker) writeDeadLetter(ctx context.Context, m kafka.Message, attempts int, cause error, log *zap.Logger) bool {
+	if w.deadLetter == nil {
+		log.Error("message has failed, dropped",
+			zap.Int("attempts", attempts),
+			zap.Error(cause),
+		)
+		return true
+	}
+
+	for failures := 1; ; failures++ {
+		err := w.deadLetter.Write(ctx, m, attempts, cause)
+		if err == nil {
+			log.Warn("message has failed, written to dead-letter topic",
+				zap.Int("attempts", attempts),
+				zap.Error(cause),
+			)
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		delay := w.retry.Delay(failures)
+		log.Error("error writing message to dead-letter topic",
+			zap.Duration("retry_in", delay),
+			zap.Error(err),
+		)
+		if !sleep(ctx, delay) {
+			return false
+		}
+	}
+}
+
+// Shutdown stops reading. Messages that are not acknowledged yet are received again after restart
+func (w *KafkaAckReaderWorker) Shutdown() {
+	w.cancel()
+	w.wg.Wait()
+	_ = w.reader.Close()
+	if w.deadLetter != nil {
+		_ = w.deadLetter.Close()
+	}
+}
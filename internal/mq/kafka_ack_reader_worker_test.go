@@ -0,0 +1,284 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFetcher returns messages sent to it and records committed offsets
+type fakeFetcher struct {
+	messages chan kafka.Message
+	mx       sync.Mutex
+	commits  []kafka.Message
+}
+
+func newFakeFetcher() *fakeFetcher {
+	return &fakeFetcher{messages: make(chan kafka.Message, 16)}
+}
+
+func (f *fakeFetcher) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	case m := <-f.messages:
+		return m, nil
+	}
+}
+
+func (f *fakeFetcher) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.commits = append(f.commits, msgs...)
+	return nil
+}
+
+func (f *fakeFetcher) Close() error {
+	return nil
+}
+
+func (f *fakeFetcher) committed() []kafka.Message {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return append([]kafka.Message(nil), f.commits...)
+}
+
+func (f *fakeFetcher) send(partition int, offset int64) {
+	f.messages <- kafka.Message{Partition: partition, Offset: offset}
+}
+
+func newTestAckReader(f *fakeFetcher, maxAttempts int, deadLetter *fakeWriter) *KafkaAckReaderWorker {
+	retry := RetryPolicy{MaxAttempts: maxAttempts, Backoff: time.Millisecond * 10, MaxBackoff: time.Millisecond * 10}
+	var dlq *DeadLetterWriter
+	if deadLetter != nil {
+		dlq = &DeadLetterWriter{writer: deadLetter}
+	}
+	return newKafkaAckReaderWorker(f, retry, dlq, zap.NewNop())
+}
+
+func receive(t *testing.T, w *KafkaAckReaderWorker) *Delivery {
+	select {
+	case d := <-w.C:
+		return d
+	case <-time.After(time.Second):
+		require.FailNow(t, "message is not delivered")
+		return nil
+	}
+}
+
+func requireNothingDelivered(t *testing.T, w *KafkaAckReaderWorker) {
+	select {
+	case d := <-w.C:
+		require.FailNow(t, "unexpected delivery", "partition %d offset %d", d.Partition, d.Offset)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func TestKafkaAckReaderWorker_CommitAfterAck(t *testing.T) {
+	f := newFakeFetcher()
+	w := newTestAckReader(f, 3, nil)
+	defer w.Shutdown()
+
+	f.send(0, 0)
+	d := receive(t, w)
+	require.Equal(t, int64(0), d.Offset)
+	require.Empty(t, f.committed())
+
+	d.Ack()
+	require.Eventually(t, func() bool {
+		return len(f.committed()) == 1
+	}, time.Second, time.Millisecond*10)
+	require.Equal(t, int64(0), f.committed()[0].Offset)
+}
+
+func TestKafkaAckReaderWorker_OrderedPerPartition(t *testing.T) {
+	f := newFakeFetcher()
+	w := newTestAckReader(f, 3, nil)
+	defer w.Shutdown()
+
+	f.send(0, 0)
+	f.send(0, 1)
+	f.send(1, 0)
+
+	// partitions are handled concurrently
+	first, second := receive(t, w), receive(t, w)
+	require.NotEqual(t, first.Partition, second.Partition)
+	for _, d := range []*Delivery{first, second} {
+		require.Equal(t, int64(0), d.Offset)
+	}
+
+	// the next message of the partition waits for the previous one
+	requireNothingDelivered(t, w)
+	first.Ack()
+	second.Ack()
+	next := receive(t, w)
+	require.Equal(t, 0, next.Partition)
+	require.Equal(t, int64(1), next.Offset)
+	next.Ack()
+
+	require.Eventually(t, func() bool {
+		return len(f.committed()) == 3
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestKafkaAckReaderWorker_Nack(t *testing.T) {
+	f := newFakeFetcher()
+	w := newTestAckReader(f, 3, nil)
+	defer w.Shutdown()
+
+	f.send(0, 0)
+	f.send(0, 1)
+
+	d := receive(t, w)
+	d.Nack(errors.New("handler failed"))
+	// only the first call counts
+	d.Ack()
+
+	again := receive(t, w)
+	require.Equal(t, int64(0), again.Offset)
+	require.Empty(t, f.committed())
+
+	again.Ack()
+	next := receive(t, w)
+	require.Equal(t, int64(1), next.Offset)
+	require.Len(t, f.committed(), 1)
+}
+
+func TestKafkaAckReaderWorker_RetryDoesNotBlockPartitions(t *testing.T) {
+	f := newFakeFetcher()
+	retry := RetryPolicy{MaxAttempts: 3, Backoff: time.Second * 5, MaxBackoff: time.Second * 5}
+	w := newKafkaAckReaderWorker(f, retry, nil, zap.NewNop())
+	defer w.Shutdown()
+
+	f.send(0, 0)
+	receive(t, w).Nack(errors.New("handler failed"))
+
+	// partition 0 waits for the retry, its messages must not stop fetching of partition 1
+	go func() {
+		for offset := int64(1); offset <= 100; offset++ {
+			f.send(0, offset)
+		}
+		f.send(1, 0)
+	}()
+	d := receive(t, w)
+	require.Equal(t, 1, d.Partition)
+	require.Equal(t, int64(0), d.Offset)
+	d.Ack()
+
+	require.Eventually(t, func() bool {
+		return len(f.committed()) == 1
+	}, time.Second, time.Millisecond*10)
+	require.Equal(t, 1, f.committed()[0].Partition)
+}
+
+func TestKafkaAckReaderWorker_ShutdownWithoutAck(t *testing.T) {
+	f := newFakeFetcher()
+	w := newTestAckReader(f, 3, nil)
+
+	f.send(0, 0)
+	d := receive(t, w)
+	w.Shutdown()
+
+	// late acknowledgement does not block and does not commit
+	d.Ack()
+	require.Empty(t, f.committed())
+}
+
+func requireDeadLettered(t *testing.T, w *fakeWriter, cause string, attempts string) {
+	require.Eventually(t, func() bool {
+		messages, _ := w.written()
+		return len(messages) == 1
+	}, time.Second, time.Millisecond*10)
+
+	messages, _ := w.written()
+	m := messages[0]
+	require.Equal(t, "payload", string(m.Value))
+	require.Equal(t, "v", headerValue(m.Headers, "k"))
+	require.Equal(t, cause, headerValue(m.Headers, HeaderDeadLetterError))
+	require.Equal(t, "url.events", headerValue(m.Headers, HeaderDeadLetterTopic))
+	require.Equal(t, "2", headerValue(m.Headers, HeaderDeadLetterPartition))
+	require.Equal(t, "7", headerValue(m.Headers, HeaderDeadLetterOffset))
+	require.Equal(t, attempts, headerValue(m.Headers, HeaderDeadLetterAttempts))
+}
+
+func sendFailing(f *fakeFetcher) {
+	f.messages <- kafka.Message{
+		Topic:     "url.events",
+		Partition: 2,
+		Offset:    7,
+		Value:     []byte("payload"),
+		Headers:   []kafka.Header{{Key: "k", Value: []byte("v")}},
+	}
+}
+
+func TestKafkaAckReaderWorker_DeadLetterAfterMaxAttempts(t *testing.T) {
+	f := newFakeFetcher()
+	dlq := &fakeWriter{}
+	w := newTestAckReader(f, 2, dlq)
+	defer w.Shutdown()
+
+	sendFailing(f)
+	for attempt := 1; attempt <= 2; attempt++ {
+		d := receive(t, w)
+		require.Equal(t, attempt, d.Attempt)
+		d.Nack(errors.New("handler failed"))
+	}
+
+	requireDeadLettered(t, dlq, "handler failed", "2")
+	require.Eventually(t, func() bool {
+		return len(f.committed()) == 1
+	}, time.Second, time.Millisecond*10)
+	requireNothingDelivered(t, w)
+}
+
+func TestKafkaAckReaderWorker_Reject(t *testing.T) {
+	f := newFakeFetcher()
+	dlq := &fakeWriter{}
+	w := newTestAckReader(f, 3, dlq)
+	defer w.Shutdown()
+
+	sendFailing(f)
+	receive(t, w).Reject(errors.New("malformed"))
+
+	// rejected message is not delivered again
+	requireDeadLettered(t, dlq, "malformed", "1")
+	requireNothingDelivered(t, w)
+}
+
+func TestKafkaAckReaderWorker_DeadLetterRetry(t *testing.T) {
+	f := newFakeFetcher()
+	dlq := &fakeWriter{failures: 2}
+	w := newTestAckReader(f, 1, dlq)
+	defer w.Shutdown()
+
+	sendFailing(f)
+	receive(t, w).Nack(errors.New("handler failed"))
+
+	// message is committed only after it is written to the dead-letter topic
+	requireDeadLettered(t, dlq, "handler failed", "1")
+	_, writes := dlq.written()
+	require.Equal(t, 3, writes)
+	require.Eventually(t, func() bool {
+		return len(f.committed()) == 1
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestKafkaAckReaderWorker_NoDeadLetterTopic(t *testing.T) {
+	f := newFakeFetcher()
+	w := newTestAckReader(f, 1, nil)
+	defer w.Shutdown()
+
+	f.send(0, 0)
+	f.send(0, 1)
+	receive(t, w).Nack(errors.New("handler failed"))
+
+	// failed message is dropped and the partition moves on
+	next := receive(t, w)
+	require.Equal(t, int64(1), next.Offset)
+	require.Len(t, f.committed(), 1)
+}
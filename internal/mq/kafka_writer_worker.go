@@ -2,17 +2,18 @@ package mq
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"github.com/sajoniks/GoShort/internal/config"
-	"github.com/sajoniks/GoShort/internal/task"
 	"github.com/sajoniks/GoShort/internal/trace"
 	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
 )
 
+// KafkaWriterWorkerInterface sends messages encoded by the Encoder of the writer. Values of event.Event are sent in envelopes.
+// Messages are json unless the writer is configured with another encoding
 type KafkaWriterWorkerInterface interface {
 	AddJsonMessage(m any)
+	// AddJsonMessages sends all messages with a single write
+	AddJsonMessages(ms ...any)
 }
 
 type writerNoOp struct{}
@@ -20,14 +21,26 @@ type writerNoOp struct{}
 func (k writerNoOp) AddJsonMessage(any) {
 }
 
+func (k writerNoOp) AddJsonMessages(...any) {
+}
+
 func NewWriterNoOp() KafkaWriterWorkerInterface {
 	return &writerNoOp{}
 }
 
+// queuedMessages is the number of batches queued for sending, adding messages blocks when the queue is full
+const queuedMessages = 10
+
 type KafkaWriterWorker struct {
-	writer *kafka.Writer
-	logger *zap.Logger
-	pool   *task.Pool
+	writer    messageWriter
+	encoder   Encoder
+	key       KeyFunc
+	logger    *zap.Logger
+	batchSize int
+	// async writes are logged by the completion of the writer
+	async bool
+	queue chan []kafka.Message
+	done  chan struct{}
 }
 
 // NewKafkaWriterWorker Creates a new KafkaWriterWorker instance
@@ -35,47 +48,138 @@ type KafkaWriterWorker struct {
 // Provided logger is wrapped with namespace, so
 // there is no need to pass already wrapped logger
 //
-// Worker utilizes task.Pool
-// asynchronously sending messages to the queue
-func NewKafkaWriterWorker(config *config.KafkaWriterConfig, logger *zap.Logger) *KafkaWriterWorker {
-	w := &kafka.Writer{
-		Addr:  kafka.TCP(config.Brokers...),
-		Topic: config.Topic,
+// Worker sends messages from a single goroutine in the order they are added, messages added meanwhile
+// are sent with the same write. Messages are encoded with the encoder and keyed by the configured strategy
+func NewKafkaWriterWorker(config *config.KafkaWriterConfig, encoder Encoder, logger *zap.Logger) (*KafkaWriterWorker, error) {
+	key, err := NewKeyFunc(config.Key)
+	if err != nil {
+		return nil, err
+	}
+	w, err := newWriter(config)
+	if err != nil {
+		return nil, err
+	}
+	logger = logger.With(
+		zap.String("topic", w.Topic),
+		zap.String("addr", w.Addr.String()),
+	)
+	if w.Async {
+		w.Completion = func(messages []kafka.Message, err error) {
+			if err != nil {
+				logger.Error("error writing messages",
+					zap.Int("count", len(messages)),
+					zap.Error(trace.WrapError(err)),
+				)
+			} else {
+				logger.Info("sent messages", zap.Int("count", len(messages)))
+			}
+		}
 	}
-	writer := &KafkaWriterWorker{
-		writer: w,
-		pool:   task.NewPool(8, logger.With(zap.Namespace("kafka_pool"))),
-		logger: logger.With(
-			zap.String("topic", w.Topic),
-			zap.String("addr", w.Addr.String()),
-		),
+	return newKafkaWriterWorker(w, encoder, key, w.BatchSize, w.Async, logger), nil
+}
+
+func newKafkaWriterWorker(writer messageWriter, encoder Encoder, key KeyFunc, batchSize int, async bool, logger *zap.Logger) *KafkaWriterWorker {
+	k := &KafkaWriterWorker{
+		writer:    writer,
+		encoder:   encoder,
+		key:       key,
+		logger:    logger,
+		batchSize: batchSize,
+		async:     async,
+		queue:     make(chan []kafka.Message, queuedMessages),
+		done:      make(chan struct{}),
 	}
-	return writer
+	go k.run()
+	return k
 }
 
+// Shutdown sends queued messages and closes the writer
 func (k *KafkaWriterWorker) Shutdown() {
-	k.pool.Shutdown()
+	close(k.queue)
+	<-k.done
+	if err := k.writer.Close(); err != nil {
+		k.logger.Error("error closing writer", zap.Error(trace.WrapError(err)))
+	}
+}
+
+// Stats returns stats of the writer since the previous call
+func (k *KafkaWriterWorker) Stats() kafka.WriterStats {
+	if s, ok := k.writer.(StatsWriter); ok {
+		return s.Stats()
+	}
+	return kafka.WriterStats{}
+}
+
+// message creates kafka message of the encoded m
+func (k *KafkaWriterWorker) message(m any) (kafka.Message, error) {
+	bs, err := k.encoder.Encode(m)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return kafka.Message{
+		Key:     messageKey(k.key(m)),
+		Value:   bs,
+		Headers: []kafka.Header{{Key: ContentTypeHeader, Value: []byte(k.encoder.ContentType())}},
+	}, nil
 }
 
 func (k *KafkaWriterWorker) AddJsonMessage(m any) {
-	k.pool.AddFunc(func(ctx context.Context) {
-		bs, err := json.Marshal(m)
+	k.AddJsonMessages(m)
+}
+
+func (k *KafkaWriterWorker) AddJsonMessages(ms ...any) {
+	if len(ms) == 0 {
+		return
+	}
+	// messages are encoded right away, so events occur at the time they are added
+	msgs := make([]kafka.Message, 0, len(ms))
+	for _, m := range ms {
+		msg, err := k.message(m)
 		if err != nil {
 			k.logger.Error("error marshaling message",
 				zap.Error(trace.WrapError(err)),
 			)
+			continue
 		}
-		err = k.writer.WriteMessages(ctx, kafka.Message{Value: bs})
-		if err != nil {
-			if errors.Is(err, context.Canceled) {
-				k.logger.Error("write cancelled")
-			} else {
-				k.logger.Error("error writing message",
-					zap.Error(trace.WrapError(err)),
-				)
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) > 0 {
+		k.queue <- msgs
+	}
+}
+
+func (k *KafkaWriterWorker) run() {
+	defer close(k.done)
+
+	for msgs := range k.queue {
+		batch := msgs
+		// messages queued meanwhile are sent with the same write
+	collect:
+		for len(batch) < k.batchSize {
+			select {
+			case more, ok := <-k.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, more...)
+			default:
+				break collect
 			}
-		} else {
-			k.logger.Info("sent message")
 		}
-	})
+		k.write(batch)
+	}
+}
+
+func (k *KafkaWriterWorker) write(msgs []kafka.Message) {
+	err := k.writer.WriteMessages(context.Background(), msgs...)
+	if err != nil {
+		k.logger.Error("error writing messages",
+			zap.Int("count", len(msgs)),
+			zap.Error(trace.WrapError(err)),
+		)
+		return
+	}
+	if !k.async {
+		k.logger.Info("sent messages", zap.Int("count", len(msgs)))
+	}
 }
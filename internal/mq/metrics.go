@@ -0,0 +1,141 @@
+package mq
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"sync"
+	"time"
+)
+
+// StatsWriter is implemented by writers that report stats of kafka.Writer
+type StatsWriter interface {
+	// Stats returns stats since the previous call, counters are reset on every call
+	Stats() kafka.WriterStats
+}
+
+// durationSummary is the total count and sum of kafka.DurationStats
+type durationSummary struct {
+	count uint64
+	sum   time.Duration
+}
+
+func (s *durationSummary) add(stats kafka.DurationStats) {
+	s.count += uint64(stats.Count)
+	s.sum += stats.Sum
+}
+
+// sizeSummary is the total count and sum of kafka.SummaryStats
+type sizeSummary struct {
+	count uint64
+	sum   int64
+}
+
+func (s *sizeSummary) add(stats kafka.SummaryStats) {
+	s.count += uint64(stats.Count)
+	s.sum += stats.Sum
+}
+
+// WriterMetrics exports stats of the writer as Prometheus metrics. Writer resets its counters on every Stats call,
+// so metrics keep the totals and nothing else must read stats of the writer
+type WriterMetrics struct {
+	writer StatsWriter
+
+	mx             sync.Mutex
+	writes         uint64
+	messages       uint64
+	bytes          uint64
+	errors         uint64
+	retries        uint64
+	batchTime      durationSummary
+	batchQueueTime durationSummary
+	writeTime      durationSummary
+	waitTime       durationSummary
+	batchSize      sizeSummary
+	batchBytes     sizeSummary
+
+	writesDesc         *prometheus.Desc
+	messagesDesc       *prometheus.Desc
+	bytesDesc          *prometheus.Desc
+	errorsDesc         *prometheus.Desc
+	retriesDesc        *prometheus.Desc
+	batchTimeDesc      *prometheus.Desc
+	batchQueueTimeDesc *prometheus.Desc
+	writeTimeDesc      *prometheus.Desc
+	waitTimeDesc       *prometheus.Desc
+	batchSizeDesc      *prometheus.Desc
+	batchBytesDesc     *prometheus.Desc
+}
+
+func NewWriterMetrics(reg prometheus.Registerer, writer StatsWriter) *WriterMetrics {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("goshort", "kafka_writer", name), help, []string{"topic"}, nil)
+	}
+	m := &WriterMetrics{
+		writer:             writer,
+		writesDesc:         desc("write", "count of writes to kafka"),
+		messagesDesc:       desc("message", "count of messages written to kafka"),
+		bytesDesc:          desc("message_bytes", "size of messages written to kafka"),
+		errorsDesc:         desc("error", "count of failed writes to kafka"),
+		retriesDesc:        desc("retry", "count of retried writes to kafka"),
+		batchTimeDesc:      desc("batch_seconds", "time batches are collected and written"),
+		batchQueueTimeDesc: desc("batch_queue_seconds", "time batches wait in the queue of the writer"),
+		writeTimeDesc:      desc("write_seconds", "duration of writes to kafka"),
+		waitTimeDesc:       desc("wait_seconds", "time writes wait for a response of kafka"),
+		batchSizeDesc:      desc("batch_size", "count of messages in the written batches"),
+		batchBytesDesc:     desc("batch_bytes", "size of the written batches"),
+	}
+	reg.MustRegister(m)
+	return m
+}
+
+func (m *WriterMetrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		m.writesDesc, m.messagesDesc, m.bytesDesc, m.errorsDesc, m.retriesDesc,
+		m.batchTimeDesc, m.batchQueueTimeDesc, m.writeTimeDesc, m.waitTimeDesc, m.batchSizeDesc, m.batchBytesDesc,
+	} {
+		ch <- d
+	}
+}
+
+func (m *WriterMetrics) Collect(ch chan<- prometheus.Metric) {
+	stats := m.writer.Stats()
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.writes += uint64(stats.Writes)
+	m.messages += uint64(stats.Messages)
+	m.bytes += uint64(stats.Bytes)
+	m.errors += uint64(stats.Errors)
+	m.retries += uint64(stats.Retries)
+	m.batchTime.add(stats.BatchTime)
+	m.batchQueueTime.add(stats.BatchQueueTime)
+	m.writeTime.add(stats.WriteTime)
+	m.waitTime.add(stats.WaitTime)
+	m.batchSize.add(stats.BatchSize)
+	m.batchBytes.add(stats.BatchBytes)
+
+	for d, v := range map[*prometheus.Desc]uint64{
+		m.writesDesc:   m.writes,
+		m.messagesDesc: m.messages,
+		m.bytesDesc:    m.bytes,
+		m.errorsDesc:   m.errors,
+		m.retriesDesc:  m.retries,
+	} {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(v), stats.Topic)
+	}
+	for d, s := range map[*prometheus.Desc]durationSummary{
+		m.batchTimeDesc:      m.batchTime,
+		m.batchQueueTimeDesc: m.batchQueueTime,
+		m.writeTimeDesc:      m.writeTime,
+		m.waitTimeDesc:       m.waitTime,
+	} {
+		ch <- prometheus.MustNewConstSummary(d, s.count, s.sum.Seconds(), nil, stats.Topic)
+	}
+	for d, s := range map[*prometheus.Desc]sizeSummary{
+		m.batchSizeDesc:  m.batchSize,
+		m.batchBytesDesc: m.batchBytes,
+	} {
+		ch <- prometheus.MustNewConstSummary(d, s.count, float64(s.sum), nil, stats.Topic)
+	}
+}
@@ -0,0 +1,53 @@
+package mq
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statsWriter returns the same stats on every call, like a writer with the same load between scrapes
+type statsWriter struct {
+	stats kafka.WriterStats
+}
+
+func (w statsWriter) Stats() kafka.WriterStats {
+	return w.stats
+}
+
+func TestWriterMetrics(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	NewWriterMetrics(reg, statsWriter{stats: kafka.WriterStats{
+		Topic:     "events",
+		Writes:    2,
+		Messages:  5,
+		Errors:    1,
+		WriteTime: kafka.DurationStats{Count: 2, Sum: time.Second},
+		BatchSize: kafka.SummaryStats{Count: 2, Sum: 5},
+	}})
+
+	// writer resets its counters, so metrics are the totals of all scrapes
+	_, err := reg.Gather()
+	require.NoError(t, err)
+	err = testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP goshort_kafka_writer_message count of messages written to kafka
+# TYPE goshort_kafka_writer_message counter
+goshort_kafka_writer_message{topic="events"} 10
+# HELP goshort_kafka_writer_error count of failed writes to kafka
+# TYPE goshort_kafka_writer_error counter
+goshort_kafka_writer_error{topic="events"} 2
+# HELP goshort_kafka_writer_write_seconds duration of writes to kafka
+# TYPE goshort_kafka_writer_write_seconds summary
+goshort_kafka_writer_write_seconds_sum{topic="events"} 2
+goshort_kafka_writer_write_seconds_count{topic="events"} 4
+# HELP goshort_kafka_writer_batch_size count of messages in the written batches
+# TYPE goshort_kafka_writer_batch_size summary
+goshort_kafka_writer_batch_size_sum{topic="events"} 10
+goshort_kafka_writer_batch_size_count{topic="events"} 4
+`), "goshort_kafka_writer_message", "goshort_kafka_writer_error", "goshort_kafka_writer_write_seconds", "goshort_kafka_writer_batch_size")
+	require.NoError(t, err)
+}
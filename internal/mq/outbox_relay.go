@@ -0,0 +1,184 @@
+package mq
+
+import (
+	"context"
+	"github.com/sajoniks/GoShort/internal/api/v1/event"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultOutboxBatchSize    = 100
+	DefaultOutboxPollInterval = time.Second
+	DefaultOutboxMaxBackoff   = time.Second * 30
+
+	// OutboxIdHeader is the header with the outbox id of the message.
+	// Message may be delivered more than once, consumers can use it to drop duplicates
+	OutboxIdHeader = "outbox-id"
+)
+
+// messageWriter is the part of kafka.Writer used by OutboxRelay
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// OutboxRelay publishes messages of the store outbox to Kafka and removes published messages from the outbox.
+// Failed publishing is retried with jittered exponential backoff. Messages are removed only after Kafka
+// has acknowledged them, so every message is delivered at least once
+type OutboxRelay struct {
+	outbox       urlstore.Outbox
+	writer       messageWriter
+	logger       *zap.Logger
+	batchSize    int
+	pollInterval time.Duration
+	maxBackoff   time.Duration
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+// NewOutboxRelay creates OutboxRelay that publishes messages to the topic of writerConfig.
+// Relay writes are never async, messages are removed from the outbox once the write returns
+//
+// Provided logger is wrapped with namespace, so
+// there is no need to pass already wrapped logger
+//
+// OutboxRelay spawns a goroutine that polls the outbox until Shutdown is called
+func NewOutboxRelay(outbox urlstore.Outbox, writerConfig *config.KafkaWriterConfig, config *config.OutboxConfig, logger *zap.Logger) (*OutboxRelay, error) {
+	w, err := newWriter(writerConfig)
+	if err != nil {
+		return nil, err
+	}
+	w.Async = false
+	return newOutboxRelay(outbox, w, config, logger.With(
+		zap.String("topic", w.Topic),
+		zap.String("addr", w.Addr.String()),
+	)), nil
+}
+
+func newOutboxRelay(outbox urlstore.Outbox, writer messageWriter, config *config.OutboxConfig, logger *zap.Logger) *OutboxRelay {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &OutboxRelay{
+		outbox:       outbox,
+		writer:       writer,
+		logger:       logger.With(zap.Namespace("outbox_relay")),
+		batchSize:    config.BatchSize,
+		pollInterval: config.PollInterval,
+		maxBackoff:   config.MaxBackoff,
+		cancel:       cancel,
+	}
+	if r.batchSize <= 0 {
+		r.batchSize = DefaultOutboxBatchSize
+	}
+	if r.pollInterval <= 0 {
+		r.pollInterval = DefaultOutboxPollInterval
+	}
+	if r.maxBackoff <= 0 {
+		r.maxBackoff = DefaultOutboxMaxBackoff
+	}
+
+	r.wg.Add(1)
+	go r.run(ctx)
+	return r
+}
+
+// Stats returns stats of the writer since the previous call
+func (r *OutboxRelay) Stats() kafka.WriterStats {
+	if s, ok := r.writer.(StatsWriter); ok {
+		return s.Stats()
+	}
+	return kafka.WriterStats{}
+}
+
+// Shutdown stops publishing, messages that are not published yet stay in the outbox
+func (r *OutboxRelay) Shutdown() {
+	r.cancel()
+	r.wg.Wait()
+	_ = r.writer.Close()
+}
+
+func (r *OutboxRelay) run(ctx context.Context) {
+	defer r.wg.Done()
+
+	failures := 0
+	for {
+		n, err := r.relay(ctx)
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				r.logger.Info("shutting down relay")
+				return
+			}
+			failures++
+			wait = RetryPolicy{Backoff: r.pollInterval, MaxBackoff: r.maxBackoff}.Delay(failures)
+			r.logger.Error("error relaying messages",
+				zap.Int("failures", failures),
+				zap.Duration("retry_in", wait),
+				zap.Error(err),
+			)
+		case n == r.batchSize:
+			// there may be more pending messages
+			failures = 0
+			continue
+		default:
+			failures = 0
+			wait = r.pollInterval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			r.logger.Info("shutting down relay")
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// relay publishes a single batch of pending messages and returns its size
+func (r *OutboxRelay) relay(ctx context.Context) (int, error) {
+	pending, err := r.outbox.PendingMessages(r.batchSize)
+	if err != nil {
+		return 0, trace.WrapError(err)
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	msgs := make([]kafka.Message, len(pending))
+	ids := make([]int64, len(pending))
+	for i, m := range pending {
+		contentType := m.ContentType
+		if contentType == "" {
+			// messages stored before content types were added
+			contentType = event.ContentTypeJson
+		}
+		msgs[i] = kafka.Message{
+			Key:   messageKey(m.Key),
+			Value: m.Payload,
+			Headers: []kafka.Header{
+				{Key: OutboxIdHeader, Value: []byte(strconv.FormatInt(m.ID, 10))},
+				{Key: ContentTypeHeader, Value: []byte(contentType)},
+			},
+		}
+		ids[i] = m.ID
+	}
+	if err := r.writer.WriteMessages(ctx, msgs...); err != nil {
+		return 0, trace.WrapError(err)
+	}
+	// if removal fails, published messages are sent again
+	if err := r.outbox.MarkSent(ids...); err != nil {
+		return 0, trace.WrapError(err)
+	}
+
+	r.logger.Info("relayed messages", zap.Int("count", len(pending)))
+	return len(pending), nil
+}
@@ -0,0 +1,194 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"github.com/sajoniks/GoShort/internal/api/v1/event"
+	"github.com/sajoniks/GoShort/internal/api/v1/event/urls"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/store/memory"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeWriter collects written messages, the first failures writes fail
+type fakeWriter struct {
+	mx       sync.Mutex
+	failures int
+	writes   int
+	messages []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	w.writes++
+	if w.writes <= w.failures {
+		return errors.New("broker is unavailable")
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	return nil
+}
+
+func (w *fakeWriter) written() ([]kafka.Message, int) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	return append([]kafka.Message(nil), w.messages...), w.writes
+}
+
+func newTestOutbox(t *testing.T) (urlstore.Store, urlstore.Outbox) {
+	s := memory.NewMemoryStore()
+	t.Cleanup(s.Close)
+	return s, s.(urlstore.Outbox)
+}
+
+// outboxMessages creates json messages with the payloads
+func outboxMessages(payloads ...string) []urlstore.OutboxMessage {
+	messages := make([]urlstore.OutboxMessage, 0, len(payloads))
+	for _, p := range payloads {
+		messages = append(messages, urlstore.OutboxMessage{ContentType: event.ContentTypeJson, Payload: []byte(p)})
+	}
+	return messages
+}
+
+func requireRelayed(t *testing.T, w *fakeWriter, outbox urlstore.Outbox, payloads ...string) {
+	require.Eventually(t, func() bool {
+		pending, err := outbox.PendingMessages(10)
+		require.NoError(t, err)
+		messages, _ := w.written()
+		return len(pending) == 0 && len(messages) == len(payloads)
+	}, time.Second, time.Millisecond*10)
+
+	messages, _ := w.written()
+	for i, payload := range payloads {
+		require.Equal(t, payload, string(messages[i].Value))
+		require.Equal(t, OutboxIdHeader, messages[i].Headers[0].Key)
+		require.Equal(t, event.ContentTypeJson, headerValue(messages[i].Headers, ContentTypeHeader))
+	}
+}
+
+func TestOutboxRelay_Publishes(t *testing.T) {
+	_, outbox := newTestOutbox(t)
+	w := &fakeWriter{}
+	r := newOutboxRelay(outbox, w, &config.OutboxConfig{PollInterval: time.Millisecond * 10}, zap.NewNop())
+	defer r.Shutdown()
+
+	require.NoError(t, outbox.AddMessages(outboxMessages("a", "b")...))
+	requireRelayed(t, w, outbox, "a", "b")
+
+	// messages added later are picked up on the next poll, messages without content type are json
+	require.NoError(t, outbox.AddMessages(urlstore.OutboxMessage{Key: "alias", Payload: []byte("c")}))
+	requireRelayed(t, w, outbox, "a", "b", "c")
+
+	messages, _ := w.written()
+	require.Nil(t, messages[0].Key)
+	require.Equal(t, "alias", string(messages[2].Key))
+}
+
+func TestOutboxRelay_Batches(t *testing.T) {
+	_, outbox := newTestOutbox(t)
+	require.NoError(t, outbox.AddMessages(outboxMessages("a", "b", "c", "d", "e")...))
+
+	w := &fakeWriter{}
+	r := newOutboxRelay(outbox, w, &config.OutboxConfig{BatchSize: 2, PollInterval: time.Hour}, zap.NewNop())
+	defer r.Shutdown()
+
+	// full batches are followed by the next one without waiting for the poll interval
+	requireRelayed(t, w, outbox, "a", "b", "c", "d", "e")
+	_, writes := w.written()
+	require.Equal(t, 3, writes)
+}
+
+func TestOutboxRelay_Retry(t *testing.T) {
+	_, outbox := newTestOutbox(t)
+	require.NoError(t, outbox.AddMessages(outboxMessages("a", "b")...))
+
+	w := &fakeWriter{failures: 2}
+	r := newOutboxRelay(outbox, w, &config.OutboxConfig{
+		PollInterval: time.Millisecond * 10,
+		MaxBackoff:   time.Millisecond * 20,
+	}, zap.NewNop())
+	defer r.Shutdown()
+
+	// failed messages stay in the outbox and are sent once
+	requireRelayed(t, w, outbox, "a", "b")
+	_, writes := w.written()
+	require.Equal(t, 3, writes)
+}
+
+func TestWithJsonMessages(t *testing.T) {
+	s, outbox := newTestOutbox(t)
+
+	added := urls.NewAddedEvent("https://example.com", "direct")
+	opt, ok := WithJsonMessages(NewWriterNoOp(), added)
+	require.False(t, ok)
+	_, err := s.SaveURL("https://example.com", "direct", opt)
+	require.NoError(t, err)
+
+	registry := event.NewRegistry("test")
+	urls.Register(registry)
+	w := NewOutboxWriter(outbox, NewJsonEncoder(registry), EventKey, zap.NewNop())
+	opt, ok = WithJsonMessages(w, urls.NewAddedEvent("https://example.com", "outbox"))
+	require.True(t, ok)
+	_, err = s.SaveURL("https://example.com", "outbox", opt)
+	require.NoError(t, err)
+
+	w.AddJsonMessage(urls.NewDeletedEvent("outbox"))
+
+	pending, err := outbox.PendingMessages(10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	for i, want := range []event.Event{
+		urls.NewAddedEvent("https://example.com", "outbox"),
+		urls.NewDeletedEvent("outbox"),
+	} {
+		require.Equal(t, event.ContentTypeJson, pending[i].ContentType)
+		require.Equal(t, "outbox", pending[i].Key)
+		env, e, err := registry.Decode(pending[i].Payload)
+		require.NoError(t, err)
+		require.Equal(t, "test", env.Producer)
+		require.Equal(t, want, e)
+	}
+}
+
+func TestOutboxWriter_Protobuf(t *testing.T) {
+	s, outbox := newTestOutbox(t)
+	registry := event.NewRegistry("test")
+	urls.Register(registry)
+	w := NewOutboxWriter(outbox, NewProtobufEncoder(registry), EventKey, zap.NewNop())
+
+	added := urls.NewAddedEvent("https://example.com", "outbox")
+	opt, ok := WithJsonMessages(w, added)
+	require.True(t, ok)
+	_, err := s.SaveURL("https://example.com", "outbox", opt)
+	require.NoError(t, err)
+
+	pending, err := outbox.PendingMessages(10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, event.ContentTypeProtobuf, pending[0].ContentType)
+
+	// relay sends the stored content type
+	fw := &fakeWriter{}
+	r := newOutboxRelay(outbox, fw, &config.OutboxConfig{PollInterval: time.Millisecond * 10}, zap.NewNop())
+	defer r.Shutdown()
+	require.Eventually(t, func() bool {
+		messages, _ := fw.written()
+		return len(messages) == 1
+	}, time.Second, time.Millisecond*10)
+
+	messages, _ := fw.written()
+	_, e, err := DecodeEvent(registry, messages[0])
+	require.NoError(t, err)
+	require.Equal(t, added, e)
+}
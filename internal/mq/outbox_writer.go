@@ -0,0 +1,78 @@
+package mq
+
+import (
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"go.uber.org/zap"
+)
+
+// OutboxWriter writes messages to the store outbox instead of sending them to Kafka.
+// Messages are sent by OutboxRelay, so they are not lost when Kafka is unavailable
+type OutboxWriter struct {
+	outbox  urlstore.Outbox
+	encoder Encoder
+	key     KeyFunc
+	logger  *zap.Logger
+}
+
+// NewOutboxWriter creates writer to the outbox, messages are encoded with the encoder and keyed by key.
+// Content type and key are stored with the messages, so they are kept when the config is changed
+func NewOutboxWriter(outbox urlstore.Outbox, encoder Encoder, key KeyFunc, logger *zap.Logger) *OutboxWriter {
+	return &OutboxWriter{
+		outbox:  outbox,
+		encoder: encoder,
+		key:     key,
+		logger:  logger,
+	}
+}
+
+func (w *OutboxWriter) marshalJsonMessages(ms []any) ([]urlstore.OutboxMessage, error) {
+	messages := make([]urlstore.OutboxMessage, 0, len(ms))
+	for _, m := range ms {
+		bs, err := w.encoder.Encode(m)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, urlstore.OutboxMessage{
+			Key:         w.key(m),
+			ContentType: w.encoder.ContentType(),
+			Payload:     bs,
+		})
+	}
+	return messages, nil
+}
+
+func (w *OutboxWriter) AddJsonMessage(m any) {
+	w.AddJsonMessages(m)
+}
+
+func (w *OutboxWriter) AddJsonMessages(ms ...any) {
+	if len(ms) == 0 {
+		return
+	}
+	messages, err := w.marshalJsonMessages(ms)
+	if err != nil {
+		w.logger.Error("error marshaling message",
+			zap.Error(trace.WrapError(err)),
+		)
+		return
+	}
+	if err := w.outbox.AddMessages(messages...); err != nil {
+		w.logger.Error("error writing messages to outbox",
+			zap.Int("count", len(messages)),
+			zap.Error(trace.WrapError(err)),
+		)
+	}
+}
+
+// WithJsonMessages returns the option that writes ms to the store outbox in the same transaction as the saved url.
+// If w does not write to the outbox, the option does nothing and false is returned,
+// then ms must be added to w after the url is saved
+func WithJsonMessages(w KafkaWriterWorkerInterface, ms ...any) (urlstore.SaveOption, bool) {
+	if outbox, ok := w.(*OutboxWriter); ok {
+		if messages, err := outbox.marshalJsonMessages(ms); err == nil {
+			return urlstore.WithMessages(messages...), true
+		}
+	}
+	return func(*urlstore.SaveOptions) {}, false
+}
@@ -0,0 +1,52 @@
+package mq
+
+import (
+	"github.com/sajoniks/GoShort/internal/config"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBackoff     = time.Second
+	DefaultRetryMaxBackoff  = time.Second * 30
+)
+
+// RetryPolicy limits the number of attempts of a failing operation and the delay between them
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one
+	MaxAttempts int
+	// Backoff is the delay after the first failed attempt, it doubles after every attempt
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// NewRetryPolicy creates RetryPolicy of the config, unset values are replaced with defaults
+func NewRetryPolicy(config *config.RetryConfig) RetryPolicy {
+	p := RetryPolicy{
+		MaxAttempts: config.MaxAttempts,
+		Backoff:     config.Backoff,
+		MaxBackoff:  config.MaxBackoff,
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = DefaultRetryBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	return p
+}
+
+// Delay returns the delay after attempt has failed, that is random between
+// a half and the whole exponential backoff
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxBackoff)
+	return d/2 + rand.N(d/2+1)
+}
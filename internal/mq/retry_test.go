@@ -0,0 +1,35 @@
+package mq
+
+import (
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: time.Second * 5}
+	for attempt, limit := range map[int]time.Duration{
+		1: time.Second,
+		2: time.Second * 2,
+		3: time.Second * 4,
+		4: time.Second * 5,
+		9: time.Second * 5,
+	} {
+		d := p.Delay(attempt)
+		require.GreaterOrEqual(t, d, limit/2)
+		require.LessOrEqual(t, d, limit)
+	}
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	p := NewRetryPolicy(&config.RetryConfig{})
+	require.Equal(t, RetryPolicy{
+		MaxAttempts: DefaultRetryMaxAttempts,
+		Backoff:     DefaultRetryBackoff,
+		MaxBackoff:  DefaultRetryMaxBackoff,
+	}, p)
+
+	p = NewRetryPolicy(&config.RetryConfig{MaxAttempts: 1, Backoff: time.Millisecond, MaxBackoff: time.Second})
+	require.Equal(t, RetryPolicy{MaxAttempts: 1, Backoff: time.Millisecond, MaxBackoff: time.Second}, p)
+}
@@ -0,0 +1,112 @@
+package mq
+
+import (
+	"fmt"
+	"github.com/sajoniks/GoShort/internal/api/v1/event"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+const (
+	DefaultWriterBatchSize    = 100
+	DefaultWriterBatchTimeout = time.Millisecond * 10
+)
+
+// Key strategy names used in config
+const (
+	// KeyAlias keys events by event.Keyed, url events are keyed by the alias
+	KeyAlias = "alias"
+	// KeyNone sends messages without keys, they are spread over partitions evenly
+	KeyNone = "none"
+)
+
+// KeyFunc returns the key of the message, messages with empty key have no key
+type KeyFunc func(m any) string
+
+// NewKeyFunc creates KeyFunc of the configured strategy. Alias strategy is used by default
+func NewKeyFunc(strategy string) (KeyFunc, error) {
+	switch strategy {
+	case "", KeyAlias:
+		return EventKey, nil
+	case KeyNone:
+		return func(any) string { return "" }, nil
+	default:
+		return nil, fmt.Errorf("unknown message key strategy %q", strategy)
+	}
+}
+
+// EventKey is KeyFunc of the alias strategy, it returns the key of event.Keyed
+func EventKey(m any) string {
+	if k, ok := m.(event.Keyed); ok {
+		return k.EventKey()
+	}
+	return ""
+}
+
+// messageKey converts key to the key of kafka message, empty key is nil so the message is balanced evenly
+func messageKey(key string) []byte {
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
+}
+
+func parseCompression(name string) (kafka.Compression, error) {
+	switch name {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unknown compression %q", name)
+	}
+}
+
+func parseRequiredAcks(name string) (kafka.RequiredAcks, error) {
+	switch name {
+	case "", "all":
+		return kafka.RequireAll, nil
+	case "one":
+		return kafka.RequireOne, nil
+	case "none":
+		return kafka.RequireNone, nil
+	default:
+		return 0, fmt.Errorf("unknown required acks %q", name)
+	}
+}
+
+// newWriter creates writer of the config. Messages with keys are sent to the partition of the key
+func newWriter(config *config.KafkaWriterConfig) (*kafka.Writer, error) {
+	compression, err := parseCompression(config.Compression)
+	if err != nil {
+		return nil, err
+	}
+	acks, err := parseRequiredAcks(config.RequiredAcks)
+	if err != nil {
+		return nil, err
+	}
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(config.Brokers...),
+		Topic:        config.Topic,
+		Balancer:     &kafka.Hash{},
+		BatchSize:    config.BatchSize,
+		BatchTimeout: config.BatchTimeout,
+		Compression:  compression,
+		RequiredAcks: acks,
+		Async:        config.Async,
+	}
+	if w.BatchSize <= 0 {
+		w.BatchSize = DefaultWriterBatchSize
+	}
+	if w.BatchTimeout <= 0 {
+		w.BatchTimeout = DefaultWriterBatchTimeout
+	}
+	return w, nil
+}
@@ -0,0 +1,111 @@
+package mq
+
+import (
+	"context"
+	"github.com/sajoniks/GoShort/internal/api/v1/event"
+	"github.com/sajoniks/GoShort/internal/api/v1/event/urls"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// blockingWriter blocks the first write until released
+type blockingWriter struct {
+	fakeWriter
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (w *blockingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mx.Lock()
+	first := w.writes == 0
+	w.mx.Unlock()
+	if first {
+		close(w.started)
+		<-w.release
+	}
+	return w.fakeWriter.WriteMessages(ctx, msgs...)
+}
+
+func TestNewWriter(t *testing.T) {
+	w, err := newWriter(&config.KafkaWriterConfig{Topic: "events", Brokers: []string{"localhost:9092"}})
+	require.NoError(t, err)
+	require.Equal(t, DefaultWriterBatchSize, w.BatchSize)
+	require.Equal(t, DefaultWriterBatchTimeout, w.BatchTimeout)
+	require.Equal(t, kafka.RequireAll, w.RequiredAcks)
+	require.Equal(t, kafka.Compression(0), w.Compression)
+	require.False(t, w.Async)
+
+	w, err = newWriter(&config.KafkaWriterConfig{
+		BatchSize:    10,
+		BatchTimeout: time.Second,
+		Compression:  "zstd",
+		RequiredAcks: "one",
+		Async:        true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 10, w.BatchSize)
+	require.Equal(t, time.Second, w.BatchTimeout)
+	require.Equal(t, kafka.Zstd, w.Compression)
+	require.Equal(t, kafka.RequireOne, w.RequiredAcks)
+	require.True(t, w.Async)
+
+	_, err = newWriter(&config.KafkaWriterConfig{Compression: "brotli"})
+	require.Error(t, err)
+	_, err = newWriter(&config.KafkaWriterConfig{RequiredAcks: "two"})
+	require.Error(t, err)
+}
+
+func TestNewKeyFunc(t *testing.T) {
+	key, err := NewKeyFunc("")
+	require.NoError(t, err)
+	require.Equal(t, "a", key(urls.NewDeletedEvent("a")))
+	require.Equal(t, "", key(map[string]string{"alias": "a"}))
+
+	key, err = NewKeyFunc(KeyNone)
+	require.NoError(t, err)
+	require.Equal(t, "", key(urls.NewDeletedEvent("a")))
+
+	_, err = NewKeyFunc("source")
+	require.Error(t, err)
+}
+
+func TestKafkaWriterWorker_Order(t *testing.T) {
+	registry := event.NewRegistry("test")
+	urls.Register(registry)
+	w := newBlockingWriter()
+	k := newKafkaWriterWorker(w, NewJsonEncoder(registry), EventKey, 3, false, zap.NewNop())
+
+	k.AddJsonMessage(urls.NewAddedEvent("https://example.com", "a"))
+	<-w.started
+	// messages added while the first write is blocked are sent in order with the next writes
+	k.AddJsonMessage(urls.NewUpdatedEvent("https://example.com/1", "a"))
+	k.AddJsonMessages(urls.NewUpdatedEvent("https://example.com/2", "a"), urls.NewAddedEvent("https://example.com", "b"))
+	k.AddJsonMessage(urls.NewDeletedEvent("a"))
+	close(w.release)
+	k.Shutdown()
+
+	messages, writes := w.written()
+	require.Len(t, messages, 5)
+	require.Equal(t, 3, writes)
+	for i, want := range []event.Event{
+		urls.NewAddedEvent("https://example.com", "a"),
+		urls.NewUpdatedEvent("https://example.com/1", "a"),
+		urls.NewUpdatedEvent("https://example.com/2", "a"),
+		urls.NewAddedEvent("https://example.com", "b"),
+		urls.NewDeletedEvent("a"),
+	} {
+		_, e, err := DecodeEvent(registry, messages[i])
+		require.NoError(t, err)
+		require.Equal(t, want, e)
+		require.Equal(t, want.(event.Keyed).EventKey(), string(messages[i].Key))
+		require.Equal(t, event.ContentTypeJson, headerValue(messages[i].Headers, ContentTypeHeader))
+	}
+}
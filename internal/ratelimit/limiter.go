@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("invalid limit")
+
+// Limit is a token bucket configuration
+type Limit struct {
+	// Rate is the number of tokens added to the bucket per second
+	Rate float64
+	// Burst is the bucket capacity
+	Burst int
+}
+
+// Validate returns ErrInvalidLimit if rate or burst is not positive.
+// Bucket with such limit would never be refilled or would never allow requests
+func (l Limit) Validate() error {
+	if !(l.Rate > 0) || math.IsInf(l.Rate, 1) {
+		return fmt.Errorf("%w: rate must be positive, got %v", ErrInvalidLimit, l.Rate)
+	}
+	if l.Burst <= 0 {
+		return fmt.Errorf("%w: burst must be positive, got %d", ErrInvalidLimit, l.Burst)
+	}
+	return nil
+}
+
+type Result struct {
+	Allowed bool
+	// RetryAfter is the time until the next token is available. Zero if request is allowed
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from the bucket identified by key. ErrInvalidLimit is returned for invalid limits
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"math"
+	"sync"
+	"time"
+)
+
+// idleBucketTTL is the time after which unused bucket is removed
+const idleBucketTTL = time.Minute * 10
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type memoryLimiter struct {
+	mx        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryLimiter creates a Limiter that keeps buckets in process memory.
+// Limits are not shared between service instances
+func NewMemoryLimiter() Limiter {
+	return &memoryLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (m *memoryLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	if err := limit.Validate(); err != nil {
+		return Result{}, trace.WrapError(err)
+	}
+	now := m.now()
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		m.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return Result{Allowed: true}, nil
+	}
+
+	wait := (1 - b.tokens) / limit.Rate
+	return Result{RetryAfter: time.Duration(wait * float64(time.Second))}, nil
+}
+
+// sweep removes buckets that were not used for idleBucketTTL. Lock must be held
+func (m *memoryLimiter) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < idleBucketTTL {
+		return
+	}
+	m.lastSweep = now
+	for k, b := range m.buckets {
+		if now.Sub(b.last) >= idleBucketTTL {
+			delete(m.buckets, k)
+		}
+	}
+}
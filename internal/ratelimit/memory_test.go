@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewMemoryLimiter().(*memoryLimiter)
+	l.now = func() time.Time { return now }
+
+	limit := Limit{Rate: 2, Burst: 3}
+	ctx := context.Background()
+
+	for i := 0; i < limit.Burst; i++ {
+		res, err := l.Allow(ctx, "client", limit)
+		require.NoError(t, err)
+		require.True(t, res.Allowed, "request %d", i)
+	}
+
+	res, err := l.Allow(ctx, "client", limit)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	res, err = l.Allow(ctx, "other", limit)
+	require.NoError(t, err)
+	require.True(t, res.Allowed, "buckets are per key")
+
+	now = now.Add(500 * time.Millisecond)
+	res, err = l.Allow(ctx, "client", limit)
+	require.NoError(t, err)
+	require.True(t, res.Allowed, "bucket is refilled")
+
+	res, err = l.Allow(ctx, "client", limit)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+}
+
+func TestMemoryLimiter_Sweep(t *testing.T) {
+	now := time.Now()
+	l := NewMemoryLimiter().(*memoryLimiter)
+	l.now = func() time.Time { return now }
+	l.lastSweep = now
+
+	_, err := l.Allow(context.Background(), "client", Limit{Rate: 1, Burst: 1})
+	require.NoError(t, err)
+	require.Len(t, l.buckets, 1)
+
+	now = now.Add(idleBucketTTL)
+	_, err = l.Allow(context.Background(), "other", Limit{Rate: 1, Burst: 1})
+	require.NoError(t, err)
+	require.Len(t, l.buckets, 1)
+	require.Contains(t, l.buckets, "other")
+}
+
+func TestMemoryLimiter_InvalidLimit(t *testing.T) {
+	l := NewMemoryLimiter()
+	for _, limit := range []Limit{{Rate: 0, Burst: 1}, {Rate: -1, Burst: 1}, {Rate: 1, Burst: 0}} {
+		_, err := l.Allow(context.Background(), "client", limit)
+		require.ErrorIs(t, err, ErrInvalidLimit, "%+v", limit)
+	}
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"time"
+)
+
+const redisKeyPrefix = "goshort:ratelimit:"
+
+// tokenBucketScript refills and takes a token from the bucket atomically.
+// Redis server time is used, so instances with skewed clocks share the same buckets.
+//
+// Returns {allowed, retry after in milliseconds}
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, retry}
+`)
+
+type redisLimiter struct {
+	client redis.Scripter
+}
+
+// NewRedisLimiter creates a Limiter that keeps buckets in Redis, so limits are shared between service instances
+func NewRedisLimiter(client redis.Scripter) Limiter {
+	return &redisLimiter{client: client}
+}
+
+func (r *redisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if err := limit.Validate(); err != nil {
+		return Result{}, trace.WrapError(err)
+	}
+	res, err := tokenBucketScript.Run(ctx, r.client, []string{redisKeyPrefix + key}, limit.Rate, limit.Burst).Int64Slice()
+	if err != nil {
+		return Result{}, trace.WrapError(err)
+	}
+	return Result{
+		Allowed:    res[0] == 1,
+		RetryAfter: time.Duration(res[1]) * time.Millisecond,
+	}, nil
+}
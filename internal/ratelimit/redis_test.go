@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisLimiter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	l := NewRedisLimiter(client)
+
+	now := time.Now()
+	mr.SetTime(now)
+	limit := Limit{Rate: 2, Burst: 3}
+	ctx := context.Background()
+
+	for i := 0; i < limit.Burst; i++ {
+		res, err := l.Allow(ctx, "client", limit)
+		require.NoError(t, err)
+		require.True(t, res.Allowed, "request %d", i)
+	}
+
+	res, err := l.Allow(ctx, "client", limit)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	res, err = l.Allow(ctx, "other", limit)
+	require.NoError(t, err)
+	require.True(t, res.Allowed, "buckets are per key")
+
+	mr.SetTime(now.Add(500 * time.Millisecond))
+	res, err = l.Allow(ctx, "client", limit)
+	require.NoError(t, err)
+	require.True(t, res.Allowed, "bucket is refilled")
+
+	res, err = l.Allow(ctx, "client", limit)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+}
+
+func TestRedisLimiter_InvalidLimit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	l := NewRedisLimiter(client)
+
+	for _, limit := range []Limit{{Rate: 0, Burst: 1}, {Rate: -1, Burst: 1}, {Rate: 1, Burst: 0}} {
+		_, err := l.Allow(context.Background(), "client", limit)
+		require.ErrorIs(t, err, ErrInvalidLimit, "%+v", limit)
+	}
+	require.Empty(t, mr.Keys())
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	// breakerHalfOpen lets a single probe request through
+	breakerHalfOpen
+)
+
+// breaker stops requests after failures consecutive failed requests.
+// After cooldown, a single request is allowed to check if the service has recovered
+type breaker struct {
+	failures int
+	cooldown time.Duration
+
+	mx       sync.Mutex
+	state    breakerState
+	failed   int
+	openedAt time.Time
+}
+
+func newBreaker(failures int, cooldown time.Duration) *breaker {
+	return &breaker{
+		failures: failures,
+		cooldown: cooldown,
+	}
+}
+
+// allow reports whether request can be sent. Every allowed request must be followed by done
+func (b *breaker) allow() bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// probe is in flight
+		return false
+	default:
+		return true
+	}
+}
+
+// done records the result of the allowed request
+func (b *breaker) done(success bool) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if success {
+		b.state = breakerClosed
+		b.failed = 0
+		return
+	}
+
+	b.failed++
+	if b.state == breakerHalfOpen || b.failed >= b.failures {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
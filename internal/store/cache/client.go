@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	DefaultClientTimeout      = time.Millisecond * 500
+	DefaultClientMaxAttempts  = 3
+	DefaultClientRetryBackoff = time.Millisecond * 50
+	DefaultBreakerFailures    = 5
+	DefaultBreakerCooldown    = time.Second * 10
+
+	// maxRetryBackoff limits the delay between attempts
+	maxRetryBackoff = time.Second
+)
+
+var ErrCircuitOpen = errors.New("cache service is not requested after repeated failures")
+
+// cacheClient sends requests to the cache service.
+// Failed attempts are retried with jittered exponential backoff, and the service is not requested
+// for a while after repeated failures
+type cacheClient struct {
+	addr        string
+	http        *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	breaker     *breaker
+}
+
+func newCacheClient(addr string, cfg *config.CacheClientConfig) *cacheClient {
+	c := &cacheClient{
+		addr:        addr,
+		http:        &http.Client{Timeout: cfg.Timeout},
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     cfg.RetryBackoff,
+	}
+	if c.http.Timeout <= 0 {
+		c.http.Timeout = DefaultClientTimeout
+	}
+	if c.maxAttempts <= 0 {
+		c.maxAttempts = DefaultClientMaxAttempts
+	}
+	if c.backoff <= 0 {
+		c.backoff = DefaultClientRetryBackoff
+	}
+	failures, cooldown := cfg.BreakerFailures, cfg.BreakerCooldown
+	if failures <= 0 {
+		failures = DefaultBreakerFailures
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	c.breaker = newBreaker(failures, cooldown)
+	return c
+}
+
+// retryableStatus reports whether the request may succeed if it is sent again
+func retryableStatus(status int) bool {
+	return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryDelay returns the delay before the attempt, that is random up to the exponential backoff
+func (c *cacheClient) retryDelay(attempt int) time.Duration {
+	d := c.backoff
+	for i := 1; i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	return rand.N(min(d, maxRetryBackoff))
+}
+
+// do sends request with json body to the endpoint of the cache service. Nil body is not sent.
+// Returned response always has status that is not worth retrying
+func (c *cacheClient) do(method, endpoint string, body []byte) (*http.Response, error) {
+	requestUrl, err := url.JoinPath(c.addr, endpoint)
+	if err != nil {
+		return nil, trace.WrapError(ErrRequestError)
+	}
+	if !c.breaker.allow() {
+		return nil, trace.WrapError(ErrCircuitOpen)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			time.Sleep(c.retryDelay(attempt))
+		}
+		resp, err := c.send(method, requestUrl, body)
+		if err == nil {
+			c.breaker.done(true)
+			return resp, nil
+		}
+		if attempt+1 >= c.maxAttempts {
+			c.breaker.done(false)
+			return nil, err
+		}
+	}
+}
+
+// send makes a single attempt of the request
+func (c *cacheClient) send(method, requestUrl string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, requestUrl, reader)
+	if err != nil {
+		return nil, trace.WrapError(ErrRequestError)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, trace.WrapError(errors.Join(ErrTimeout, err))
+		}
+		return nil, trace.WrapError(errors.Join(ErrRequestError, err))
+	}
+	if retryableStatus(resp.StatusCode) {
+		// body is drained so the connection is reused
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusRequestTimeout {
+			return nil, trace.WrapError(ErrTimeout)
+		}
+		return nil, trace.WrapError(ErrRemoteStorageError)
+	}
+	return resp, nil
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+)
+
+// InvalidationChannel is the Redis pub/sub channel of aliases changed by any instance
+const InvalidationChannel = "goshort:invalidate"
+
+// NewInvalidationPublisher returns Invalidator hook that publishes changed aliases to other instances.
+// Publishing is best effort, entries of other instances expire after their TTL anyway
+func NewInvalidationPublisher(client redis.UniversalClient) func(alias string) {
+	return func(alias string) {
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		defer cancel()
+		client.Publish(ctx, InvalidationChannel, alias)
+	}
+}
+
+// ListenInvalidations drops entries of aliases published by other instances until ctx is done
+func ListenInvalidations(ctx context.Context, client redis.UniversalClient, inv Invalidator) error {
+	sub := client.Subscribe(ctx, InvalidationChannel)
+	defer sub.Close()
+
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			inv.Invalidate(msg.Payload)
+		}
+	}
+}
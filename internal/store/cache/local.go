@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"container/list"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLocalSize = 10000
+	DefaultLocalTTL  = time.Minute
+)
+
+// Invalidator is implemented by caches that keep urls in process memory
+type Invalidator interface {
+	// Invalidate drops cached url of the alias. Hooks are not called
+	Invalidate(alias string)
+	// OnInvalidate registers hook that is called after the url was changed or deleted through this store
+	OnInvalidate(hook func(alias string))
+}
+
+type localEntry struct {
+	alias string
+	url   string
+	// expiresAt is the time entry leaves the cache
+	expiresAt time.Time
+}
+
+// localStore is the size bounded LRU cache of the inner store urls in process memory.
+// Entries live at most ttl. When inner store does not report url expiry time,
+// url may be served from the cache up to ttl after it has expired.
+// Stores and caches of this package report it, so local cache can be stacked over them
+type localStore struct {
+	inner   urlstore.Store
+	size    int
+	ttl     time.Duration
+	metrics LocalCacheMetricsService
+
+	mx      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // most recently used entries first
+	// generation changes on every invalidation, reads started before it do not cache their result
+	generation uint64
+
+	hooksMx sync.RWMutex
+	hooks   []func(alias string)
+}
+
+// NewLocalCachedStore creates LRU cache of store with at most size urls.
+// Non-positive size and ttl are replaced with DefaultLocalSize and DefaultLocalTTL
+func NewLocalCachedStore(store urlstore.Store, size int, ttl time.Duration, metrics LocalCacheMetricsService) urlstore.CloseableStore {
+	if size <= 0 {
+		size = DefaultLocalSize
+	}
+	if ttl <= 0 {
+		ttl = DefaultLocalTTL
+	}
+	return &localStore{
+		inner:   store,
+		size:    size,
+		ttl:     ttl,
+		metrics: metrics,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// getURLExpiry reads url with its expiry time from store. Zero time is returned,
+// if store does not report it
+func getURLExpiry(store urlstore.Store, alias string) (string, time.Time, error) {
+	if getter, ok := store.(urlstore.ExpiryGetter); ok {
+		return getter.GetURLExpiry(alias)
+	}
+	src, err := store.GetURL(alias)
+	return src, time.Time{}, err
+}
+
+func (c *localStore) Close() {
+	if v, ok := c.inner.(urlstore.CloseableStore); ok {
+		v.Close()
+	}
+}
+
+// entryExpiry returns the time url leaves the cache, zero time is returned for expired urls
+func (c *localStore) entryExpiry(now, urlExpiresAt time.Time) time.Time {
+	expiresAt := now.Add(c.ttl)
+	if !urlExpiresAt.IsZero() && urlExpiresAt.Before(expiresAt) {
+		if !urlExpiresAt.After(now) {
+			return time.Time{}
+		}
+		expiresAt = urlExpiresAt
+	}
+	return expiresAt
+}
+
+// put caches url, lock must be held
+func (c *localStore) put(alias, src string, urlExpiresAt time.Time) {
+	now := time.Now()
+	expiresAt := c.entryExpiry(now, urlExpiresAt)
+	if expiresAt.IsZero() {
+		c.remove(alias)
+		return
+	}
+
+	if el, ok := c.entries[alias]; ok {
+		e := el.Value.(*localEntry)
+		e.url = src
+		e.expiresAt = expiresAt
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[alias] = c.order.PushFront(&localEntry{alias: alias, url: src, expiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*localEntry).alias)
+		c.metrics.RecordEviction(EvictionCapacity)
+	}
+}
+
+// remove drops cached url, lock must be held
+func (c *localStore) remove(alias string) {
+	if el, ok := c.entries[alias]; ok {
+		c.order.Remove(el)
+		delete(c.entries, alias)
+	}
+}
+
+// get returns cached url and the current generation, lock must not be held
+func (c *localStore) get(alias string) (string, bool, uint64) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	el, ok := c.entries[alias]
+	if !ok {
+		return "", false, c.generation
+	}
+	e := el.Value.(*localEntry)
+	if !e.expiresAt.After(time.Now()) {
+		c.remove(alias)
+		c.metrics.RecordEviction(EvictionExpired)
+		return "", false, c.generation
+	}
+	c.order.MoveToFront(el)
+	return e.url, true, c.generation
+}
+
+func (c *localStore) GetURL(alias string) (string, error) {
+	src, ok, generation := c.get(alias)
+	if ok {
+		c.metrics.RecordHit()
+		return src, nil
+	}
+	c.metrics.RecordMiss()
+	return c.load(alias, generation)
+}
+
+// load reads url from the inner store and caches it, unless the cache was invalidated after generation
+func (c *localStore) load(alias string, generation uint64) (string, error) {
+	src, expiresAt, err := getURLExpiry(c.inner, alias)
+	if err != nil {
+		return "", trace.WrapError(err)
+	}
+
+	c.mx.Lock()
+	if c.generation == generation {
+		c.put(alias, src, expiresAt)
+	}
+	c.mx.Unlock()
+	return src, nil
+}
+
+func (c *localStore) SaveURL(src, alias string, opts ...urlstore.SaveOption) (string, error) {
+	id, err := c.inner.SaveURL(src, alias, opts...)
+	if err != nil {
+		return "", trace.WrapError(err)
+	}
+
+	c.mx.Lock()
+	c.put(alias, src, urlstore.NewSaveOptions(opts...).ExpiresAt)
+	c.mx.Unlock()
+	return id, nil
+}
+
+func (c *localStore) SaveURLs(items []urlstore.BatchItem) ([]urlstore.BatchResult, error) {
+	results, err := c.inner.SaveURLs(items)
+	if err != nil {
+		return nil, trace.WrapError(err)
+	}
+
+	c.mx.Lock()
+	for i, item := range items {
+		if results[i].Err == nil {
+			c.put(item.Alias, item.Source, item.Options.ExpiresAt)
+		}
+	}
+	c.mx.Unlock()
+	return results, nil
+}
+
+func (c *localStore) FindAlias(src, owner string) (string, error) {
+	alias, err := c.inner.FindAlias(src, owner)
+	if err != nil {
+		return "", trace.WrapError(err)
+	}
+	return alias, nil
+}
+
+func (c *localStore) UpdateURL(alias, src, owner string) error {
+	err := c.inner.UpdateURL(alias, src, owner)
+	// inner cache may fail after the url was changed, so the entry is dropped anyway
+	c.invalidate(alias)
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	return nil
+}
+
+func (c *localStore) DeleteURL(alias, owner string) error {
+	err := c.inner.DeleteURL(alias, owner)
+	// inner cache may fail after the url was changed, so the entry is dropped anyway
+	c.invalidate(alias)
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	return nil
+}
+
+func (c *localStore) Invalidate(alias string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.remove(alias)
+	c.generation++
+}
+
+func (c *localStore) OnInvalidate(hook func(alias string)) {
+	c.hooksMx.Lock()
+	defer c.hooksMx.Unlock()
+
+	c.hooks = append(c.hooks, hook)
+}
+
+// invalidate drops cached url and notifies hooks
+func (c *localStore) invalidate(alias string) {
+	c.Invalidate(alias)
+
+	c.hooksMx.RLock()
+	defer c.hooksMx.RUnlock()
+	for _, hook := range c.hooks {
+		hook(alias)
+	}
+}
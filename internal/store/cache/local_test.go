@@ -0,0 +1,258 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/store/memory"
+	"github.com/sajoniks/GoShort/internal/store/storetest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockLocalCacheMetrics struct {
+	mx        sync.Mutex
+	hits      int
+	misses    int
+	evictions map[string]int
+}
+
+func (m *mockLocalCacheMetrics) RecordHit() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.hits++
+}
+
+func (m *mockLocalCacheMetrics) RecordMiss() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.misses++
+}
+
+func (m *mockLocalCacheMetrics) RecordEviction(reason string) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.evictions[reason]++
+}
+
+func newLocalTestStore(t *testing.T, size int, ttl time.Duration) (*countingStore, *mockLocalCacheMetrics, urlstore.CloseableStore) {
+	inner := &countingStore{CloseableStore: memory.NewMemoryStore()}
+	metrics := &mockLocalCacheMetrics{evictions: make(map[string]int)}
+	s := NewLocalCachedStore(inner, size, ttl, metrics)
+	t.Cleanup(s.Close)
+	return inner, metrics, s
+}
+
+func TestLocalConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) urlstore.Store {
+		_, _, s := newLocalTestStore(t, 100, time.Minute)
+		return s
+	})
+}
+
+func TestLocalStore_Hit(t *testing.T) {
+	inner, metrics, s := newLocalTestStore(t, 10, time.Minute)
+
+	_, err := inner.SaveURL("https://example.com", "alias")
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		src, err := s.GetURL("alias")
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com", src)
+	}
+	require.Equal(t, int32(1), inner.reads.Load())
+	require.Equal(t, 2, metrics.hits)
+	require.Equal(t, 1, metrics.misses)
+
+	// errors are not cached
+	for i := 0; i < 2; i++ {
+		_, err = s.GetURL("missing")
+		require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+	}
+	require.Equal(t, int32(3), inner.reads.Load())
+}
+
+func TestLocalStore_EvictLeastRecentlyUsed(t *testing.T) {
+	inner, metrics, s := newLocalTestStore(t, 2, time.Minute)
+
+	for _, alias := range []string{"a", "b"} {
+		_, err := s.SaveURL("https://example.com/"+alias, alias)
+		require.NoError(t, err)
+	}
+	// "a" becomes the most recently used, so "b" is evicted
+	_, err := s.GetURL("a")
+	require.NoError(t, err)
+	_, err = s.SaveURL("https://example.com/c", "c")
+	require.NoError(t, err)
+	require.Equal(t, 1, metrics.evictions[EvictionCapacity])
+
+	_, err = s.GetURL("a")
+	require.NoError(t, err)
+	_, err = s.GetURL("c")
+	require.NoError(t, err)
+	require.Zero(t, inner.reads.Load())
+
+	_, err = s.GetURL("b")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), inner.reads.Load())
+}
+
+func TestLocalStore_TTL(t *testing.T) {
+	inner, metrics, s := newLocalTestStore(t, 10, time.Millisecond*50)
+
+	_, err := s.SaveURL("https://example.com", "alias")
+	require.NoError(t, err)
+	_, err = s.GetURL("alias")
+	require.NoError(t, err)
+	require.Zero(t, inner.reads.Load())
+
+	time.Sleep(time.Millisecond * 60)
+	_, err = s.GetURL("alias")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), inner.reads.Load())
+	require.Equal(t, 1, metrics.evictions[EvictionExpired])
+}
+
+func TestLocalStore_UrlExpiry(t *testing.T) {
+	inner, _, s := newLocalTestStore(t, 10, time.Hour)
+
+	// entry must not outlive the url
+	_, err := s.SaveURL("https://example.com", "short", urlstore.WithExpiry(time.Now().Add(time.Second)))
+	require.NoError(t, err)
+	_, err = s.GetURL("short")
+	require.NoError(t, err)
+	require.Zero(t, inner.reads.Load())
+
+	time.Sleep(time.Millisecond * 1100)
+	_, err = s.GetURL("short")
+	require.ErrorIs(t, err, urlstore.ErrUrlExpired)
+}
+
+func TestLocalStore_StackedUrlExpiry(t *testing.T) {
+	check := func(t *testing.T, cached, inner urlstore.Store, expire func(time.Duration)) {
+		// memory store keeps expiry time in seconds
+		expiresAt := time.Now().Truncate(time.Second).Add(time.Second * 2)
+		_, err := cached.SaveURL("https://example.com", "cached", urlstore.WithExpiry(expiresAt))
+		require.NoError(t, err)
+		_, err = inner.SaveURL("https://example.com", "stored", urlstore.WithExpiry(expiresAt))
+		require.NoError(t, err)
+
+		// local cache is not closed, it would close the cache below it twice
+		s := NewLocalCachedStore(cached, 10, time.Hour, &mockLocalCacheMetrics{evictions: make(map[string]int)})
+		for _, alias := range []string{"cached", "stored"} {
+			src, err := s.GetURL(alias)
+			require.NoError(t, err)
+			require.Equal(t, "https://example.com", src)
+		}
+
+		wait := time.Until(expiresAt) + time.Millisecond*50
+		time.Sleep(wait)
+		expire(wait)
+		for _, alias := range []string{"cached", "stored"} {
+			_, err := s.GetURL(alias)
+			require.ErrorIs(t, err, urlstore.ErrUrlExpired, alias)
+		}
+	}
+
+	t.Run("redis", func(t *testing.T) {
+		mr, inner, s := newRedisTestStore(t)
+		check(t, s, inner, mr.FastForward)
+	})
+	t.Run("http", func(t *testing.T) {
+		_, srv := newFakeCacheServer(t)
+		inner := memory.NewMemoryStore()
+		s, err := NewCachedStore(srv.URL, inner, &config.CacheClientConfig{}, zap.NewNop())
+		require.NoError(t, err)
+		t.Cleanup(s.Close)
+		check(t, s, inner, func(time.Duration) {})
+	})
+}
+
+func TestLocalStore_Invalidate(t *testing.T) {
+	_, _, s := newLocalTestStore(t, 10, time.Minute)
+
+	var invalidated []string
+	s.(Invalidator).OnInvalidate(func(alias string) {
+		invalidated = append(invalidated, alias)
+	})
+
+	_, err := s.SaveURL("https://example.com", "alias", urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+	_, err = s.GetURL("alias")
+	require.NoError(t, err)
+
+	require.NoError(t, s.UpdateURL("alias", "https://example.org", "alice"))
+	src, err := s.GetURL("alias")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.org", src)
+
+	require.NoError(t, s.DeleteURL("alias", "alice"))
+	_, err = s.GetURL("alias")
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+	require.Equal(t, []string{"alias", "alias"}, invalidated)
+}
+
+func TestLocalStore_InvalidateDuringLoad(t *testing.T) {
+	inner, _, s := newLocalTestStore(t, 10, time.Minute)
+	inner.delay = time.Millisecond * 100
+
+	_, err := inner.SaveURL("https://example.com", "alias", urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// read started before the update returns the old url, but must not cache it
+		_, _ = s.GetURL("alias")
+	}()
+	time.Sleep(time.Millisecond * 20)
+	require.NoError(t, s.UpdateURL("alias", "https://example.org", "alice"))
+	<-done
+
+	src, err := s.GetURL("alias")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.org", src)
+}
+
+func TestLocalStore_InvalidationBroadcast(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	shared := memory.NewMemoryStore()
+	_, err := shared.SaveURL("https://example.com", "alias", urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+
+	first := NewLocalCachedStore(shared, 10, time.Hour, NewNoOpLocalCacheMetrics())
+	second := NewLocalCachedStore(shared, 10, time.Hour, NewNoOpLocalCacheMetrics())
+	first.(Invalidator).OnInvalidate(NewInvalidationPublisher(client))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listening := make(chan error, 1)
+	go func() {
+		listening <- ListenInvalidations(ctx, client, second.(Invalidator))
+	}()
+	require.Eventually(t, func() bool {
+		return len(mr.PubSubChannels("")) == 1
+	}, time.Second, time.Millisecond*10)
+
+	src, err := second.GetURL("alias")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", src)
+
+	require.NoError(t, first.UpdateURL("alias", "https://example.org", "alice"))
+	require.Eventually(t, func() bool {
+		src, err := second.GetURL("alias")
+		return err == nil && src == "https://example.org"
+	}, time.Second, time.Millisecond*10)
+
+	cancel()
+	require.NoError(t, <-listening)
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Eviction reasons of the local cache
+const (
+	EvictionCapacity = "capacity"
+	EvictionExpired  = "expired"
+)
+
+type LocalCacheMetricsService interface {
+	RecordHit()
+	RecordMiss()
+	// RecordEviction records entry removed by the cache itself, invalidated entries are not evictions
+	RecordEviction(reason string)
+}
+
+type noOpLocalCacheMetrics struct {
+}
+
+func (n noOpLocalCacheMetrics) RecordHit() {
+}
+
+func (n noOpLocalCacheMetrics) RecordMiss() {
+}
+
+func (n noOpLocalCacheMetrics) RecordEviction(reason string) {
+}
+
+func NewNoOpLocalCacheMetrics() LocalCacheMetricsService {
+	return &noOpLocalCacheMetrics{}
+}
+
+type LocalCacheMetrics struct {
+	hits      prometheus.Counter
+	misses    prometheus.Counter
+	evictions *prometheus.CounterVec
+}
+
+func (m *LocalCacheMetrics) RecordHit() {
+	m.hits.Inc()
+}
+
+func (m *LocalCacheMetrics) RecordMiss() {
+	m.misses.Inc()
+}
+
+func (m *LocalCacheMetrics) RecordEviction(reason string) {
+	m.evictions.With(prometheus.Labels{"reason": reason}).Inc()
+}
+
+func NewLocalCacheMetrics(reg prometheus.Registerer) *LocalCacheMetrics {
+	m := &LocalCacheMetrics{
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "goshort",
+			Subsystem: "local_cache",
+			Name:      "hit",
+			Help:      "count of urls served from the local cache",
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "goshort",
+			Subsystem: "local_cache",
+			Name:      "miss",
+			Help:      "count of urls not found in the local cache",
+		}),
+		evictions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "goshort",
+			Subsystem: "local_cache",
+			Name:      "eviction",
+			Help:      "count of urls evicted from the local cache",
+		}, []string{"reason"}),
+	}
+	reg.MustRegister(m.hits, m.misses, m.evictions)
+	return m
+}
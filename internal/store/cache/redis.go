@@ -0,0 +1,344 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// redisTimeout limits every cache operation, slow cache must not slow down redirects
+	redisTimeout = time.Millisecond * 500
+	// redisKeyPrefix separates cached urls from other keys of the database
+	redisKeyPrefix = "goshort:url:"
+	// redisGenerationPrefix is the prefix of the keys counting changes of the alias
+	redisGenerationPrefix = "goshort:gen:"
+	// generationTTL must be longer than any read of the inner store, so loads do not miss the change
+	generationTTL = time.Hour
+
+	DefaultRedisTTL         = time.Hour * 24
+	DefaultRedisNegativeTTL = time.Second * 30
+)
+
+// Values of negatively cached aliases. Urls are never empty and never start with '!'
+const (
+	notFoundValue = "!not-found"
+	expiredValue  = "!expired"
+	// expiringPrefix is followed by the expiry time in unix nanoseconds, ':' and the url
+	expiringPrefix = "!expires:"
+)
+
+// encodeUrl returns cached value of the url, urls that never expire are cached as is
+func encodeUrl(src string, expiresAt time.Time) string {
+	if expiresAt.IsZero() {
+		return src
+	}
+	return expiringPrefix + strconv.FormatInt(expiresAt.UnixNano(), 10) + ":" + src
+}
+
+// decodeUrl returns url and its expiry time from the cached value
+func decodeUrl(value string) (string, time.Time) {
+	rest, ok := strings.CutPrefix(value, expiringPrefix)
+	if !ok {
+		return value, time.Time{}
+	}
+	nanos, src, _ := strings.Cut(rest, ":")
+	n, _ := strconv.ParseInt(nanos, 10, 64)
+	return src, time.Unix(0, n)
+}
+
+// redisStore caches urls of the inner store in Redis.
+// Urls are cached on save (write-through) and on the first read (read-through),
+// missing and expired aliases are cached for a short negative TTL.
+// Concurrent reads of the same missing key are served by a single inner store call.
+//
+// Every save and invalidation increments the generation of the alias. Loads cache their result only if
+// the generation has not changed since they started, so a load racing with a change does not cache the old url
+type redisStore struct {
+	inner       urlstore.Store
+	client      redis.UniversalClient
+	ttl         time.Duration
+	negativeTTL time.Duration
+	loads       singleflight.Group
+	retrier     *invalidationRetrier
+	logger      *zap.Logger
+}
+
+// NewRedisCachedStore creates the cache of store in Redis. Client is closed with the store.
+// Non-positive ttl and negativeTTL are replaced with DefaultRedisTTL and DefaultRedisNegativeTTL
+func NewRedisCachedStore(client redis.UniversalClient, store urlstore.Store, ttl, negativeTTL time.Duration, logger *zap.Logger) urlstore.CloseableStore {
+	if ttl <= 0 {
+		ttl = DefaultRedisTTL
+	}
+	if negativeTTL <= 0 {
+		negativeTTL = DefaultRedisNegativeTTL
+	}
+	c := &redisStore{
+		inner:       store,
+		client:      client,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		logger:      logger,
+	}
+	c.retrier = newInvalidationRetrier(c.invalidate, invalidationRetryInterval, logger)
+	return c
+}
+
+func (c *redisStore) Close() {
+	c.retrier.close()
+	if v, ok := c.inner.(urlstore.CloseableStore); ok {
+		v.Close()
+	}
+	_ = c.client.Close()
+}
+
+// Keys of the alias share the hash tag, so they are in the same slot of Redis Cluster
+
+func redisKey(alias string) string {
+	return redisKeyPrefix + "{" + alias + "}"
+}
+
+func generationKey(alias string) string {
+	return redisGenerationPrefix + "{" + alias + "}"
+}
+
+// nextGeneration increments the generation of the alias, loads started before are not cached
+func nextGeneration(ctx context.Context, cmd redis.Cmdable, alias string) {
+	cmd.Incr(ctx, generationKey(alias))
+	cmd.Expire(ctx, generationKey(alias), generationTTL)
+}
+
+// setIfGeneration sets KEYS[1] to ARGV[2] for ARGV[3] milliseconds,
+// if generation KEYS[2] is still ARGV[1]. Missing generation is "0"
+var setIfGeneration = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '0') ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// urlTTL returns TTL of the cached url. Cached entry must never outlive the url itself,
+// so non-positive TTL is returned for expired urls
+func (c *redisStore) urlTTL(expiresAt time.Time) time.Duration {
+	if expiresAt.IsZero() {
+		return c.ttl
+	}
+	return min(c.ttl, time.Until(expiresAt))
+}
+
+// cacheUrl writes url to the cache, expired urls are removed from the cache instead
+func (c *redisStore) cacheUrl(ctx context.Context, cmd redis.Cmdable, alias, src string, expiresAt time.Time) {
+	if ttl := c.urlTTL(expiresAt); ttl > 0 {
+		cmd.Set(ctx, redisKey(alias), encodeUrl(src, expiresAt), ttl)
+	} else {
+		cmd.Del(ctx, redisKey(alias))
+	}
+}
+
+func (c *redisStore) SaveURL(src, alias string, opts ...urlstore.SaveOption) (string, error) {
+	id, err := c.inner.SaveURL(src, alias, opts...)
+	if err != nil {
+		return "", trace.WrapError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	// negative entry of the alias may be cached, so it is overwritten even for expired urls
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		nextGeneration(ctx, pipe, alias)
+		c.cacheUrl(ctx, pipe, alias, src, urlstore.NewSaveOptions(opts...).ExpiresAt)
+		return nil
+	})
+	if err != nil {
+		// url is saved, negative entry of the alias expires after the negative TTL
+		c.logger.Warn("url is not cached", zap.String("alias", alias), zap.Error(err))
+	}
+	return id, nil
+}
+
+// SaveURLs saves items to the inner store and caches saved items with a single pipeline
+func (c *redisStore) SaveURLs(items []urlstore.BatchItem) ([]urlstore.BatchResult, error) {
+	results, err := c.inner.SaveURLs(items)
+	if err != nil {
+		return nil, trace.WrapError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	pipe := c.client.TxPipeline()
+	for i, item := range items {
+		if results[i].Err == nil {
+			nextGeneration(ctx, pipe, item.Alias)
+			c.cacheUrl(ctx, pipe, item.Alias, item.Source, item.Options.ExpiresAt)
+		}
+	}
+	if pipe.Len() == 0 {
+		return results, nil
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		c.logger.Warn("urls are not cached", zap.Int("count", len(items)), zap.Error(err))
+	}
+	return results, nil
+}
+
+// loadResult is the outcome of the inner store read shared between concurrent readers
+type loadResult struct {
+	url       string
+	expiresAt time.Time
+	err       error
+}
+
+func (c *redisStore) GetURL(alias string) (string, error) {
+	src, _, err := c.GetURLExpiry(alias)
+	return src, err
+}
+
+// GetURLExpiry returns url with the time it expires, so caches stacked over this one do not outlive it
+func (c *redisStore) GetURLExpiry(alias string) (string, time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	value, err := c.client.Get(ctx, redisKey(alias)).Result()
+	switch {
+	case err == nil:
+		switch value {
+		case notFoundValue:
+			return "", time.Time{}, trace.WrapError(urlstore.ErrUrlNotFound)
+		case expiredValue:
+			return "", time.Time{}, trace.WrapError(urlstore.ErrUrlExpired)
+		default:
+			src, expiresAt := decodeUrl(value)
+			return src, expiresAt, nil
+		}
+	case errors.Is(err, redis.Nil):
+		v, _, _ := c.loads.Do(alias, func() (any, error) {
+			return c.load(alias), nil
+		})
+		res := v.(loadResult)
+		return res.url, res.expiresAt, res.err
+	default:
+		// unavailable cache must not break redirects
+		return getURLExpiry(c.inner, alias)
+	}
+}
+
+// generation returns the current generation of the alias
+func (c *redisStore) generation(alias string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	generation, err := c.client.Get(ctx, generationKey(alias)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "0", nil
+	}
+	return generation, err
+}
+
+// load reads alias from the inner store and caches the result,
+// unless the alias was saved or invalidated after the load started
+func (c *redisStore) load(alias string) loadResult {
+	// generation is read before the inner store, so changes made during the read are detected
+	generation, genErr := c.generation(alias)
+
+	var src string
+	var expiresAt time.Time
+	var err error
+	getter, canExpire := c.inner.(urlstore.ExpiryGetter)
+	if canExpire {
+		src, expiresAt, err = getter.GetURLExpiry(alias)
+	} else {
+		src, err = c.inner.GetURL(alias)
+	}
+	result := loadResult{url: src, expiresAt: expiresAt, err: err}
+	if genErr != nil {
+		return result
+	}
+
+	var value string
+	var ttl time.Duration
+	switch {
+	case err == nil:
+		// urls without known expiry time could outlive their expiry in the cache
+		if !canExpire {
+			return result
+		}
+		value, ttl = encodeUrl(src, expiresAt), c.urlTTL(expiresAt)
+	case errors.Is(err, urlstore.ErrUrlNotFound):
+		value, ttl = notFoundValue, c.negativeTTL
+	case errors.Is(err, urlstore.ErrUrlExpired):
+		value, ttl = expiredValue, c.negativeTTL
+	default:
+		return result
+	}
+	if ttl < time.Millisecond {
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	keys := []string{redisKey(alias), generationKey(alias)}
+	setIfGeneration.Run(ctx, c.client, keys, generation, value, ttl.Milliseconds())
+	return result
+}
+
+func (c *redisStore) FindAlias(src, owner string) (string, error) {
+	alias, err := c.inner.FindAlias(src, owner)
+	if err != nil {
+		return "", trace.WrapError(err)
+	}
+	return alias, nil
+}
+
+func (c *redisStore) UpdateURL(alias, src, owner string) error {
+	if err := c.inner.UpdateURL(alias, src, owner); err != nil {
+		return trace.WrapError(err)
+	}
+	c.invalidateOrRetry(alias)
+	return nil
+}
+
+func (c *redisStore) DeleteURL(alias, owner string) error {
+	if err := c.inner.DeleteURL(alias, owner); err != nil {
+		return trace.WrapError(err)
+	}
+	c.invalidateOrRetry(alias)
+	return nil
+}
+
+// invalidateOrRetry invalidates the alias changed in the inner store. The change is committed,
+// so failed invalidation is retried in background instead of failing the change
+func (c *redisStore) invalidateOrRetry(alias string) {
+	// later reads must not join the load that could have started before the change
+	c.loads.Forget(alias)
+	if err := c.invalidate(alias); err != nil {
+		c.logger.Warn("cached url is not invalidated, retrying", zap.String("alias", alias), zap.Error(err))
+		c.retrier.add(alias)
+	}
+}
+
+// invalidate removes cached entry of the alias, loads started before are not cached
+func (c *redisStore) invalidate(alias string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		nextGeneration(ctx, pipe, alias)
+		pipe.Del(ctx, redisKey(alias))
+		return nil
+	})
+	if err != nil {
+		return trace.WrapError(errors.Join(ErrRemoteStorageError, err))
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/store/memory"
+	"github.com/sajoniks/GoShort/internal/store/storetest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingStore counts reads of the inner store, reads are delayed to let concurrent readers overlap.
+// If read is set, the read result is held until read is closed
+type countingStore struct {
+	urlstore.CloseableStore
+	reads atomic.Int32
+	delay time.Duration
+	read  chan struct{}
+}
+
+func (c *countingStore) GetURLExpiry(alias string) (string, time.Time, error) {
+	c.reads.Add(1)
+	time.Sleep(c.delay)
+	src, expiresAt, err := c.CloseableStore.(urlstore.ExpiryGetter).GetURLExpiry(alias)
+	if c.read != nil {
+		c.read <- struct{}{}
+		<-c.read
+	}
+	return src, expiresAt, err
+}
+
+func newRedisTestStore(t *testing.T) (*miniredis.Miniredis, *countingStore, urlstore.CloseableStore) {
+	mr := miniredis.RunT(t)
+	inner := &countingStore{CloseableStore: memory.NewMemoryStore()}
+	s := NewRedisCachedStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), inner, time.Hour, time.Minute, zap.NewNop())
+	t.Cleanup(s.Close)
+	return mr, inner, s
+}
+
+func TestRedisConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) urlstore.Store {
+		_, _, s := newRedisTestStore(t)
+		return s
+	})
+}
+
+func TestRedisStore_WriteThrough(t *testing.T) {
+	mr, inner, s := newRedisTestStore(t)
+
+	_, err := s.SaveURL("https://example.com", "cached")
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, mr.TTL(redisKey("cached")))
+
+	src, err := s.GetURL("cached")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", src)
+	require.Zero(t, inner.reads.Load())
+
+	results, err := s.SaveURLs([]urlstore.BatchItem{
+		{Source: "https://example.com/a", Alias: "batch-a"},
+		{Source: "https://example.com/b", Alias: "cached"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	require.ErrorIs(t, results[1].Err, urlstore.ErrAliasExists)
+	cached, err := mr.Get(redisKey("batch-a"))
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/a", cached)
+	cached, err = mr.Get(redisKey("cached"))
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", cached)
+}
+
+func TestRedisStore_ExpiryTTL(t *testing.T) {
+	mr, _, s := newRedisTestStore(t)
+
+	_, err := s.SaveURL("https://example.com", "short", urlstore.WithExpiry(time.Now().Add(time.Minute*10)))
+	require.NoError(t, err)
+	ttl := mr.TTL(redisKey("short"))
+	require.Greater(t, ttl, time.Minute*9)
+	require.LessOrEqual(t, ttl, time.Minute*10)
+
+	_, err = s.SaveURL("https://example.com", "expired", urlstore.WithExpiry(time.Now().Add(-time.Minute)))
+	require.NoError(t, err)
+	require.False(t, mr.Exists(redisKey("expired")))
+}
+
+func TestRedisStore_ReadThrough(t *testing.T) {
+	mr, inner, s := newRedisTestStore(t)
+
+	_, err := inner.SaveURL("https://example.com", "inner", urlstore.WithExpiry(time.Now().Add(time.Minute*10)))
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		src, err := s.GetURL("inner")
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com", src)
+	}
+	require.Equal(t, int32(1), inner.reads.Load())
+	require.LessOrEqual(t, mr.TTL(redisKey("inner")), time.Minute*10)
+}
+
+func TestRedisStore_NegativeCache(t *testing.T) {
+	mr, inner, s := newRedisTestStore(t)
+
+	for i := 0; i < 3; i++ {
+		_, err := s.GetURL("missing")
+		require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+	}
+	require.Equal(t, int32(1), inner.reads.Load())
+	require.Equal(t, time.Minute, mr.TTL(redisKey("missing")))
+
+	// saved alias replaces negative entry
+	_, err := s.SaveURL("https://example.com", "missing")
+	require.NoError(t, err)
+	src, err := s.GetURL("missing")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", src)
+
+	_, err = inner.SaveURL("https://example.com", "expired", urlstore.WithExpiry(time.Now().Add(-time.Minute)))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := s.GetURL("expired")
+		require.ErrorIs(t, err, urlstore.ErrUrlExpired)
+	}
+	require.Equal(t, int32(2), inner.reads.Load())
+}
+
+func TestRedisStore_Singleflight(t *testing.T) {
+	_, inner, s := newRedisTestStore(t)
+	inner.delay = time.Millisecond * 100
+
+	_, err := inner.SaveURL("https://example.com", "hot")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			src, err := s.GetURL("hot")
+			require.NoError(t, err)
+			require.Equal(t, "https://example.com", src)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), inner.reads.Load())
+}
+
+func TestRedisStore_Invalidate(t *testing.T) {
+	mr, _, s := newRedisTestStore(t)
+
+	_, err := s.SaveURL("https://example.com", "changed", urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+	require.NoError(t, s.UpdateURL("changed", "https://example.org", "alice"))
+	require.False(t, mr.Exists(redisKey("changed")))
+
+	src, err := s.GetURL("changed")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.org", src)
+
+	require.NoError(t, s.DeleteURL("changed", "alice"))
+	_, err = s.GetURL("changed")
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+}
+
+func TestRedisStore_Unavailable(t *testing.T) {
+	mr, inner, s := newRedisTestStore(t)
+
+	_, err := inner.SaveURL("https://example.com", "alias")
+	require.NoError(t, err)
+	mr.Close()
+
+	src, err := s.GetURL("alias")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", src)
+
+	// changes are committed to the inner store, cache failures do not fail them
+	_, err = s.SaveURL("https://example.com", "other", urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+	results, err := s.SaveURLs([]urlstore.BatchItem{{Source: "https://example.com", Alias: "batch"}})
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	require.NoError(t, s.UpdateURL("other", "https://example.org", "alice"))
+}
+
+func TestRedisStore_LoadRacesInvalidate(t *testing.T) {
+	mr, inner, s := newRedisTestStore(t)
+
+	_, err := inner.SaveURL("https://example.com", "racy", urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+	inner.read = make(chan struct{})
+
+	loaded := make(chan string)
+	go func() {
+		src, _ := s.GetURL("racy")
+		loaded <- src
+	}()
+
+	// the load has read the old url, the url changes before the load caches it
+	<-inner.read
+	require.NoError(t, s.UpdateURL("racy", "https://example.org", "alice"))
+	close(inner.read)
+	require.Equal(t, "https://example.com", <-loaded)
+	require.False(t, mr.Exists(redisKey("racy")))
+
+	inner.read = nil
+	src, err := s.GetURL("racy")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.org", src)
+	cached, err := mr.Get(redisKey("racy"))
+	require.NoError(t, err)
+	require.Equal(t, "https://example.org", cached)
+}
+
+func TestRedisStore_RetryInvalidate(t *testing.T) {
+	mr, _, s := newRedisTestStore(t)
+	retrier := s.(*redisStore).retrier
+
+	_, err := s.SaveURL("https://example.com", "changed", urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+
+	mr.Close()
+	require.NoError(t, s.UpdateURL("changed", "https://example.org", "alice"))
+	require.Equal(t, 1, retrier.len())
+
+	retrier.retry()
+	require.Equal(t, 1, retrier.len())
+
+	require.NoError(t, mr.Restart())
+	require.True(t, mr.Exists(redisKey("changed")))
+	retrier.retry()
+	require.Zero(t, retrier.len())
+	require.False(t, mr.Exists(redisKey("changed")))
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	// invalidationRetryInterval is the delay between attempts to remove entries of changed urls
+	invalidationRetryInterval = time.Second
+	// maxPendingInvalidations limits aliases kept for retry, entries of dropped aliases expire after their TTL
+	maxPendingInvalidations = 10000
+)
+
+// invalidationRetrier retries failed invalidations in background until they succeed.
+// Changes are committed to the inner store before the cache is invalidated, so failed invalidation
+// must not fail the change, but the cache must not serve the old url after it recovers
+type invalidationRetrier struct {
+	invalidate func(alias string) error
+	interval   time.Duration
+	logger     *zap.Logger
+
+	mx sync.Mutex
+	// pending counts failed invalidations of the alias, so alias that failed again during retry is kept
+	pending map[string]uint64
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newInvalidationRetrier(invalidate func(alias string) error, interval time.Duration, logger *zap.Logger) *invalidationRetrier {
+	r := &invalidationRetrier{
+		invalidate: invalidate,
+		interval:   interval,
+		logger:     logger,
+		pending:    make(map[string]uint64),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// add schedules invalidation of the alias
+func (r *invalidationRetrier) add(alias string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if _, ok := r.pending[alias]; !ok && len(r.pending) >= maxPendingInvalidations {
+		r.logger.Error("too many failed invalidations, cached url may be stale until it expires",
+			zap.String("alias", alias),
+		)
+		return
+	}
+	r.pending[alias]++
+}
+
+// len returns the number of aliases waiting for invalidation
+func (r *invalidationRetrier) len() int {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return len(r.pending)
+}
+
+func (r *invalidationRetrier) close() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *invalidationRetrier) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			if n := r.len(); n > 0 {
+				r.logger.Warn("invalidations are not retried anymore", zap.Int("count", n))
+			}
+			return
+		case <-ticker.C:
+			r.retry()
+		}
+	}
+}
+
+// retry invalidates pending aliases until the first failure, the rest is retried on the next tick
+func (r *invalidationRetrier) retry() {
+	r.mx.Lock()
+	aliases := make(map[string]uint64, len(r.pending))
+	for alias, failures := range r.pending {
+		aliases[alias] = failures
+	}
+	r.mx.Unlock()
+
+	for alias, failures := range aliases {
+		if err := r.invalidate(alias); err != nil {
+			return
+		}
+		r.mx.Lock()
+		if r.pending[alias] == failures {
+			delete(r.pending, alias)
+		}
+		r.mx.Unlock()
+	}
+	if len(aliases) > 0 {
+		r.logger.Info("retried invalidations", zap.Int("count", len(aliases)))
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/sajoniks/GoShort/internal/api/v1/response"
+	"github.com/sajoniks/GoShort/internal/config"
 	urlstore "github.com/sajoniks/GoShort/internal/store/interface"
 	"github.com/sajoniks/GoShort/internal/trace"
+	"go.uber.org/zap"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 var (
@@ -19,112 +22,227 @@ var (
 	ErrNoContent          = errors.New("no content")
 )
 
+// cacheStore caches urls of the inner store in the cache service.
+// Cache service failures do not fail reads and saves, which go straight to the inner store instead.
+// Failed invalidations of changed urls are retried in background
 type cacheStore struct {
-	inner urlstore.Store
-	addr  string
+	inner   urlstore.Store
+	client  *cacheClient
+	retrier *invalidationRetrier
+	logger  *zap.Logger
 }
 
 func (c *cacheStore) Close() {
+	c.retrier.close()
 	if v, ok := c.inner.(urlstore.CloseableStore); ok {
 		v.Close()
 	}
 }
 
-func (c *cacheStore) SaveURL(src, alias string) (string, error) {
-	id, err := c.inner.SaveURL(src, alias)
+// cacheEntry is the url sent to the cache service
+type cacheEntry struct {
+	Url       string     `json:"url"`
+	Alias     string     `json:"alias"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func newCacheEntry(src, alias string, o urlstore.SaveOptions) cacheEntry {
+	entry := cacheEntry{Url: src, Alias: alias}
+	if !o.ExpiresAt.IsZero() {
+		entry.ExpiresAt = &o.ExpiresAt
+	}
+	return entry
+}
+
+func (c *cacheStore) SaveURL(src, alias string, opts ...urlstore.SaveOption) (string, error) {
+	id, err := c.inner.SaveURL(src, alias, opts...)
 	if err != nil {
-		return "", trace.WrapError(ErrRemoteStorageError)
+		return "", trace.WrapError(err)
 	}
 
-	request := struct {
-		Url   string `json:"url"`
-		Alias string `json:"alias"`
-	}{}
-	request.Url = src
-	request.Alias = alias
-	requestUrl, err := url.JoinPath(c.addr, "set")
+	entry := newCacheEntry(src, alias, urlstore.NewSaveOptions(opts...))
+	if err := c.set("set", &entry); err != nil {
+		// url is saved, it will be read from the inner store
+		c.logger.Warn("url is not cached", zap.String("alias", alias), zap.Error(err))
+	}
+	return id, nil
+}
+
+// SaveURLs saves items to the inner store and caches saved items with a single request
+func (c *cacheStore) SaveURLs(items []urlstore.BatchItem) ([]urlstore.BatchResult, error) {
+	results, err := c.inner.SaveURLs(items)
 	if err != nil {
-		return "", trace.WrapError(ErrRequestError)
+		return nil, trace.WrapError(err)
+	}
+
+	entries := make([]cacheEntry, 0, len(items))
+	for i, item := range items {
+		if results[i].Err == nil {
+			entries = append(entries, newCacheEntry(item.Source, item.Alias, item.Options))
+		}
+	}
+	if len(entries) == 0 {
+		return results, nil
 	}
+
+	if err := c.set("set/batch", entries); err != nil {
+		c.logger.Warn("urls are not cached", zap.Int("count", len(entries)), zap.Error(err))
+	}
+	return results, nil
+}
+
+// set posts v to the cache service endpoint
+func (c *cacheStore) set(endpoint string, v any) error {
 	buf := &bytes.Buffer{}
-	_ = json.NewEncoder(buf).Encode(&request)
-	resp, err := http.Post(requestUrl, "application/json", buf)
+	_ = json.NewEncoder(buf).Encode(v)
+	resp, err := c.client.do(http.MethodPost, endpoint, buf.Bytes())
 	if err != nil {
-		return "", trace.WrapError(ErrRequestError)
+		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusRequestTimeout {
-			return "", trace.WrapError(ErrTimeout) // @todo retries?
-		} else {
-			return "", trace.WrapError(ErrRemoteStorageError)
-		}
+		return trace.WrapError(ErrRemoteStorageError)
 	}
 
 	if resp.Header.Get("Content-Type") == "application/problem+json" {
 		var cacheResponse response.BaseResponse
 		decodeErr := json.NewDecoder(resp.Body).Decode(&cacheResponse)
 		if decodeErr != nil {
-			return "", trace.WrapError(ErrRemoteStorageError)
+			return trace.WrapError(ErrRemoteStorageError)
 		} else {
-			return "", errors.Join(trace.WrapError(ErrServerError), errors.New(cacheResponse.Error))
+			return errors.Join(trace.WrapError(ErrServerError), errors.New(cacheResponse.Error))
 		}
 	}
-	return id, nil
+	return nil
 }
 
 func (c *cacheStore) GetURL(alias string) (string, error) {
-	requestUrl, err := url.JoinPath(c.addr, alias)
+	src, _, err := c.get(alias)
 	if err != nil {
-		return "", trace.WrapError(ErrRequestError)
+		c.logGetError(alias, err)
+		return c.inner.GetURL(alias)
 	}
+	return src, nil
+}
 
-	resp, err := http.Get(requestUrl)
+// GetURLExpiry returns url with the time it expires, so caches stacked over this one do not outlive it.
+// If the cache service does not report the expiry time, url is read from the inner store
+func (c *cacheStore) GetURLExpiry(alias string) (string, time.Time, error) {
+	src, expiresAt, err := c.get(alias)
 	if err != nil {
-		return "", trace.WrapError(ErrRequestError)
+		c.logGetError(alias, err)
+		return getURLExpiry(c.inner, alias)
+	}
+	if expiresAt == nil {
+		return getURLExpiry(c.inner, alias)
+	}
+	return src, *expiresAt, nil
+}
+
+func (c *cacheStore) logGetError(alias string, err error) {
+	// repeated failures are not logged while the cache service is not requested
+	if !errors.Is(err, ErrNoContent) && !errors.Is(err, ErrCircuitOpen) {
+		c.logger.Warn("cache is unavailable, reading from store", zap.String("alias", alias), zap.Error(err))
+	}
+}
+
+// get returns cached url of the alias and the time it expires. Zero time is returned for urls that never expire,
+// nil is returned if the cache service does not report it. ErrNoContent is returned if url is not cached
+func (c *cacheStore) get(alias string) (string, *time.Time, error) {
+	resp, err := c.client.do(http.MethodGet, alias, nil)
+	if err != nil {
+		return "", nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusRequestTimeout {
-			return "", ErrTimeout // @todo retries?
-		} else if resp.StatusCode == http.StatusNoContent {
-			return c.inner.GetURL(alias) // no cached entry
-		} else {
-			return "", trace.WrapError(ErrRemoteStorageError)
+		if resp.StatusCode == http.StatusNoContent {
+			return "", nil, trace.WrapError(ErrNoContent)
 		}
+		return "", nil, trace.WrapError(ErrRemoteStorageError)
 	}
 
 	if resp.Header.Get("Content-Type") == "application/problem+json" {
 		var cacheResponse response.BaseResponse
 		decodeErr := json.NewDecoder(resp.Body).Decode(&cacheResponse)
 		if decodeErr != nil {
-			return "", trace.WrapError(ErrRemoteStorageError)
+			return "", nil, trace.WrapError(ErrRemoteStorageError)
 		} else {
-			return "", errors.Join(trace.WrapError(ErrServerError), errors.New(cacheResponse.Error))
+			return "", nil, errors.Join(trace.WrapError(ErrServerError), errors.New(cacheResponse.Error))
 		}
 	} else if resp.Header.Get("Content-Type") == "application/json" {
 		var cacheResponse struct {
 			response.BaseResponse
-			Url string `json:"url"`
+			Url       string     `json:"url"`
+			ExpiresAt *time.Time `json:"expires_at,omitempty"`
 		}
 		decodeErr := json.NewDecoder(resp.Body).Decode(&cacheResponse)
 		if decodeErr != nil {
-			return "", trace.WrapError(ErrRemoteStorageError)
+			return "", nil, trace.WrapError(ErrRemoteStorageError)
 		} else {
-			return cacheResponse.Url, nil
+			return cacheResponse.Url, cacheResponse.ExpiresAt, nil
 		}
 	} else {
-		return "", trace.WrapError(ErrRemoteStorageError)
+		return "", nil, trace.WrapError(ErrRemoteStorageError)
 	}
 }
 
-func NewCachedStore(cacheAddr string, store urlstore.Store) (urlstore.CloseableStore, error) {
+func (c *cacheStore) FindAlias(src, owner string) (string, error) {
+	alias, err := c.inner.FindAlias(src, owner)
+	if err != nil {
+		return "", trace.WrapError(err)
+	}
+	return alias, nil
+}
+
+func (c *cacheStore) UpdateURL(alias, src, owner string) error {
+	if err := c.inner.UpdateURL(alias, src, owner); err != nil {
+		return trace.WrapError(err)
+	}
+	c.invalidateOrRetry(alias)
+	return nil
+}
+
+func (c *cacheStore) DeleteURL(alias, owner string) error {
+	if err := c.inner.DeleteURL(alias, owner); err != nil {
+		return trace.WrapError(err)
+	}
+	c.invalidateOrRetry(alias)
+	return nil
+}
+
+// invalidateOrRetry invalidates the alias changed in the inner store. The change is committed,
+// so failed invalidation is retried in background instead of failing the change
+func (c *cacheStore) invalidateOrRetry(alias string) {
+	if err := c.invalidate(alias); err != nil {
+		c.logger.Warn("cached url is not invalidated, retrying", zap.String("alias", alias), zap.Error(err))
+		c.retrier.add(alias)
+	}
+}
+
+// invalidate removes cached entry of the alias
+func (c *cacheStore) invalidate(alias string) error {
+	resp, err := c.client.do(http.MethodDelete, alias, nil)
+	if err != nil {
+		return trace.WrapError(errors.Join(ErrRemoteStorageError, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return trace.WrapError(ErrRemoteStorageError)
+	}
+	return nil
+}
+
+// NewCachedStore creates the cache of store in the cache service at cacheAddr
+func NewCachedStore(cacheAddr string, store urlstore.Store, cfg *config.CacheClientConfig, logger *zap.Logger) (urlstore.CloseableStore, error) {
 	if _, err := url.Parse(cacheAddr); err != nil {
 		return nil, err
 	}
 
-	return &cacheStore{
-		inner: store,
-		addr:  cacheAddr,
-	}, nil
+	c := &cacheStore{
+		inner:  store,
+		client: newCacheClient(cacheAddr, cfg),
+		logger: logger,
+	}
+	c.retrier = newInvalidationRetrier(c.invalidate, invalidationRetryInterval, logger)
+	return c, nil
 }
@@ -0,0 +1,304 @@
+package cache
+
+import (
+	"cmp"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/sajoniks/GoShort/internal/api/v1/response"
+	"github.com/sajoniks/GoShort/internal/config"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/store/memory"
+	"github.com/sajoniks/GoShort/internal/store/storetest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeCacheService is the in-memory replacement of the cache service with the same api
+type fakeCacheService struct {
+	mx      sync.Mutex
+	entries map[string]cacheEntry
+	hits    int
+}
+
+func (f *fakeCacheService) put(e cacheEntry) {
+	if e.ExpiresAt != nil && !e.ExpiresAt.After(time.Now()) {
+		return
+	}
+	f.entries[e.Alias] = e
+}
+
+func newFakeCacheServer(t *testing.T) (*fakeCacheService, *httptest.Server) {
+	f := &fakeCacheService{entries: make(map[string]cacheEntry)}
+
+	r := mux.NewRouter()
+	r.Methods(http.MethodPost).Path("/set").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e cacheEntry
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.mx.Lock()
+		f.put(e)
+		f.mx.Unlock()
+	})
+	r.Methods(http.MethodPost).Path("/set/batch").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var entries []cacheEntry
+		if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.mx.Lock()
+		for _, e := range entries {
+			f.put(e)
+		}
+		f.mx.Unlock()
+	})
+	r.Methods(http.MethodGet).Path("/{alias}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mx.Lock()
+		e, ok := f.entries[mux.Vars(r)["alias"]]
+		if ok && e.ExpiresAt != nil && !e.ExpiresAt.After(time.Now()) {
+			ok = false
+		}
+		if ok {
+			f.hits++
+		}
+		f.mx.Unlock()
+
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			response.BaseResponse
+			Url       string     `json:"url"`
+			ExpiresAt *time.Time `json:"expires_at,omitempty"`
+		}{response.Ok(), e.Url, cmp.Or(e.ExpiresAt, &time.Time{})})
+	})
+	r.Methods(http.MethodDelete).Path("/{alias}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mx.Lock()
+		delete(f.entries, mux.Vars(r)["alias"])
+		f.mx.Unlock()
+	})
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func newTestStore(t *testing.T) (*fakeCacheService, urlstore.CloseableStore) {
+	f, srv := newFakeCacheServer(t)
+	s, err := NewCachedStore(srv.URL, memory.NewMemoryStore(), &config.CacheClientConfig{}, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+	return f, s
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) urlstore.Store {
+		_, s := newTestStore(t)
+		return s
+	})
+}
+
+func TestCachedStore_Hit(t *testing.T) {
+	f, s := newTestStore(t)
+
+	_, err := s.SaveURL("https://example.com", "cached", urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+
+	src, err := s.GetURL("cached")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", src)
+	require.Equal(t, 1, f.hits)
+
+	require.NoError(t, s.UpdateURL("cached", "https://example.org", "alice"))
+	src, err = s.GetURL("cached")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.org", src)
+	require.Equal(t, 1, f.hits)
+}
+
+// newFailingServer creates cache service that responds with status to the first failures requests
+func newFailingServer(t *testing.T, failures int32, status int) (*atomic.Int32, *httptest.Server) {
+	requests := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			response.BaseResponse
+			Url string `json:"url"`
+		}{response.Ok(), "https://cached.example.com"})
+	}))
+	t.Cleanup(srv.Close)
+	return requests, srv
+}
+
+func TestCachedStore_Retry(t *testing.T) {
+	requests, srv := newFailingServer(t, 2, http.StatusServiceUnavailable)
+	s, err := NewCachedStore(srv.URL, memory.NewMemoryStore(), &config.CacheClientConfig{
+		MaxAttempts:  3,
+		RetryBackoff: time.Millisecond,
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	src, err := s.GetURL("alias")
+	require.NoError(t, err)
+	require.Equal(t, "https://cached.example.com", src)
+	require.Equal(t, int32(3), requests.Load())
+}
+
+func TestCachedStore_Timeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 200)
+	}))
+	t.Cleanup(srv.Close)
+
+	inner := memory.NewMemoryStore()
+	_, err := inner.SaveURL("https://example.com", "alias")
+	require.NoError(t, err)
+	s, err := NewCachedStore(srv.URL, inner, &config.CacheClientConfig{
+		Timeout:     time.Millisecond * 20,
+		MaxAttempts: 1,
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	start := time.Now()
+	src, err := s.GetURL("alias")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", src)
+	require.Less(t, time.Since(start), time.Millisecond*200)
+}
+
+func TestCachedStore_Unavailable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	s, err := NewCachedStore(srv.URL, memory.NewMemoryStore(), &config.CacheClientConfig{
+		RetryBackoff: time.Millisecond,
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	// saves and reads go straight to the store
+	_, err = s.SaveURL("https://example.com", "alias", urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+	src, err := s.GetURL("alias")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", src)
+
+	results, err := s.SaveURLs([]urlstore.BatchItem{{Source: "https://example.org", Alias: "other"}})
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+
+	_, err = s.GetURL("missing")
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+
+	// url is changed, cached entry is removed later
+	require.NoError(t, s.UpdateURL("alias", "https://example.org", "alice"))
+	require.Equal(t, 1, s.(*cacheStore).retrier.len())
+}
+
+func TestCachedStore_RetryInvalidate(t *testing.T) {
+	f, fakeSrv := newFakeCacheServer(t)
+	failing := &atomic.Bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fakeSrv.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	s, err := NewCachedStore(srv.URL, memory.NewMemoryStore(), &config.CacheClientConfig{
+		MaxAttempts:     1,
+		BreakerFailures: 1,
+		BreakerCooldown: time.Millisecond * 50,
+	}, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+	retrier := s.(*cacheStore).retrier
+
+	_, err = s.SaveURL("https://example.com", "alias", urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+
+	// the breaker opens on the failed invalidation, the change is not failed
+	failing.Store(true)
+	require.NoError(t, s.UpdateURL("alias", "https://example.org", "alice"))
+	require.Equal(t, 1, retrier.len())
+	retrier.retry()
+	require.Equal(t, 1, retrier.len())
+	f.mx.Lock()
+	require.Contains(t, f.entries, "alias")
+	f.mx.Unlock()
+
+	failing.Store(false)
+	time.Sleep(time.Millisecond * 60)
+	retrier.retry()
+	require.Zero(t, retrier.len())
+
+	src, err := s.GetURL("alias")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.org", src)
+}
+
+func TestCachedStore_CircuitBreaker(t *testing.T) {
+	requests, srv := newFailingServer(t, 1000, http.StatusInternalServerError)
+
+	inner := memory.NewMemoryStore()
+	_, err := inner.SaveURL("https://example.com", "alias")
+	require.NoError(t, err)
+	s, err := NewCachedStore(srv.URL, inner, &config.CacheClientConfig{
+		MaxAttempts:     1,
+		BreakerFailures: 3,
+		BreakerCooldown: time.Millisecond * 100,
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		src, err := s.GetURL("alias")
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com", src)
+	}
+	require.Equal(t, int32(3), requests.Load())
+
+	// a single probe after cooldown fails and opens the breaker again
+	time.Sleep(time.Millisecond * 120)
+	for i := 0; i < 3; i++ {
+		_, err = s.GetURL("alias")
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(4), requests.Load())
+}
+
+func TestCachedStore_CircuitBreakerRecovers(t *testing.T) {
+	requests, srv := newFailingServer(t, 2, http.StatusInternalServerError)
+	s, err := NewCachedStore(srv.URL, memory.NewMemoryStore(), &config.CacheClientConfig{
+		MaxAttempts:     1,
+		BreakerFailures: 2,
+		BreakerCooldown: time.Millisecond * 50,
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, _ = s.GetURL("alias")
+	}
+	require.Equal(t, int32(2), requests.Load())
+
+	time.Sleep(time.Millisecond * 60)
+	for i := 0; i < 3; i++ {
+		src, err := s.GetURL("alias")
+		require.NoError(t, err)
+		require.Equal(t, "https://cached.example.com", src)
+	}
+	require.Equal(t, int32(5), requests.Load())
+}
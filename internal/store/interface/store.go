@@ -2,25 +2,134 @@ package urlstore
 
 import (
 	"errors"
+	"time"
 )
 
 var (
 	ErrUrlNotFound = errors.New("url does not exist")
 	ErrUrlExists   = errors.New("url already exists")
+	ErrAliasExists = errors.New("alias already exists")
 	ErrAliasEmpty  = errors.New("alias is empty")
 	ErrUrlEmpty    = errors.New("url is empty")
+	ErrUrlExpired  = errors.New("url has expired")
+	ErrNotOwner    = errors.New("url belongs to another owner")
+	// ErrStoreBusy is returned when store can not serve the request right now. Request can be retried later
+	ErrStoreBusy = errors.New("store is busy")
 )
 
+// SaveOptions are optional parameters of the saved url
+type SaveOptions struct {
+	// ExpiresAt is the time after which url is no longer accessible. Zero value means url never expires
+	ExpiresAt time.Time
+	// Owner is the principal that created url. Empty owner means url was created anonymously
+	Owner string
+	// Messages are written to the outbox in the same transaction as the url by stores that implement Outbox.
+	// Other stores ignore them
+	Messages []OutboxMessage
+}
+
+type SaveOption func(o *SaveOptions)
+
+// WithExpiry sets the time after which saved url is no longer accessible
+func WithExpiry(t time.Time) SaveOption {
+	return func(o *SaveOptions) {
+		o.ExpiresAt = t
+	}
+}
+
+// WithOwner sets the principal that owns saved url
+func WithOwner(owner string) SaveOption {
+	return func(o *SaveOptions) {
+		o.Owner = owner
+	}
+}
+
+// WithMessages adds messages that are published once the url is saved
+func WithMessages(messages ...OutboxMessage) SaveOption {
+	return func(o *SaveOptions) {
+		o.Messages = append(o.Messages, messages...)
+	}
+}
+
+// NewSaveOptions applies opts to the default SaveOptions
+func NewSaveOptions(opts ...SaveOption) SaveOptions {
+	var o SaveOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// BatchItem is a single url saved by Store.SaveURLs
+type BatchItem struct {
+	Source  string
+	Alias   string
+	Options SaveOptions
+}
+
+// BatchResult is the outcome of saving a single BatchItem
+type BatchResult struct {
+	ID  string
+	Err error
+}
+
 type Closeable interface {
 	Close()
 }
 
 type Store interface {
-	SaveURL(src, alias string) (string, error)
+	SaveURL(src, alias string, opts ...SaveOption) (string, error)
+	// SaveURLs saves items in a single transaction. Result is returned for every item in the same order,
+	// failed item does not prevent saving others. Error is returned only if the whole batch failed
+	SaveURLs(items []BatchItem) ([]BatchResult, error)
 	GetURL(alias string) (string, error)
+	// FindAlias returns alias of the src url saved by the owner without expiry.
+	// ErrUrlNotFound is returned if there is no such alias
+	FindAlias(src, owner string) (string, error)
+	// UpdateURL changes source url of the existing alias.
+	// ErrNotOwner is returned if alias is owned by someone else, or if alias or owner is anonymous
+	UpdateURL(alias, src, owner string) error
+	// DeleteURL removes the alias.
+	// ErrNotOwner is returned if alias is owned by someone else, or if alias or owner is anonymous
+	DeleteURL(alias, owner string) error
 }
 
 type CloseableStore interface {
 	Store
 	Closeable
 }
+
+// ExpiredPurger is implemented by stores that can remove expired urls
+type ExpiredPurger interface {
+	// PurgeExpired removes expired urls and returns number of removed entries
+	PurgeExpired() (int64, error)
+}
+
+// ExpiryGetter is implemented by stores that return expiry time of the url along with it
+type ExpiryGetter interface {
+	// GetURLExpiry is the same as Store.GetURL, but also returns the time url expires at.
+	// Zero time means url never expires
+	GetURLExpiry(alias string) (string, time.Time, error)
+}
+
+// OutboxMessage is the message stored in the outbox until it is published
+type OutboxMessage struct {
+	// ID is assigned by the outbox, it is ignored for added messages
+	ID int64
+	// Key is the key of the published message, empty key means message has no key
+	Key string
+	// ContentType is the content type of the payload, empty content type means json
+	ContentType string
+	Payload     []byte
+}
+
+// Outbox is implemented by stores that keep messages until they are published,
+// so messages are not lost when the broker is unavailable or the process stops
+type Outbox interface {
+	// AddMessages writes messages to the outbox in a single transaction
+	AddMessages(messages ...OutboxMessage) error
+	// PendingMessages returns at most limit oldest messages that are not published yet
+	PendingMessages(limit int) ([]OutboxMessage, error)
+	// MarkSent removes published messages from the outbox
+	MarkSent(ids ...int64) error
+}
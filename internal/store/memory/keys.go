@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"github.com/sajoniks/GoShort/internal/auth"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (s *memoryStore) AddApiKey(owner, keyHash string) (int64, error) {
+	if strings.TrimSpace(owner) == "" {
+		return 0, trace.WrapError(auth.ErrOwnerEmpty)
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if _, ok := s.keyHashes[keyHash]; ok {
+		return 0, trace.WrapError(auth.ErrKeyExists)
+	}
+	s.lastKeyId++
+	s.keys[s.lastKeyId] = auth.ApiKey{
+		ID:        s.lastKeyId,
+		Owner:     owner,
+		CreatedAt: time.Unix(time.Now().Unix(), 0).UTC(),
+	}
+	s.keyHashes[keyHash] = s.lastKeyId
+	return s.lastKeyId, nil
+}
+
+func (s *memoryStore) GetApiKeyOwner(keyHash string) (string, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	id, ok := s.keyHashes[keyHash]
+	if !ok {
+		return "", trace.WrapError(auth.ErrKeyNotFound)
+	}
+	return s.keys[id].Owner, nil
+}
+
+func (s *memoryStore) ListApiKeys() ([]auth.ApiKey, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	var keys []auth.ApiKey
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (s *memoryStore) DeleteApiKey(id int64) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if _, ok := s.keys[id]; !ok {
+		return trace.WrapError(auth.ErrKeyNotFound)
+	}
+	delete(s.keys, id)
+	for hash, keyId := range s.keyHashes {
+		if keyId == id {
+			delete(s.keyHashes, hash)
+		}
+	}
+	return nil
+}
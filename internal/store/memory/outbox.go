@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"bytes"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"slices"
+)
+
+// addMessages appends messages to the outbox, write lock must be held
+func (s *memoryStore) addMessages(messages []urlstore.OutboxMessage) {
+	for _, m := range messages {
+		s.lastMessageId++
+		m.ID = s.lastMessageId
+		m.Payload = bytes.Clone(m.Payload)
+		s.outbox = append(s.outbox, m)
+	}
+}
+
+func (s *memoryStore) AddMessages(messages ...urlstore.OutboxMessage) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.addMessages(messages)
+	return nil
+}
+
+func (s *memoryStore) PendingMessages(limit int) ([]urlstore.OutboxMessage, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	// negative limit returns all messages, like sqlite does
+	n := len(s.outbox)
+	if limit >= 0 && limit < n {
+		n = limit
+	}
+	messages := make([]urlstore.OutboxMessage, 0, n)
+	for _, m := range s.outbox[:n] {
+		m.Payload = bytes.Clone(m.Payload)
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+func (s *memoryStore) MarkSent(ids ...int64) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.outbox = slices.DeleteFunc(s.outbox, func(m urlstore.OutboxMessage) bool {
+		return slices.Contains(ids, m.ID)
+	})
+	return nil
+}
@@ -0,0 +1,254 @@
+// Package memory implements urlstore.Store that keeps everything in process memory.
+// It follows the semantics of the sqlite store and is intended for tests and single-node local runs
+package memory
+
+import (
+	"fmt"
+	"github.com/sajoniks/GoShort/internal/auth"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type urlEntry struct {
+	id    int64
+	alias string
+	url   string
+	owner string
+	// expiresAt is unix time in seconds, like it is kept by sqlite. Zero means url never expires
+	expiresAt int64
+}
+
+func (e *urlEntry) expired(now time.Time) bool {
+	return e.expiresAt != 0 && e.expiresAt <= now.Unix()
+}
+
+// sourceKey identifies urls of the owner with the same source, used by FindAlias
+type sourceKey struct {
+	owner string
+	url   string
+}
+
+type memoryStore struct {
+	mx      sync.RWMutex
+	urls    map[string]*urlEntry
+	sources map[sourceKey][]*urlEntry // sorted by id
+	lastId  int64
+
+	keys      map[int64]auth.ApiKey
+	keyHashes map[string]int64
+	lastKeyId int64
+
+	sequence uint64
+
+	outbox        []urlstore.OutboxMessage // sorted by id
+	lastMessageId int64
+}
+
+func NewMemoryStore() urlstore.CloseableStore {
+	return &memoryStore{
+		urls:      make(map[string]*urlEntry),
+		sources:   make(map[sourceKey][]*urlEntry),
+		keys:      make(map[int64]auth.ApiKey),
+		keyHashes: make(map[string]int64),
+	}
+}
+
+func (s *memoryStore) Close() {
+}
+
+// isBlank reports whether v is rejected by the blank check of the sqlite schema
+func isBlank(v string) bool {
+	return strings.Trim(v, " ") == ""
+}
+
+func (s *memoryStore) addSource(e *urlEntry) {
+	key := sourceKey{owner: e.owner, url: e.url}
+	entries := append(s.sources[key], e)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id < entries[j].id
+	})
+	s.sources[key] = entries
+}
+
+func (s *memoryStore) removeSource(e *urlEntry) {
+	key := sourceKey{owner: e.owner, url: e.url}
+	entries := s.sources[key]
+	for i, v := range entries {
+		if v == e {
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(entries) == 0 {
+		delete(s.sources, key)
+	} else {
+		s.sources[key] = entries
+	}
+}
+
+// insert saves url, write lock must be held
+func (s *memoryStore) insert(src, alias string, o urlstore.SaveOptions) (string, error) {
+	if len(alias) == 0 {
+		return "", urlstore.ErrAliasEmpty
+	}
+	if len(src) == 0 || isBlank(src) || isBlank(alias) {
+		return "", urlstore.ErrUrlEmpty
+	}
+	if _, ok := s.urls[alias]; ok {
+		return "", urlstore.ErrAliasExists
+	}
+
+	s.lastId++
+	e := &urlEntry{id: s.lastId, alias: alias, url: src, owner: o.Owner}
+	if !o.ExpiresAt.IsZero() {
+		e.expiresAt = o.ExpiresAt.Unix()
+	}
+	s.urls[alias] = e
+	s.addSource(e)
+	s.addMessages(o.Messages)
+	return fmt.Sprint(e.id), nil
+}
+
+func (s *memoryStore) SaveURL(src, alias string, opts ...urlstore.SaveOption) (string, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	id, err := s.insert(src, alias, urlstore.NewSaveOptions(opts...))
+	if err != nil {
+		return "", trace.WrapError(err)
+	}
+	return id, nil
+}
+
+func (s *memoryStore) SaveURLs(items []urlstore.BatchItem) ([]urlstore.BatchResult, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	results := make([]urlstore.BatchResult, len(items))
+	for i, item := range items {
+		id, err := s.insert(item.Source, item.Alias, item.Options)
+		if err != nil {
+			results[i].Err = trace.WrapError(err)
+			continue
+		}
+		results[i].ID = id
+	}
+	return results, nil
+}
+
+func (s *memoryStore) GetURL(alias string) (string, error) {
+	resultUrl, _, err := s.GetURLExpiry(alias)
+	return resultUrl, err
+}
+
+func (s *memoryStore) GetURLExpiry(alias string) (string, time.Time, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	e, ok := s.urls[alias]
+	if !ok {
+		return "", time.Time{}, trace.WrapError(urlstore.ErrUrlNotFound)
+	}
+	if e.expired(time.Now()) {
+		return "", time.Time{}, trace.WrapError(urlstore.ErrUrlExpired)
+	}
+	if e.expiresAt == 0 {
+		return e.url, time.Time{}, nil
+	}
+	return e.url, time.Unix(e.expiresAt, 0), nil
+}
+
+func (s *memoryStore) FindAlias(src, owner string) (string, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	for _, e := range s.sources[sourceKey{owner: owner, url: src}] {
+		if e.expiresAt == 0 {
+			return e.alias, nil
+		}
+	}
+	return "", trace.WrapError(urlstore.ErrUrlNotFound)
+}
+
+// owned returns the entry of alias if it is owned by owner, read or write lock must be held.
+// Anonymous urls are not owned by anyone, including anonymous callers
+func (s *memoryStore) owned(alias, owner string) (*urlEntry, error) {
+	e, ok := s.urls[alias]
+	if !ok {
+		return nil, urlstore.ErrUrlNotFound
+	}
+	if owner == "" || e.owner != owner {
+		return nil, urlstore.ErrNotOwner
+	}
+	return e, nil
+}
+
+func (s *memoryStore) UpdateURL(alias, src, owner string) error {
+	if len(alias) == 0 {
+		return trace.WrapError(urlstore.ErrAliasEmpty)
+	}
+	if len(src) == 0 {
+		return trace.WrapError(urlstore.ErrUrlEmpty)
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	e, err := s.owned(alias, owner)
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	if isBlank(src) {
+		return trace.WrapError(urlstore.ErrUrlEmpty)
+	}
+	s.removeSource(e)
+	e.url = src
+	s.addSource(e)
+	return nil
+}
+
+func (s *memoryStore) DeleteURL(alias, owner string) error {
+	if len(alias) == 0 {
+		return trace.WrapError(urlstore.ErrAliasEmpty)
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	e, err := s.owned(alias, owner)
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	s.removeSource(e)
+	delete(s.urls, alias)
+	return nil
+}
+
+func (s *memoryStore) PurgeExpired() (int64, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now()
+	var n int64
+	for alias, e := range s.urls {
+		if e.expired(now) {
+			s.removeSource(e)
+			delete(s.urls, alias)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// NextSequence increments and returns the counter used by the counter alias strategy
+func (s *memoryStore) NextSequence() (uint64, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.sequence++
+	return s.sequence, nil
+}
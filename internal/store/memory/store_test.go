@@ -0,0 +1,41 @@
+package memory
+
+import (
+	"github.com/sajoniks/GoShort/internal/auth"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/store/storetest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) urlstore.Store {
+		return NewMemoryStore()
+	})
+}
+
+func TestApiKeys(t *testing.T) {
+	keys := NewMemoryStore().(auth.KeyStore)
+
+	_, err := keys.AddApiKey(" ", "hash")
+	require.ErrorIs(t, err, auth.ErrOwnerEmpty)
+
+	id, err := keys.AddApiKey("alice", "hash")
+	require.NoError(t, err)
+	_, err = keys.AddApiKey("bob", "hash")
+	require.ErrorIs(t, err, auth.ErrKeyExists)
+
+	owner, err := keys.GetApiKeyOwner("hash")
+	require.NoError(t, err)
+	require.Equal(t, "alice", owner)
+
+	list, err := keys.ListApiKeys()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, id, list[0].ID)
+
+	require.NoError(t, keys.DeleteApiKey(id))
+	require.ErrorIs(t, keys.DeleteApiKey(id), auth.ErrKeyNotFound)
+	_, err = keys.GetApiKeyOwner("hash")
+	require.ErrorIs(t, err, auth.ErrKeyNotFound)
+}
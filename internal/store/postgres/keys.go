@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sajoniks/GoShort/internal/auth"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"strings"
+)
+
+func (s *postgresUrlStore) AddApiKey(owner, keyHash string) (int64, error) {
+	if strings.TrimSpace(owner) == "" {
+		return 0, trace.WrapError(auth.ErrOwnerEmpty)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var id int64
+	err := s.pool.QueryRow(ctx,
+		`INSERT INTO api_keys (owner, key_hash) VALUES ($1, $2) RETURNING id`,
+		owner, keyHash,
+	).Scan(&id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == codeUniqueViolation {
+			return 0, trace.WrapError(auth.ErrKeyExists)
+		}
+		return 0, trace.WrapError(err)
+	}
+	return id, nil
+}
+
+func (s *postgresUrlStore) GetApiKeyOwner(keyHash string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var owner string
+	err := s.pool.QueryRow(ctx, `SELECT owner FROM api_keys WHERE key_hash = $1`, keyHash).Scan(&owner)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", trace.WrapError(auth.ErrKeyNotFound)
+		}
+		return "", trace.WrapError(err)
+	}
+	return owner, nil
+}
+
+func (s *postgresUrlStore) ListApiKeys() ([]auth.ApiKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `SELECT id, owner, created_at FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, trace.WrapError(err)
+	}
+	defer rows.Close()
+
+	var keys []auth.ApiKey
+	for rows.Next() {
+		var key auth.ApiKey
+		if err := rows.Scan(&key.ID, &key.Owner, &key.CreatedAt); err != nil {
+			return nil, trace.WrapError(err)
+		}
+		key.CreatedAt = key.CreatedAt.UTC()
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, trace.WrapError(err)
+	}
+	return keys, nil
+}
+
+func (s *postgresUrlStore) DeleteApiKey(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, `DELETE FROM api_keys WHERE id = $1`, id)
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return trace.WrapError(auth.ErrKeyNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationsLockId is the advisory lock key that serializes migrations of concurrently starting instances
+const migrationsLockId = 0x676f73686f7274 // "goshort"
+
+// migrations are applied in order, version of the migration is its index + 1.
+// Applied migrations must never be changed, new ones are appended to the end
+var migrations = []string{
+	`
+	CREATE TABLE urls(
+		id BIGSERIAL PRIMARY KEY,
+		alias TEXT NOT NULL,
+		url TEXT NOT NULL,
+		expires_at TIMESTAMPTZ,
+		owner TEXT NOT NULL DEFAULT '',
+		CONSTRAINT urls_alias_key UNIQUE (alias),
+		CONSTRAINT urls_not_blank CHECK (btrim(alias) <> '' AND btrim(url) <> ''));
+	CREATE INDEX idx_urls_expires_at ON urls(expires_at) WHERE expires_at IS NOT NULL;
+	CREATE INDEX idx_urls_owner_url ON urls(owner, url);
+
+	CREATE TABLE api_keys(
+		id BIGSERIAL PRIMARY KEY,
+		owner TEXT NOT NULL,
+		key_hash TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		CONSTRAINT api_keys_key_hash_key UNIQUE (key_hash),
+		CONSTRAINT api_keys_owner_not_blank CHECK (btrim(owner) <> ''));
+
+	CREATE SEQUENCE alias_sequence;
+	`,
+	`
+	CREATE TABLE outbox(
+		id BIGSERIAL PRIMARY KEY,
+		message_key TEXT NOT NULL DEFAULT '',
+		content_type TEXT NOT NULL DEFAULT '',
+		payload BYTEA NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now());
+	`,
+}
+
+// migrate applies pending migrations in a single transaction
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationsLockId); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_version(version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+
+	var version int
+	err = tx.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than supported %d", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if _, err := tx.Exec(ctx, migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	if version < len(migrations) {
+		_, err = tx.Exec(ctx, `INSERT INTO schema_version (version) VALUES ($1)`, len(migrations))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/trace"
+)
+
+// insertMessages writes messages to the outbox within tx with a single round trip
+func insertMessages(ctx context.Context, tx pgx.Tx, messages []urlstore.OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	for _, m := range messages {
+		batch.Queue(
+			`INSERT INTO outbox (message_key, content_type, payload) VALUES ($1, $2, $3)`,
+			m.Key, m.ContentType, m.Payload,
+		)
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+func (s *postgresUrlStore) AddMessages(messages ...urlstore.OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertMessages(ctx, tx, messages); err != nil {
+		return trace.WrapError(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return trace.WrapError(err)
+	}
+	return nil
+}
+
+func (s *postgresUrlStore) PendingMessages(limit int) ([]urlstore.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx,
+		`SELECT id, message_key, content_type, payload FROM outbox ORDER BY id LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, trace.WrapError(err)
+	}
+	defer rows.Close()
+
+	var messages []urlstore.OutboxMessage
+	for rows.Next() {
+		var m urlstore.OutboxMessage
+		if err := rows.Scan(&m.ID, &m.Key, &m.ContentType, &m.Payload); err != nil {
+			return nil, trace.WrapError(err)
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, trace.WrapError(err)
+	}
+	return messages, nil
+}
+
+func (s *postgresUrlStore) MarkSent(ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if _, err := s.pool.Exec(ctx, `DELETE FROM outbox WHERE id = ANY($1)`, ids); err != nil {
+		return trace.WrapError(err)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"strings"
+	"time"
+)
+
+// queryTimeout limits every store operation, since Store methods do not accept context
+const queryTimeout = time.Second * 5
+
+// postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	codeUniqueViolation = "23505"
+	codeCheckViolation  = "23514"
+)
+
+type postgresUrlStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresStore connects to the database and applies pending schema migrations.
+// Pool is configured with connection string parameters, e.g. pool_max_conns
+func NewPostgresStore(connString string) (urlstore.CloseableStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, connString)
+	if err != nil {
+		return nil, trace.WrapError(err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, trace.WrapError(err)
+	}
+	if err := migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, trace.WrapError(err)
+	}
+
+	return &postgresUrlStore{pool: pool}, nil
+}
+
+func (s *postgresUrlStore) Close() {
+	s.pool.Close()
+}
+
+// saveError maps constraint violations to store errors
+func saveError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == codeUniqueViolation && pgErr.ConstraintName == "urls_alias_key":
+			return urlstore.ErrAliasExists
+		case pgErr.Code == codeUniqueViolation:
+			return urlstore.ErrUrlExists
+		case pgErr.Code == codeCheckViolation:
+			return urlstore.ErrUrlEmpty
+		}
+	}
+	return err
+}
+
+func expiresAtArg(o urlstore.SaveOptions) *time.Time {
+	if o.ExpiresAt.IsZero() {
+		return nil
+	}
+	return &o.ExpiresAt
+}
+
+func (s *postgresUrlStore) SaveURL(src, alias string, opts ...urlstore.SaveOption) (string, error) {
+	if len(alias) == 0 {
+		return "", trace.WrapError(urlstore.ErrAliasEmpty)
+	}
+	if len(src) == 0 {
+		return "", trace.WrapError(urlstore.ErrUrlEmpty)
+	}
+	o := urlstore.NewSaveOptions(opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	const insertUrl = `INSERT INTO urls (alias, url, expires_at, owner) VALUES ($1, $2, $3, $4) RETURNING id`
+	var id int64
+	if len(o.Messages) == 0 {
+		err := s.pool.QueryRow(ctx, insertUrl, alias, src, expiresAtArg(o), o.Owner).Scan(&id)
+		if err != nil {
+			return "", trace.WrapError(saveError(err))
+		}
+		return fmt.Sprint(id), nil
+	}
+
+	// messages are written in the same transaction, so they are published only if the url is saved
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return "", trace.WrapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.QueryRow(ctx, insertUrl, alias, src, expiresAtArg(o), o.Owner).Scan(&id); err != nil {
+		return "", trace.WrapError(saveError(err))
+	}
+	if err := insertMessages(ctx, tx, o.Messages); err != nil {
+		return "", trace.WrapError(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", trace.WrapError(err)
+	}
+	return fmt.Sprint(id), nil
+}
+
+func (s *postgresUrlStore) SaveURLs(items []urlstore.BatchItem) ([]urlstore.BatchResult, error) {
+	results := make([]urlstore.BatchResult, len(items))
+
+	// failed statement aborts postgres transaction, so items that would violate constraints are
+	// checked beforehand, and alias conflicts are skipped with ON CONFLICT instead of failing
+	batch := &pgx.Batch{}
+	queued := make([]int, 0, len(items))
+	for i, item := range items {
+		if strings.TrimSpace(item.Alias) == "" {
+			results[i].Err = trace.WrapError(urlstore.ErrAliasEmpty)
+			continue
+		}
+		if strings.TrimSpace(item.Source) == "" {
+			results[i].Err = trace.WrapError(urlstore.ErrUrlEmpty)
+			continue
+		}
+		batch.Queue(
+			`INSERT INTO urls (alias, url, expires_at, owner) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (alias) DO NOTHING RETURNING id`,
+			item.Alias, item.Source, expiresAtArg(item.Options), item.Options.Owner,
+		)
+		queued = append(queued, i)
+	}
+	if len(queued) == 0 {
+		return results, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, trace.WrapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	br := tx.SendBatch(ctx, batch)
+	for _, i := range queued {
+		var id int64
+		err := br.QueryRow().Scan(&id)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				results[i].Err = trace.WrapError(urlstore.ErrAliasExists)
+				continue
+			}
+			br.Close()
+			return nil, trace.WrapError(saveError(err))
+		}
+		results[i].ID = fmt.Sprint(id)
+	}
+	if err := br.Close(); err != nil {
+		return nil, trace.WrapError(err)
+	}
+
+	// messages are written only for the saved items
+	var messages []urlstore.OutboxMessage
+	for _, i := range queued {
+		if results[i].Err == nil {
+			messages = append(messages, items[i].Options.Messages...)
+		}
+	}
+	if err := insertMessages(ctx, tx, messages); err != nil {
+		return nil, trace.WrapError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, trace.WrapError(err)
+	}
+	return results, nil
+}
+
+func (s *postgresUrlStore) GetURL(alias string) (string, error) {
+	resultUrl, _, err := s.GetURLExpiry(alias)
+	return resultUrl, err
+}
+
+func (s *postgresUrlStore) GetURLExpiry(alias string) (string, time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var resultUrl string
+	var expiresAt *time.Time
+	err := s.pool.QueryRow(ctx, `SELECT url, expires_at FROM urls WHERE alias = $1`, alias).Scan(&resultUrl, &expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", time.Time{}, trace.WrapError(urlstore.ErrUrlNotFound)
+		}
+		return "", time.Time{}, trace.WrapError(err)
+	}
+
+	if expiresAt == nil {
+		return resultUrl, time.Time{}, nil
+	}
+	if !expiresAt.After(time.Now()) {
+		return "", time.Time{}, trace.WrapError(urlstore.ErrUrlExpired)
+	}
+	return resultUrl, *expiresAt, nil
+}
+
+func (s *postgresUrlStore) FindAlias(src, owner string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var alias string
+	err := s.pool.QueryRow(ctx, `
+		SELECT alias FROM urls
+		WHERE owner = $1 AND url = $2 AND expires_at IS NULL
+		ORDER BY id LIMIT 1`,
+		owner, src,
+	).Scan(&alias)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", trace.WrapError(urlstore.ErrUrlNotFound)
+		}
+		return "", trace.WrapError(err)
+	}
+	return alias, nil
+}
+
+func (s *postgresUrlStore) PurgeExpired() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, `DELETE FROM urls WHERE expires_at IS NOT NULL AND expires_at <= now()`)
+	if err != nil {
+		return 0, trace.WrapError(err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ownerError tells apart missing alias and alias of another owner after the owned row was not found
+func (s *postgresUrlStore) ownerError(ctx context.Context, alias string) error {
+	var exists bool
+	err := s.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM urls WHERE alias = $1)`, alias).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return urlstore.ErrNotOwner
+	}
+	return urlstore.ErrUrlNotFound
+}
+
+func (s *postgresUrlStore) UpdateURL(alias, src, owner string) error {
+	if len(alias) == 0 {
+		return trace.WrapError(urlstore.ErrAliasEmpty)
+	}
+	if len(src) == 0 {
+		return trace.WrapError(urlstore.ErrUrlEmpty)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if owner == "" {
+		// anonymous urls can not be managed
+		return trace.WrapError(s.ownerError(ctx, alias))
+	}
+	tag, err := s.pool.Exec(ctx, `UPDATE urls SET url = $1 WHERE alias = $2 AND owner = $3`, src, alias, owner)
+	if err != nil {
+		return trace.WrapError(saveError(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return trace.WrapError(s.ownerError(ctx, alias))
+	}
+	return nil
+}
+
+func (s *postgresUrlStore) DeleteURL(alias, owner string) error {
+	if len(alias) == 0 {
+		return trace.WrapError(urlstore.ErrAliasEmpty)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if owner == "" {
+		return trace.WrapError(s.ownerError(ctx, alias))
+	}
+	tag, err := s.pool.Exec(ctx, `DELETE FROM urls WHERE alias = $1 AND owner = $2`, alias, owner)
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return trace.WrapError(s.ownerError(ctx, alias))
+	}
+	return nil
+}
+
+// NextSequence returns next value of the sequence used by the counter alias strategy
+func (s *postgresUrlStore) NextSequence() (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var value int64
+	if err := s.pool.QueryRow(ctx, `SELECT nextval('alias_sequence')`).Scan(&value); err != nil {
+		return 0, trace.WrapError(err)
+	}
+	return uint64(value), nil
+}
@@ -0,0 +1,84 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/mattn/go-sqlite3"
+	"github.com/sajoniks/GoShort/internal/auth"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"strings"
+	"time"
+)
+
+func (s *sqliteUrlStore) AddApiKey(owner, keyHash string) (int64, error) {
+	if strings.TrimSpace(owner) == "" {
+		return 0, trace.WrapError(auth.ErrOwnerEmpty)
+	}
+
+	res, err := s.writeDb.Exec(`INSERT INTO api_keys (owner, key_hash, created_at) VALUES (?, ?, ?)`,
+		owner, keyHash, time.Now().Unix())
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return 0, trace.WrapError(auth.ErrKeyExists)
+		}
+		return 0, trace.WrapError(storeError(err))
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, trace.WrapError(err)
+	}
+	return id, nil
+}
+
+func (s *sqliteUrlStore) GetApiKeyOwner(keyHash string) (string, error) {
+	defer s.observe("get_api_key_owner", time.Now())
+
+	var owner string
+	err := s.getApiKeyOwnerStmt.QueryRow(keyHash).Scan(&owner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", trace.WrapError(auth.ErrKeyNotFound)
+		}
+		return "", trace.WrapError(storeError(err))
+	}
+	return owner, nil
+}
+
+func (s *sqliteUrlStore) ListApiKeys() ([]auth.ApiKey, error) {
+	rows, err := s.readDb.Query(`SELECT id, owner, created_at FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, trace.WrapError(err)
+	}
+	defer rows.Close()
+
+	var keys []auth.ApiKey
+	for rows.Next() {
+		var key auth.ApiKey
+		var createdAt int64
+		if err := rows.Scan(&key.ID, &key.Owner, &createdAt); err != nil {
+			return nil, trace.WrapError(err)
+		}
+		key.CreatedAt = time.Unix(createdAt, 0).UTC()
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, trace.WrapError(err)
+	}
+	return keys, nil
+}
+
+func (s *sqliteUrlStore) DeleteApiKey(id int64) error {
+	res, err := s.writeDb.Exec(`DELETE FROM api_keys WHERE id = ?`, id)
+	if err != nil {
+		return trace.WrapError(storeError(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	if n == 0 {
+		return trace.WrapError(auth.ErrKeyNotFound)
+	}
+	return nil
+}
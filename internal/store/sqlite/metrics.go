@@ -0,0 +1,43 @@
+package sqlite
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+type StoreMetricsService interface {
+	// RecordQueryDuration records duration of the store operation, including waiting for a free connection
+	RecordQueryDuration(operation string, d time.Duration)
+}
+
+type noOpSqliteMetrics struct {
+}
+
+func (n noOpSqliteMetrics) RecordQueryDuration(operation string, d time.Duration) {
+}
+
+func NewNoOpMetrics() StoreMetricsService {
+	return &noOpSqliteMetrics{}
+}
+
+type Metrics struct {
+	queryDuration *prometheus.HistogramVec
+}
+
+func (m *Metrics) RecordQueryDuration(operation string, d time.Duration) {
+	m.queryDuration.With(prometheus.Labels{"operation": operation}).Observe(d.Seconds())
+}
+
+func NewStoreMetrics(reg prometheus.Registerer) *Metrics {
+	s := &Metrics{
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "persist",
+			Subsystem: "sqlite3",
+			Name:      "query_duration_seconds",
+			Help:      "duration of the store operations",
+			Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 5},
+		}, []string{"operation"}),
+	}
+	reg.MustRegister(s.queryDuration)
+	return s
+}
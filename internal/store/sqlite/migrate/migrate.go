@@ -0,0 +1,294 @@
+// Package migrate applies versioned schema migrations to sqlite databases.
+//
+// Migrations are read from files named "<version>_<name>.up.sql" and "<version>_<name>.down.sql".
+// Versions start from 1 and have no gaps. Applied versions are kept in schema_version table
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoMigrations   = errors.New("no migrations found")
+	ErrVersionGap     = errors.New("migration versions must start from 1 and have no gaps")
+	ErrMissingUp      = errors.New("migration has no up file")
+	ErrMissingDown    = errors.New("migration has no down file")
+	ErrUnknownVersion = errors.New("database schema version is newer than known migrations")
+	ErrInvalidName    = errors.New("invalid migration file name")
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is the state of the migration in the database
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Load reads migrations from the root of fsys. Files with other extensions are ignored
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		direction := path.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+		if direction != ".up" && direction != ".down" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidName, e.Name())
+		}
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidName, e.Name())
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidName, e.Name())
+		}
+
+		bs, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("%w: %s has different name than version %d", ErrInvalidName, e.Name(), version)
+		}
+		if direction == ".up" {
+			m.Up = string(bs)
+		} else {
+			m.Down = string(bs)
+		}
+	}
+
+	if len(byVersion) == 0 {
+		return nil, ErrNoMigrations
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, ErrVersionGap
+		}
+		if m.Up == "" {
+			return nil, fmt.Errorf("%w: version %d", ErrMissingUp, m.Version)
+		}
+		if m.Down == "" {
+			return nil, fmt.Errorf("%w: version %d", ErrMissingDown, m.Version)
+		}
+	}
+	return migrations, nil
+}
+
+// BaselineFunc returns schema version of the database created before migrations were introduced.
+// It is called once, when schema_version table does not exist yet
+type BaselineFunc func(tx *sql.Tx) (int, error)
+
+type Option func(m *Migrator)
+
+// WithBaseline sets function that detects version of the database without schema_version table
+func WithBaseline(f BaselineFunc) Option {
+	return func(m *Migrator) {
+		m.baseline = f
+	}
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	baseline   BaselineFunc
+}
+
+// New creates Migrator of migrations returned by Load
+func New(db *sql.DB, migrations []Migration, opts ...Option) *Migrator {
+	m := &Migrator{db: db, migrations: migrations}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// prepare creates schema_version table if it does not exist and returns applied versions
+func (m *Migrator) prepare(tx *sql.Tx) (map[int]time.Time, error) {
+	var exists int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		_, err = tx.Exec(`
+			CREATE TABLE schema_version(
+				version INTEGER PRIMARY KEY,
+				name TEXT NOT NULL,
+				applied_at INTEGER NOT NULL)`)
+		if err != nil {
+			return nil, err
+		}
+
+		if m.baseline != nil {
+			version, err := m.baseline(tx)
+			if err != nil {
+				return nil, fmt.Errorf("baseline: %w", err)
+			}
+			if version > len(m.migrations) {
+				return nil, ErrUnknownVersion
+			}
+			for _, mg := range m.migrations[:version] {
+				if err := markApplied(tx, mg); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	rows, err := tx.Query(`SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		if version > len(m.migrations) {
+			return nil, ErrUnknownVersion
+		}
+		applied[version] = time.Unix(appliedAt, 0).UTC()
+	}
+	return applied, rows.Err()
+}
+
+func markApplied(tx *sql.Tx, mg Migration) error {
+	_, err := tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`,
+		mg.Version, mg.Name, time.Now().Unix())
+	return err
+}
+
+// Up applies all pending migrations in a single transaction and returns the number of applied migrations
+func (m *Migrator) Up() (int, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	applied, err := m.prepare(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, mg := range m.migrations {
+		if _, ok := applied[mg.Version]; ok {
+			continue
+		}
+		if _, err := tx.Exec(mg.Up); err != nil {
+			return 0, fmt.Errorf("migration %d %s: %w", mg.Version, mg.Name, err)
+		}
+		if err := markApplied(tx, mg); err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Down reverts up to steps latest applied migrations in a single transaction
+// and returns the number of reverted migrations
+func (m *Migrator) Down(steps int) (int, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	applied, err := m.prepare(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+		mg := m.migrations[i]
+		if _, ok := applied[mg.Version]; !ok {
+			continue
+		}
+		if _, err := tx.Exec(mg.Down); err != nil {
+			return 0, fmt.Errorf("migration %d %s: %w", mg.Version, mg.Name, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM schema_version WHERE version = ?`, mg.Version); err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Status returns all known migrations with their state
+func (m *Migrator) Status() ([]Status, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	applied, err := m.prepare(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, mg := range m.migrations {
+		statuses[i].Migration = mg
+		statuses[i].AppliedAt, statuses[i].Applied = applied[mg.Version]
+	}
+
+	// schema_version table may have been created by prepare
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
@@ -0,0 +1,169 @@
+package migrate
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+var testFiles = fstest.MapFS{
+	"0001_create_a.up.sql":   {Data: []byte(`CREATE TABLE a(id INTEGER);`)},
+	"0001_create_a.down.sql": {Data: []byte(`DROP TABLE a;`)},
+	"0002_create_b.up.sql":   {Data: []byte(`CREATE TABLE b(id INTEGER); CREATE INDEX idx_b ON b(id);`)},
+	"0002_create_b.down.sql": {Data: []byte(`DROP TABLE b;`)},
+	"README.md":              {Data: []byte(`ignored`)},
+}
+
+func openDb(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	// every connection of in-memory database is a new database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var n int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n))
+	return n > 0
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(testFiles)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	require.Equal(t, 1, migrations[0].Version)
+	require.Equal(t, "create_a", migrations[0].Name)
+	require.Equal(t, "DROP TABLE b;", migrations[1].Down)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tt := []struct {
+		name  string
+		files fstest.MapFS
+		err   error
+	}{
+		{
+			name:  "empty",
+			files: fstest.MapFS{},
+			err:   ErrNoMigrations,
+		},
+		{
+			name: "gap",
+			files: fstest.MapFS{
+				"0002_b.up.sql":   {Data: []byte(`SELECT 1;`)},
+				"0002_b.down.sql": {Data: []byte(`SELECT 1;`)},
+			},
+			err: ErrVersionGap,
+		},
+		{
+			name: "missing down",
+			files: fstest.MapFS{
+				"0001_a.up.sql": {Data: []byte(`SELECT 1;`)},
+			},
+			err: ErrMissingDown,
+		},
+		{
+			name: "invalid name",
+			files: fstest.MapFS{
+				"first.up.sql": {Data: []byte(`SELECT 1;`)},
+			},
+			err: ErrInvalidName,
+		},
+		{
+			name: "invalid direction",
+			files: fstest.MapFS{
+				"0001_a.sql": {Data: []byte(`SELECT 1;`)},
+			},
+			err: ErrInvalidName,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(tc.files)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestMigrator_UpDown(t *testing.T) {
+	db := openDb(t)
+	migrations, err := Load(testFiles)
+	require.NoError(t, err)
+	m := New(db, migrations)
+
+	n, err := m.Up()
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.True(t, tableExists(t, db, "a"))
+	require.True(t, tableExists(t, db, "b"))
+
+	n, err = m.Up()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	n, err = m.Down(1)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.True(t, tableExists(t, db, "a"))
+	require.False(t, tableExists(t, db, "b"))
+
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	require.True(t, statuses[0].Applied)
+	require.False(t, statuses[0].AppliedAt.IsZero())
+	require.False(t, statuses[1].Applied)
+
+	n, err = m.Down(5)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.False(t, tableExists(t, db, "a"))
+}
+
+func TestMigrator_UpIsAtomic(t *testing.T) {
+	db := openDb(t)
+	files := fstest.MapFS{
+		"0001_create_a.up.sql":   testFiles["0001_create_a.up.sql"],
+		"0001_create_a.down.sql": testFiles["0001_create_a.down.sql"],
+		"0002_broken.up.sql":     {Data: []byte(`CREATE TABLE;`)},
+		"0002_broken.down.sql":   {Data: []byte(`SELECT 1;`)},
+	}
+	migrations, err := Load(files)
+	require.NoError(t, err)
+
+	_, err = New(db, migrations).Up()
+	require.Error(t, err)
+	require.False(t, tableExists(t, db, "a"))
+}
+
+func TestMigrator_Baseline(t *testing.T) {
+	db := openDb(t)
+	_, err := db.Exec(`CREATE TABLE a(id INTEGER)`)
+	require.NoError(t, err)
+
+	migrations, err := Load(testFiles)
+	require.NoError(t, err)
+	m := New(db, migrations, WithBaseline(func(tx *sql.Tx) (int, error) {
+		return 1, nil
+	}))
+
+	n, err := m.Up()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.True(t, tableExists(t, db, "b"))
+}
+
+func TestMigrator_UnknownVersion(t *testing.T) {
+	db := openDb(t)
+	migrations, err := Load(testFiles)
+	require.NoError(t, err)
+
+	_, err = New(db, migrations).Up()
+	require.NoError(t, err)
+
+	_, err = New(db, migrations[:1]).Up()
+	require.ErrorIs(t, err, ErrUnknownVersion)
+}
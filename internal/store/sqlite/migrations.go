@@ -0,0 +1,81 @@
+package sqlite
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"github.com/sajoniks/GoShort/internal/store/sqlite/migrate"
+	"io/fs"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// NewMigrator creates migrator of the store schema
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	files, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := migrate.Load(files)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, migrations, migrate.WithBaseline(legacyVersion)), nil
+}
+
+// legacyVersion detects schema version of the database created before migrations were introduced,
+// when schema was created on start and columns were added if missing
+func legacyVersion(tx *sql.Tx) (int, error) {
+	hasUrls, err := tableExists(tx, "urls")
+	if err != nil || !hasUrls {
+		return 0, err
+	}
+
+	// the first versions created urls table without unique alias index
+	version := 1
+	hasUniqueAlias, err := indexExists(tx, "idx_alias_unique")
+	if err != nil || !hasUniqueAlias {
+		return version, err
+	}
+	version++
+	for _, column := range []string{"expires_at", "owner"} {
+		ok, err := columnExists(tx, "urls", column)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return version, nil
+		}
+		version++
+	}
+	for _, table := range []string{"api_keys", "alias_sequence"} {
+		ok, err := tableExists(tx, table)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return version, nil
+		}
+		version++
+	}
+	return version, nil
+}
+
+func tableExists(tx *sql.Tx, table string) (bool, error) {
+	var n int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n)
+	return n > 0, err
+}
+
+func indexExists(tx *sql.Tx, index string) (bool, error) {
+	var n int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, index).Scan(&n)
+	return n > 0, err
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	var n int
+	err := tx.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM pragma_table_info('%s') WHERE name = ?`, table), column).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS urls(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    alias TEXT NOT NULL,
+    url TEXT NOT NULL,
+    CHECK(trim(alias, ' ') <> '' AND trim(url, ' ') <> ''),
+    UNIQUE (alias, url));
+CREATE INDEX IF NOT EXISTS idx_alias ON urls(alias);
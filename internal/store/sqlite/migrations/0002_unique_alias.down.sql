@@ -0,0 +1 @@
+DROP INDEX idx_alias_unique;
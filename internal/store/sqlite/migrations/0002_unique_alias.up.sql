@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alias_unique ON urls(alias);
@@ -0,0 +1,2 @@
+DROP INDEX idx_expires_at;
+ALTER TABLE urls DROP COLUMN expires_at;
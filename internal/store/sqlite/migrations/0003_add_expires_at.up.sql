@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN expires_at INTEGER;
+CREATE INDEX idx_expires_at ON urls(expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX idx_owner_url;
+ALTER TABLE urls DROP COLUMN owner;
@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN owner TEXT;
+CREATE INDEX idx_owner_url ON urls(owner, url);
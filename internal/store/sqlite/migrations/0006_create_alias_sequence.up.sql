@@ -0,0 +1,4 @@
+CREATE TABLE alias_sequence(
+    id INTEGER PRIMARY KEY CHECK(id = 1),
+    value INTEGER NOT NULL);
+INSERT INTO alias_sequence (id, value) VALUES (1, 0);
@@ -0,0 +1,4 @@
+CREATE TABLE outbox(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    payload BLOB NOT NULL,
+    created_at INTEGER NOT NULL);
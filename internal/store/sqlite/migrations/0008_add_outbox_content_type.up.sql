@@ -0,0 +1 @@
+ALTER TABLE outbox ADD COLUMN content_type TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE outbox ADD COLUMN message_key TEXT NOT NULL DEFAULT '';
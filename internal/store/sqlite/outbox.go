@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"database/sql"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"time"
+)
+
+// insertMessages writes messages to the outbox within tx
+func (s *sqliteUrlStore) insertMessages(tx *sql.Tx, messages []urlstore.OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	stmt := tx.Stmt(s.insertMessageStmt)
+	defer stmt.Close()
+
+	now := time.Now().Unix()
+	for _, m := range messages {
+		if _, err := stmt.Exec(m.Key, m.ContentType, m.Payload, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteUrlStore) AddMessages(messages ...urlstore.OutboxMessage) error {
+	defer s.observe("add_messages", time.Now())
+
+	if len(messages) == 0 {
+		return nil
+	}
+	tx, err := s.writeDb.Begin()
+	if err != nil {
+		return trace.WrapError(storeError(err))
+	}
+	defer tx.Rollback()
+
+	if err := s.insertMessages(tx, messages); err != nil {
+		return trace.WrapError(storeError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return trace.WrapError(storeError(err))
+	}
+	return nil
+}
+
+func (s *sqliteUrlStore) PendingMessages(limit int) ([]urlstore.OutboxMessage, error) {
+	defer s.observe("pending_messages", time.Now())
+
+	rows, err := s.pendingMessagesStmt.Query(limit)
+	if err != nil {
+		return nil, trace.WrapError(storeError(err))
+	}
+	defer rows.Close()
+
+	var messages []urlstore.OutboxMessage
+	for rows.Next() {
+		var m urlstore.OutboxMessage
+		if err := rows.Scan(&m.ID, &m.Key, &m.ContentType, &m.Payload); err != nil {
+			return nil, trace.WrapError(err)
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, trace.WrapError(storeError(err))
+	}
+	return messages, nil
+}
+
+func (s *sqliteUrlStore) MarkSent(ids ...int64) error {
+	defer s.observe("mark_sent", time.Now())
+
+	if len(ids) == 0 {
+		return nil
+	}
+	tx, err := s.writeDb.Begin()
+	if err != nil {
+		return trace.WrapError(storeError(err))
+	}
+	defer tx.Rollback()
+
+	stmt := tx.Stmt(s.deleteMessageStmt)
+	defer stmt.Close()
+	for _, id := range ids {
+		if _, err := stmt.Exec(id); err != nil {
+			return trace.WrapError(storeError(err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return trace.WrapError(storeError(err))
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package sqlite
+
+import (
+	"github.com/sajoniks/GoShort/internal/trace"
+	"time"
+)
+
+// NextSequence increments and returns the persistent counter used by the counter alias strategy
+func (s *sqliteUrlStore) NextSequence() (uint64, error) {
+	defer s.observe("next_sequence", time.Now())
+
+	var value uint64
+	if err := s.nextSequenceStmt.QueryRow().Scan(&value); err != nil {
+		return 0, trace.WrapError(storeError(err))
+	}
+	return value, nil
+}
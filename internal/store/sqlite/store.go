@@ -6,149 +6,394 @@ import (
 	"fmt"
 	"github.com/mattn/go-sqlite3"
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sajoniks/GoShort/internal/store/interface"
 	"github.com/sajoniks/GoShort/internal/trace"
-	"sync"
+	"runtime"
+	"strings"
 	"time"
 )
 
+const (
+	// busyTimeout is how long connection waits for the database lock before SQLITE_BUSY is returned
+	busyTimeout = time.Second * 5
+	// minReadConns is the minimal size of the read pool
+	minReadConns = 4
+)
+
+// sqliteUrlStore uses WAL journal, so readers do not block the writer and vice versa.
+// Writes go through a single connection, reads use a pool of read-only connections
 type sqliteUrlStore struct {
-	db      *sql.DB
-	mx      sync.RWMutex
+	writeDb *sql.DB
+	readDb  *sql.DB
 	metrics StoreMetricsService
+
+	// read statements
+	getUrlStmt          *sql.Stmt
+	findAliasStmt       *sql.Stmt
+	aliasExistsStmt     *sql.Stmt
+	getApiKeyOwnerStmt  *sql.Stmt
+	pendingMessagesStmt *sql.Stmt
+
+	// write statements
+	insertUrlStmt     *sql.Stmt
+	updateUrlStmt     *sql.Stmt
+	deleteUrlStmt     *sql.Stmt
+	purgeExpiredStmt  *sql.Stmt
+	nextSequenceStmt  *sql.Stmt
+	insertMessageStmt *sql.Stmt
+	deleteMessageStmt *sql.Stmt
 }
 
 func (s *sqliteUrlStore) Close() {
-	s.db.Close()
+	for _, stmt := range []*sql.Stmt{
+		s.getUrlStmt, s.findAliasStmt, s.aliasExistsStmt, s.getApiKeyOwnerStmt, s.pendingMessagesStmt,
+		s.insertUrlStmt, s.updateUrlStmt, s.deleteUrlStmt, s.purgeExpiredStmt, s.nextSequenceStmt,
+		s.insertMessageStmt, s.deleteMessageStmt,
+	} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	if s.readDb != s.writeDb {
+		s.readDb.Close()
+	}
+	s.writeDb.Close()
 }
 
-type StoreMetricsService interface {
-	RecordReadLockTime(d time.Duration)
-	RecordWriteLockTime(d time.Duration)
+// isMemory reports whether connString is in-memory database, which is not shared between connections
+func isMemory(connString string) bool {
+	return strings.Contains(connString, ":memory:") || strings.Contains(connString, "mode=memory")
 }
 
-type noOpSqliteMetrics struct {
+// withParams appends driver parameters to the connection string
+func withParams(connString string, params ...string) string {
+	if !strings.HasPrefix(connString, "file:") {
+		connString = "file:" + connString
+	}
+	sep := "?"
+	if strings.Contains(connString, "?") {
+		sep = "&"
+	}
+	return connString + sep + strings.Join(params, "&")
 }
 
-func (n noOpSqliteMetrics) RecordReadLockTime(d time.Duration) {
+func NewSqliteStore(connString string, metrics StoreMetricsService) (urlstore.CloseableStore, error) {
+	busy := fmt.Sprintf("_busy_timeout=%d", busyTimeout.Milliseconds())
+
+	// transactions take the write lock on begin, so they never fail on lock upgrade
+	writeDb, err := sql.Open("sqlite3", withParams(connString, "_journal_mode=WAL", busy, "_txlock=immediate"))
+	if err != nil {
+		return nil, trace.WrapError(err)
+	}
+	writeDb.SetMaxOpenConns(1)
+
+	s := &sqliteUrlStore{writeDb: writeDb, readDb: writeDb, metrics: metrics}
+
+	if !isMemory(connString) {
+		s.readDb, err = sql.Open("sqlite3", withParams(connString, busy, "_query_only=true"))
+		if err != nil {
+			writeDb.Close()
+			return nil, trace.WrapError(err)
+		}
+		readConns := max(minReadConns, runtime.NumCPU())
+		s.readDb.SetMaxOpenConns(readConns)
+		s.readDb.SetMaxIdleConns(readConns)
+	}
+
+	migrator, err := NewMigrator(writeDb)
+	if err != nil {
+		s.Close()
+		return nil, trace.WrapError(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		s.Close()
+		return nil, trace.WrapError(err)
+	}
+
+	if err := s.prepare(); err != nil {
+		s.Close()
+		return nil, trace.WrapError(err)
+	}
+	return s, nil
 }
 
-func (n noOpSqliteMetrics) RecordWriteLockTime(d time.Duration) {
+// prepare prepares statements once for the lifetime of the store
+func (s *sqliteUrlStore) prepare() error {
+	for _, p := range []struct {
+		db    *sql.DB
+		stmt  **sql.Stmt
+		query string
+	}{
+		{s.readDb, &s.getUrlStmt, `SELECT url, expires_at FROM urls WHERE alias = ?`},
+		{s.readDb, &s.findAliasStmt, `
+			SELECT alias FROM urls
+			WHERE owner IS ? AND url = ? AND expires_at IS NULL
+			ORDER BY id LIMIT 1`},
+		{s.readDb, &s.aliasExistsStmt, `SELECT EXISTS (SELECT 1 FROM urls WHERE alias = ?)`},
+		{s.readDb, &s.getApiKeyOwnerStmt, `SELECT owner FROM api_keys WHERE key_hash = ?`},
+		{s.readDb, &s.pendingMessagesStmt, `SELECT id, message_key, content_type, payload FROM outbox ORDER BY id LIMIT ?`},
+		{s.writeDb, &s.insertUrlStmt, `INSERT INTO urls (alias, url, expires_at, owner) VALUES (?, ?, ?, ?)`},
+		{s.writeDb, &s.updateUrlStmt, `UPDATE urls SET url = ? WHERE alias = ? AND owner = ?`},
+		{s.writeDb, &s.deleteUrlStmt, `DELETE FROM urls WHERE alias = ? AND owner = ?`},
+		{s.writeDb, &s.purgeExpiredStmt, `DELETE FROM urls WHERE expires_at IS NOT NULL AND expires_at <= ?`},
+		{s.writeDb, &s.nextSequenceStmt, `UPDATE alias_sequence SET value = value + 1 WHERE id = 1 RETURNING value`},
+		{s.writeDb, &s.insertMessageStmt, `INSERT INTO outbox (message_key, content_type, payload, created_at) VALUES (?, ?, ?, ?)`},
+		{s.writeDb, &s.deleteMessageStmt, `DELETE FROM outbox WHERE id = ?`},
+	} {
+		stmt, err := p.db.Prepare(p.query)
+		if err != nil {
+			return err
+		}
+		*p.stmt = stmt
+	}
+	return nil
 }
 
-func NewNoOpMetrics() StoreMetricsService {
-	return &noOpSqliteMetrics{}
+// observe records duration of the operation started at start
+func (s *sqliteUrlStore) observe(operation string, start time.Time) {
+	s.metrics.RecordQueryDuration(operation, time.Since(start))
 }
 
-type Metrics struct {
-	lockTime *prometheus.GaugeVec
+// storeError maps errors of the database that was locked for too long to urlstore.ErrStoreBusy
+func storeError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked) {
+		return errors.Join(urlstore.ErrStoreBusy, err)
+	}
+	return err
 }
 
-func (m *Metrics) RecordReadLockTime(d time.Duration) {
-	m.lockTime.With(prometheus.Labels{"type": "read"}).Set(d.Seconds())
+// ownerParam is the owner column value, anonymous urls have no owner
+func ownerParam(owner string) sql.NullString {
+	return sql.NullString{String: owner, Valid: owner != ""}
 }
 
-func (m *Metrics) RecordWriteLockTime(d time.Duration) {
-	m.lockTime.With(prometheus.Labels{"type": "write"}).Set(d.Seconds())
+func (s *sqliteUrlStore) GetURL(alias string) (string, error) {
+	resultUrl, _, err := s.GetURLExpiry(alias)
+	return resultUrl, err
 }
 
-func NewStoreMetrics(reg prometheus.Registerer) *Metrics {
-	s := &Metrics{
-		lockTime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: "persist",
-			Subsystem: "sqlite3",
-			Name:      "lock_wait_time",
-			Help:      "amount of time waiting for lock be available",
-		}, []string{"type"}),
+func (s *sqliteUrlStore) GetURLExpiry(alias string) (string, time.Time, error) {
+	defer s.observe("get_url", time.Now())
+
+	var resultUrl string
+	var expiresAt sql.NullInt64
+	err := s.getUrlStmt.QueryRow(alias).Scan(&resultUrl, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", time.Time{}, trace.WrapError(urlstore.ErrUrlNotFound)
+		}
+		return "", time.Time{}, trace.WrapError(storeError(err))
 	}
-	reg.MustRegister(s.lockTime)
-	return s
+
+	if !expiresAt.Valid {
+		return resultUrl, time.Time{}, nil
+	}
+	if expiresAt.Int64 <= time.Now().Unix() {
+		return "", time.Time{}, trace.WrapError(urlstore.ErrUrlExpired)
+	}
+	return resultUrl, time.Unix(expiresAt.Int64, 0), nil
 }
 
-func NewSqliteStore(connString string, metrics StoreMetricsService) (urlstore.CloseableStore, error) {
-	db, err := sql.Open("sqlite3", connString)
+func (s *sqliteUrlStore) FindAlias(src, owner string) (string, error) {
+	defer s.observe("find_alias", time.Now())
+
+	var alias string
+	err := s.findAliasStmt.QueryRow(ownerParam(owner), src).Scan(&alias)
 	if err != nil {
-		return nil, trace.WrapError(err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", trace.WrapError(urlstore.ErrUrlNotFound)
+		}
+		return "", trace.WrapError(storeError(err))
 	}
+	return alias, nil
+}
 
-	stmt, err := db.Prepare(`
-		CREATE TABLE IF NOT EXISTS urls(
-    		id INTEGER PRIMARY KEY AUTOINCREMENT,
-    		alias TEXT NOT NULL,
-    		url TEXT NOT NULL,
-    		CHECK(trim(alias, ' ') <> '' AND trim(url, ' ') <> ''),
-    		UNIQUE (alias, url));
-		CREATE INDEX IF NOT EXISTS idx_alias ON urls(alias);
-	`)
+func (s *sqliteUrlStore) PurgeExpired() (int64, error) {
+	defer s.observe("purge_expired", time.Now())
+
+	res, err := s.purgeExpiredStmt.Exec(time.Now().Unix())
 	if err != nil {
-		return nil, trace.WrapError(err)
+		return 0, trace.WrapError(storeError(err))
 	}
-
-	_, err = stmt.Exec()
+	n, err := res.RowsAffected()
 	if err != nil {
-		return nil, trace.WrapError(err)
+		return 0, trace.WrapError(err)
 	}
-
-	s := &sqliteUrlStore{db: db, metrics: metrics}
-	return s, nil
+	return n, nil
 }
 
-func (s *sqliteUrlStore) GetURL(alias string) (string, error) {
+func (s *sqliteUrlStore) SaveURL(src, alias string, opts ...urlstore.SaveOption) (string, error) {
+	defer s.observe("save_url", time.Now())
 
-	t1 := time.Now()
-	s.mx.RLock()
-	defer s.mx.RUnlock()
-	t2 := time.Since(t1)
+	if len(alias) == 0 {
+		return "", trace.WrapError(urlstore.ErrAliasEmpty)
+	}
+	if len(src) == 0 {
+		return "", trace.WrapError(urlstore.ErrUrlEmpty)
+	}
+
+	o := urlstore.NewSaveOptions(opts...)
+	if len(o.Messages) == 0 {
+		id, err := insertUrl(s.insertUrlStmt, src, alias, o)
+		if err != nil {
+			return "", trace.WrapError(err)
+		}
+		return id, nil
+	}
 
-	s.metrics.RecordReadLockTime(t2)
+	// messages are written in the same transaction, so they are published only if the url is saved
+	tx, err := s.writeDb.Begin()
+	if err != nil {
+		return "", trace.WrapError(storeError(err))
+	}
+	defer tx.Rollback()
 
-	stmt, err := s.db.Prepare(`SELECT url FROM urls WHERE alias = ?`)
+	id, err := insertUrl(tx.Stmt(s.insertUrlStmt), src, alias, o)
 	if err != nil {
 		return "", trace.WrapError(err)
 	}
-	var resultUrl string
-	err = stmt.QueryRow(alias).Scan(&resultUrl)
+	if err := s.insertMessages(tx, o.Messages); err != nil {
+		return "", trace.WrapError(storeError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return "", trace.WrapError(storeError(err))
+	}
+	return id, nil
+}
+
+// insertUrl executes prepared insert statement and maps constraint violations to store errors
+func insertUrl(stmt *sql.Stmt, src, alias string, o urlstore.SaveOptions) (string, error) {
+	var expiresAt sql.NullInt64
+	if !o.ExpiresAt.IsZero() {
+		expiresAt = sql.NullInt64{Int64: o.ExpiresAt.Unix(), Valid: true}
+	}
+
+	res, err := stmt.Exec(alias, src, expiresAt, ownerParam(o.Owner))
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", trace.WrapError(urlstore.ErrUrlNotFound)
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return "", urlstore.ErrAliasExists
 		}
-		return "", trace.WrapError(err)
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintCheck) {
+			return "", urlstore.ErrUrlEmpty
+		}
+		return "", storeError(err)
 	}
 
-	return resultUrl, nil
+	id, err := res.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(id), nil
 }
 
-func (s *sqliteUrlStore) SaveURL(src, alias string) (string, error) {
+func (s *sqliteUrlStore) SaveURLs(items []urlstore.BatchItem) ([]urlstore.BatchResult, error) {
+	defer s.observe("save_urls", time.Now())
+
+	tx, err := s.writeDb.Begin()
+	if err != nil {
+		return nil, trace.WrapError(storeError(err))
+	}
+	defer tx.Rollback()
+
+	stmt := tx.Stmt(s.insertUrlStmt)
+	defer stmt.Close()
+
+	// failed statement is rolled back by sqlite on its own, so the rest of the transaction is kept
+	results := make([]urlstore.BatchResult, len(items))
+	for i, item := range items {
+		if len(item.Alias) == 0 {
+			results[i].Err = trace.WrapError(urlstore.ErrAliasEmpty)
+			continue
+		}
+		if len(item.Source) == 0 {
+			results[i].Err = trace.WrapError(urlstore.ErrUrlEmpty)
+			continue
+		}
+		id, err := insertUrl(stmt, item.Source, item.Alias, item.Options)
+		if err != nil {
+			// only constraint violations are item errors, anything else fails the whole batch
+			if !errors.Is(err, urlstore.ErrAliasExists) && !errors.Is(err, urlstore.ErrUrlEmpty) {
+				return nil, trace.WrapError(err)
+			}
+			results[i].Err = trace.WrapError(err)
+			continue
+		}
+		if err := s.insertMessages(tx, item.Options.Messages); err != nil {
+			return nil, trace.WrapError(storeError(err))
+		}
+		results[i].ID = id
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, trace.WrapError(storeError(err))
+	}
+	return results, nil
+}
 
-	t1 := time.Now()
-	s.mx.Lock()
-	defer s.mx.Unlock()
-	t2 := time.Since(t1)
+// ownerError tells apart missing alias and alias of another owner, when the owned alias was not changed
+func (s *sqliteUrlStore) ownerError(alias string) error {
+	var exists bool
+	if err := s.aliasExistsStmt.QueryRow(alias).Scan(&exists); err != nil {
+		return storeError(err)
+	}
+	if exists {
+		return urlstore.ErrNotOwner
+	}
+	return urlstore.ErrUrlNotFound
+}
 
-	s.metrics.RecordWriteLockTime(t2)
+func (s *sqliteUrlStore) UpdateURL(alias, src, owner string) error {
+	defer s.observe("update_url", time.Now())
 
 	if len(alias) == 0 {
-		return "", trace.WrapError(urlstore.ErrAliasEmpty)
+		return trace.WrapError(urlstore.ErrAliasEmpty)
 	}
 	if len(src) == 0 {
-		return "", trace.WrapError(urlstore.ErrUrlEmpty)
+		return trace.WrapError(urlstore.ErrUrlEmpty)
 	}
-	stmt, err := s.db.Prepare(`INSERT INTO urls (alias, url) VALUES (?, ?)`)
-	if err != nil {
-		return "", trace.WrapError(err)
+	if owner == "" {
+		// anonymous urls can not be managed
+		return trace.WrapError(s.ownerError(alias))
 	}
-	res, err := stmt.Exec(alias, src)
+	res, err := s.updateUrlStmt.Exec(src, alias, owner)
 	if err != nil {
 		var sqliteErr sqlite3.Error
-		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
-			return "", trace.WrapError(urlstore.ErrUrlExists)
-		}
 		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintCheck) {
-			return "", trace.WrapError(urlstore.ErrUrlExists)
+			return trace.WrapError(urlstore.ErrUrlEmpty)
 		}
-		return "", trace.WrapError(err)
+		return trace.WrapError(storeError(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	if n == 0 {
+		return trace.WrapError(s.ownerError(alias))
 	}
+	return nil
+}
+
+func (s *sqliteUrlStore) DeleteURL(alias, owner string) error {
+	defer s.observe("delete_url", time.Now())
 
-	return fmt.Sprint(res.LastInsertId()), nil
+	if len(alias) == 0 {
+		return trace.WrapError(urlstore.ErrAliasEmpty)
+	}
+	if owner == "" {
+		return trace.WrapError(s.ownerError(alias))
+	}
+	res, err := s.deleteUrlStmt.Exec(alias, owner)
+	if err != nil {
+		return trace.WrapError(storeError(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return trace.WrapError(err)
+	}
+	if n == 0 {
+		return trace.WrapError(s.ownerError(alias))
+	}
+	return nil
 }
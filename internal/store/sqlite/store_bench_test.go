@@ -0,0 +1,135 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	urlstore "github.com/sajoniks/GoShort/internal/store/interface"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// mutexStore is the store implementation before WAL mode: single connection pool in rollback journal mode,
+// guarded by RWMutex, and statements prepared on every call. It is kept only to compare with sqliteUrlStore
+type mutexStore struct {
+	db *sql.DB
+	mx sync.RWMutex
+}
+
+func newMutexStore(b *testing.B, path string) *mutexStore {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	return &mutexStore{db: db}
+}
+
+func (s *mutexStore) GetURL(alias string) (string, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	stmt, err := s.db.Prepare(`SELECT url, expires_at FROM urls WHERE alias = ?`)
+	if err != nil {
+		return "", err
+	}
+	defer stmt.Close()
+
+	var url string
+	var expiresAt sql.NullInt64
+	if err := stmt.QueryRow(alias).Scan(&url, &expiresAt); err != nil {
+		return "", err
+	}
+	return url, nil
+}
+
+func (s *mutexStore) SaveURL(src, alias string, _ ...urlstore.SaveOption) (string, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	stmt, err := s.db.Prepare(`INSERT INTO urls (alias, url, expires_at, owner) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return "", err
+	}
+	defer stmt.Close()
+	return insertUrl(stmt, src, alias, urlstore.SaveOptions{})
+}
+
+type benchStore interface {
+	GetURL(alias string) (string, error)
+	SaveURL(src, alias string, opts ...urlstore.SaveOption) (string, error)
+}
+
+const benchUrls = 1000
+
+func newSqliteBenchStore(b *testing.B, path string) benchStore {
+	s, err := NewSqliteStore(path, NewNoOpMetrics())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(s.Close)
+	return s
+}
+
+// runStoreBenchmark runs parallel workload where every writeEvery-th operation is a write, the rest are reads
+func runStoreBenchmark(b *testing.B, newStore func(b *testing.B, path string) benchStore, writeEvery int64) {
+	s := newStore(b, filepath.Join(b.TempDir(), "bench.sqlite"))
+	for i := 0; i < benchUrls; i++ {
+		if _, err := s.SaveURL(fmt.Sprintf("https://example.com/%d", i), fmt.Sprintf("seed%d", i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	var counter atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := counter.Add(1)
+			if writeEvery > 0 && n%writeEvery == 0 {
+				if _, err := s.SaveURL("https://example.com/new", fmt.Sprintf("new%d", n)); err != nil {
+					b.Error(err)
+					return
+				}
+				continue
+			}
+			if _, err := s.GetURL(fmt.Sprintf("seed%d", n%benchUrls)); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkStore(b *testing.B) {
+	stores := []struct {
+		name     string
+		newStore func(b *testing.B, path string) benchStore
+	}{
+		{"mutex", func(b *testing.B, path string) benchStore { return newMutexStore(b, path) }},
+		{"wal", newSqliteBenchStore},
+	}
+	workloads := []struct {
+		name       string
+		writeEvery int64
+	}{
+		{"read", 0},
+		{"read_write_10", 10},
+		{"write", 1},
+	}
+
+	for _, w := range workloads {
+		for _, s := range stores {
+			b.Run(w.name+"/"+s.name, func(b *testing.B) {
+				runStoreBenchmark(b, s.newStore, w.writeEvery)
+			})
+		}
+	}
+}
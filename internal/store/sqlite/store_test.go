@@ -1,10 +1,19 @@
 package sqlite
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"github.com/sajoniks/GoShort/internal/auth"
 	urlstore "github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/sajoniks/GoShort/internal/store/storetest"
 	"log"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 )
 
 var store urlstore.CloseableStore
@@ -18,9 +27,10 @@ func initDb() {
 
 func cleanupDb() {
 	store.Close()
-	err := os.Remove("testdb.sqlite")
-	if err != nil {
-		log.Printf("%v", err)
+	for _, f := range []string{"testdb.sqlite", "testdb.sqlite-wal", "testdb.sqlite-shm"} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			log.Printf("%v", err)
+		}
 	}
 }
 
@@ -69,16 +79,27 @@ func Test_AddUrl(t *testing.T) {
 }
 
 func Test_AddDuplicateUrl(t *testing.T) {
-	_, err := store.SaveURL("www.site1.com", "aaa")
+	_, err := store.SaveURL("www.site1.com", "bbb")
 	if err != nil {
 		t.Fatalf("did not want an error: %v", err)
 	}
-	_, err = store.SaveURL("www.site1.com", "aaa")
+	_, err = store.SaveURL("www.site1.com", "bbb")
 	if err == nil {
 		t.Errorf("wanted an error, did not get one")
 	}
 }
 
+func Test_AddDuplicateAlias(t *testing.T) {
+	_, err := store.SaveURL("www.site2.com", "ccc")
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	_, err = store.SaveURL("www.site3.com", "ccc")
+	if !errors.Is(err, urlstore.ErrAliasExists) {
+		t.Errorf("want %v, got %v", urlstore.ErrAliasExists, err)
+	}
+}
+
 func Test_GetUrl(t *testing.T) {
 	url, err := store.GetURL("alias")
 	if err != nil {
@@ -89,3 +110,397 @@ func Test_GetUrl(t *testing.T) {
 		t.Errorf("want %q, got %q", test, url)
 	}
 }
+
+func Test_GetExpiredUrl(t *testing.T) {
+	_, err := store.SaveURL("www.expired.com", "expired", urlstore.WithExpiry(time.Now().Add(-time.Minute)))
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	_, err = store.GetURL("expired")
+	if !errors.Is(err, urlstore.ErrUrlExpired) {
+		t.Errorf("want %v, got %v", urlstore.ErrUrlExpired, err)
+	}
+}
+
+func Test_GetNotExpiredUrl(t *testing.T) {
+	_, err := store.SaveURL("www.not-expired.com", "not-expired", urlstore.WithExpiry(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	url, err := store.GetURL("not-expired")
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	if url != "www.not-expired.com" {
+		t.Errorf("want %q, got %q", "www.not-expired.com", url)
+	}
+}
+
+func Test_PurgeExpired(t *testing.T) {
+	_, err := store.SaveURL("www.purged.com", "purged", urlstore.WithExpiry(time.Now().Add(-time.Minute)))
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	n, err := store.(urlstore.ExpiredPurger).PurgeExpired()
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	if n == 0 {
+		t.Errorf("want purged entries, got none")
+	}
+	_, err = store.GetURL("purged")
+	if !errors.Is(err, urlstore.ErrUrlNotFound) {
+		t.Errorf("want %v, got %v", urlstore.ErrUrlNotFound, err)
+	}
+	_, err = store.GetURL("alias")
+	if err != nil {
+		t.Errorf("did not want an error: %v", err)
+	}
+}
+
+func Test_UpdateUrl(t *testing.T) {
+	_, err := store.SaveURL("www.before.com", "update", urlstore.WithOwner("alice"))
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	err = store.UpdateURL("update", "www.after.com", "alice")
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	url, err := store.GetURL("update")
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	if url != "www.after.com" {
+		t.Errorf("want %q, got %q", "www.after.com", url)
+	}
+}
+
+func Test_UpdateMissingUrl(t *testing.T) {
+	err := store.UpdateURL("missing", "www.after.com", "")
+	if !errors.Is(err, urlstore.ErrUrlNotFound) {
+		t.Errorf("want %v, got %v", urlstore.ErrUrlNotFound, err)
+	}
+}
+
+func Test_DeleteUrl(t *testing.T) {
+	_, err := store.SaveURL("www.deleted.com", "delete", urlstore.WithOwner("alice"))
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	err = store.DeleteURL("delete", "alice")
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	_, err = store.GetURL("delete")
+	if !errors.Is(err, urlstore.ErrUrlNotFound) {
+		t.Errorf("want %v, got %v", urlstore.ErrUrlNotFound, err)
+	}
+	err = store.DeleteURL("delete", "alice")
+	if !errors.Is(err, urlstore.ErrUrlNotFound) {
+		t.Errorf("want %v, got %v", urlstore.ErrUrlNotFound, err)
+	}
+}
+
+func Test_ManageOwnedUrl(t *testing.T) {
+	_, err := store.SaveURL("www.owned.com", "owned", urlstore.WithOwner("alice"))
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	err = store.UpdateURL("owned", "www.stolen.com", "bob")
+	if !errors.Is(err, urlstore.ErrNotOwner) {
+		t.Errorf("want %v, got %v", urlstore.ErrNotOwner, err)
+	}
+	err = store.DeleteURL("owned", "")
+	if !errors.Is(err, urlstore.ErrNotOwner) {
+		t.Errorf("want %v, got %v", urlstore.ErrNotOwner, err)
+	}
+	err = store.UpdateURL("owned", "www.owned.org", "alice")
+	if err != nil {
+		t.Errorf("did not want an error: %v", err)
+	}
+	err = store.DeleteURL("owned", "alice")
+	if err != nil {
+		t.Errorf("did not want an error: %v", err)
+	}
+}
+
+func Test_ApiKeys(t *testing.T) {
+	keys := store.(auth.KeyStore)
+
+	id, err := keys.AddApiKey("alice", auth.HashKey("secret"))
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	owner, err := keys.GetApiKeyOwner(auth.HashKey("secret"))
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	if owner != "alice" {
+		t.Errorf("want %q, got %q", "alice", owner)
+	}
+	_, err = keys.GetApiKeyOwner(auth.HashKey("wrong"))
+	if !errors.Is(err, auth.ErrKeyNotFound) {
+		t.Errorf("want %v, got %v", auth.ErrKeyNotFound, err)
+	}
+	list, err := keys.ListApiKeys()
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != id {
+		t.Errorf("want single key with id %d, got %v", id, list)
+	}
+	err = keys.DeleteApiKey(id)
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	_, err = keys.GetApiKeyOwner(auth.HashKey("secret"))
+	if !errors.Is(err, auth.ErrKeyNotFound) {
+		t.Errorf("want %v, got %v", auth.ErrKeyNotFound, err)
+	}
+}
+
+func Test_FindAlias(t *testing.T) {
+	_, err := store.SaveURL("https://dedupe.com", "dedupe", urlstore.WithOwner("alice"))
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	_, err = store.SaveURL("https://dedupe.com", "dedupe-expiring", urlstore.WithOwner("bob"), urlstore.WithExpiry(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+
+	alias, err := store.FindAlias("https://dedupe.com", "alice")
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	if alias != "dedupe" {
+		t.Errorf("want %q, got %q", "dedupe", alias)
+	}
+
+	_, err = store.FindAlias("https://dedupe.com", "bob")
+	if !errors.Is(err, urlstore.ErrUrlNotFound) {
+		t.Errorf("want %v, got %v", urlstore.ErrUrlNotFound, err)
+	}
+	_, err = store.FindAlias("https://dedupe.com", "")
+	if !errors.Is(err, urlstore.ErrUrlNotFound) {
+		t.Errorf("want %v, got %v", urlstore.ErrUrlNotFound, err)
+	}
+}
+
+func Test_SaveUrls(t *testing.T) {
+	owned := urlstore.NewSaveOptions(urlstore.WithOwner("alice"))
+	results, err := store.SaveURLs([]urlstore.BatchItem{
+		{Source: "https://batch.com/1", Alias: "batch-1", Options: owned},
+		{Source: "https://batch.com/2", Alias: "batch-1", Options: owned},
+		{Source: "", Alias: "batch-3", Options: owned},
+		{Source: "https://batch.com/4", Alias: "batch-4"},
+	})
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("want 4 results, got %d", len(results))
+	}
+
+	if results[0].Err != nil || results[0].ID == "" {
+		t.Errorf("did not want an error: %v", results[0].Err)
+	}
+	if !errors.Is(results[1].Err, urlstore.ErrAliasExists) {
+		t.Errorf("want %v, got %v", urlstore.ErrAliasExists, results[1].Err)
+	}
+	if !errors.Is(results[2].Err, urlstore.ErrUrlEmpty) {
+		t.Errorf("want %v, got %v", urlstore.ErrUrlEmpty, results[2].Err)
+	}
+	if results[3].Err != nil {
+		t.Errorf("did not want an error: %v", results[3].Err)
+	}
+
+	// failed items do not roll back the others
+	for alias, want := range map[string]string{"batch-1": "https://batch.com/1", "batch-4": "https://batch.com/4"} {
+		got, err := store.GetURL(alias)
+		if err != nil {
+			t.Fatalf("did not want an error: %v", err)
+		}
+		if got != want {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+	if err := store.DeleteURL("batch-1", "alice"); err != nil {
+		t.Errorf("did not want an error: %v", err)
+	}
+}
+
+func Test_NextSequence(t *testing.T) {
+	seq := store.(interface{ NextSequence() (uint64, error) })
+
+	first, err := seq.NextSequence()
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	second, err := seq.NextSequence()
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	if second != first+1 {
+		t.Errorf("want %d, got %d", first+1, second)
+	}
+}
+
+func Test_MigrateLegacyDb(t *testing.T) {
+	const path = "legacydb.sqlite"
+	defer os.Remove(path)
+
+	// schema of the versions before migrations, with expires_at added on start
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE urls(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alias TEXT NOT NULL,
+			url TEXT NOT NULL,
+			CHECK(trim(alias, ' ') <> '' AND trim(url, ' ') <> ''),
+			UNIQUE (alias, url));
+		CREATE INDEX idx_alias ON urls(alias);
+		CREATE UNIQUE INDEX idx_alias_unique ON urls(alias);
+		ALTER TABLE urls ADD COLUMN expires_at INTEGER;
+		INSERT INTO urls (alias, url) VALUES ('legacy', 'https://legacy.com');
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+
+	legacy, err := NewSqliteStore(path, NewNoOpMetrics())
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	defer legacy.Close()
+
+	got, err := legacy.GetURL("legacy")
+	if err != nil || got != "https://legacy.com" {
+		t.Errorf("want %q, got %q, %v", "https://legacy.com", got, err)
+	}
+	if _, err := legacy.SaveURL("https://owned.com", "owned", urlstore.WithOwner("alice")); err != nil {
+		t.Errorf("did not want an error: %v", err)
+	}
+}
+
+func Test_MigrateBaselineDb(t *testing.T) {
+	const path = "baselinedb.sqlite"
+	defer os.Remove(path)
+
+	// schema of the first version, alias was unique only together with url
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS urls(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alias TEXT NOT NULL,
+			url TEXT NOT NULL,
+			CHECK(trim(alias, ' ') <> '' AND trim(url, ' ') <> ''),
+			UNIQUE (alias, url));
+		CREATE INDEX IF NOT EXISTS idx_alias ON urls(alias);
+		INSERT INTO urls (alias, url) VALUES ('baseline', 'https://baseline.com');
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+
+	baseline, err := NewSqliteStore(path, NewNoOpMetrics())
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	defer baseline.Close()
+
+	got, err := baseline.GetURL("baseline")
+	if err != nil || got != "https://baseline.com" {
+		t.Errorf("want %q, got %q, %v", "https://baseline.com", got, err)
+	}
+	// unique alias index is created by the migration
+	_, err = baseline.SaveURL("https://other.com", "baseline")
+	if !errors.Is(err, urlstore.ErrAliasExists) {
+		t.Errorf("want %v, got %v", urlstore.ErrAliasExists, err)
+	}
+}
+
+func Test_MigrateDownUp(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	n, err := migrator.Up()
+	if err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	if _, err := migrator.Down(n); err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("did not want an error: %v", err)
+	}
+}
+
+func Test_ConcurrentSaveAndGet(t *testing.T) {
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := store.SaveURL("www.example.com/concurrent", fmt.Sprintf("concurrent%d", i)); err != nil {
+				errs <- err
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := store.GetURL("alias"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		if _, err := store.GetURL(fmt.Sprintf("concurrent%d", i)); err != nil {
+			t.Errorf("concurrent%d: %v", i, err)
+		}
+	}
+}
+
+func Test_BusyError(t *testing.T) {
+	err := storeError(sqlite3.Error{Code: sqlite3.ErrBusy})
+	if !errors.Is(err, urlstore.ErrStoreBusy) {
+		t.Errorf("wanted ErrStoreBusy, got %v", err)
+	}
+	if errors.Is(storeError(sqlite3.Error{Code: sqlite3.ErrConstraint}), urlstore.ErrStoreBusy) {
+		t.Errorf("constraint error must not be retryable")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) urlstore.Store {
+		s, err := NewSqliteStore(filepath.Join(t.TempDir(), "conformance.sqlite"), NewNoOpMetrics())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(s.Close)
+		return s
+	})
+}
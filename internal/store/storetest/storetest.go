@@ -0,0 +1,429 @@
+// Package storetest is the conformance test suite of urlstore.Store implementations.
+//
+// Every store package runs the suite from its tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) urlstore.Store { return newStore(t) })
+//	}
+//
+// Aliases and urls are unique for every run, so stores may be shared between tests
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sajoniks/GoShort/internal/store/interface"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Factory returns the store under test. Store is closed by the caller, if needed
+type Factory func(t *testing.T) urlstore.Store
+
+var runId atomic.Int64
+
+// names generates aliases and urls not used by other tests
+type names struct {
+	prefix string
+}
+
+func newNames(t *testing.T) names {
+	return names{prefix: fmt.Sprintf("c%d-%d", time.Now().UnixNano(), runId.Add(1))}
+}
+
+func (n names) alias(name string) string {
+	return n.prefix + "-" + name
+}
+
+func (n names) url(name string) string {
+	return "https://example.com/" + n.prefix + "/" + name
+}
+
+// Run runs the whole suite against stores created by newStore
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s urlstore.Store, n names)
+	}{
+		{"SaveAndGet", testSaveAndGet},
+		{"SaveEmpty", testSaveEmpty},
+		{"SaveDuplicateAlias", testSaveDuplicateAlias},
+		{"SaveDuplicateUrl", testSaveDuplicateUrl},
+		{"GetMissing", testGetMissing},
+		{"Expiry", testExpiry},
+		{"GetURLExpiry", testGetURLExpiry},
+		{"SaveURLs", testSaveURLs},
+		{"FindAlias", testFindAlias},
+		{"Update", testUpdate},
+		{"Delete", testDelete},
+		{"PurgeExpired", testPurgeExpired},
+		{"Outbox", testOutbox},
+		{"Concurrent", testConcurrent},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newStore(t), newNames(t))
+		})
+	}
+}
+
+func testSaveAndGet(t *testing.T, s urlstore.Store, n names) {
+	id1, err := s.SaveURL(n.url("a"), n.alias("a"))
+	require.NoError(t, err)
+	require.NotEmpty(t, id1)
+
+	id2, err := s.SaveURL(n.url("b"), n.alias("b"), urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+	require.NotEqual(t, id1, id2)
+
+	src, err := s.GetURL(n.alias("a"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("a"), src)
+
+	src, err = s.GetURL(n.alias("b"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("b"), src)
+}
+
+func testSaveEmpty(t *testing.T, s urlstore.Store, n names) {
+	_, err := s.SaveURL(n.url("a"), "")
+	require.ErrorIs(t, err, urlstore.ErrAliasEmpty)
+
+	_, err = s.SaveURL("", n.alias("a"))
+	require.ErrorIs(t, err, urlstore.ErrUrlEmpty)
+
+	_, err = s.SaveURL("   ", n.alias("a"))
+	require.ErrorIs(t, err, urlstore.ErrUrlEmpty)
+
+	_, err = s.SaveURL(n.url("a"), "   ")
+	require.Error(t, err)
+
+	_, err = s.GetURL(n.alias("a"))
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+}
+
+func testSaveDuplicateAlias(t *testing.T, s urlstore.Store, n names) {
+	_, err := s.SaveURL(n.url("a"), n.alias("a"))
+	require.NoError(t, err)
+
+	_, err = s.SaveURL(n.url("b"), n.alias("a"))
+	require.ErrorIs(t, err, urlstore.ErrAliasExists)
+
+	_, err = s.SaveURL(n.url("a"), n.alias("a"))
+	require.ErrorIs(t, err, urlstore.ErrAliasExists)
+
+	src, err := s.GetURL(n.alias("a"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("a"), src)
+}
+
+func testSaveDuplicateUrl(t *testing.T, s urlstore.Store, n names) {
+	_, err := s.SaveURL(n.url("a"), n.alias("a"))
+	require.NoError(t, err)
+
+	// the same url may be shortened many times
+	_, err = s.SaveURL(n.url("a"), n.alias("b"))
+	require.NoError(t, err)
+
+	src, err := s.GetURL(n.alias("b"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("a"), src)
+}
+
+func testGetMissing(t *testing.T, s urlstore.Store, n names) {
+	_, err := s.GetURL(n.alias("missing"))
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+}
+
+func testExpiry(t *testing.T, s urlstore.Store, n names) {
+	_, err := s.SaveURL(n.url("past"), n.alias("past"), urlstore.WithExpiry(time.Now().Add(-time.Minute)))
+	require.NoError(t, err)
+	_, err = s.SaveURL(n.url("future"), n.alias("future"), urlstore.WithExpiry(time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+
+	_, err = s.GetURL(n.alias("past"))
+	require.ErrorIs(t, err, urlstore.ErrUrlExpired)
+
+	src, err := s.GetURL(n.alias("future"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("future"), src)
+
+	// expired alias is still taken until it is purged
+	_, err = s.SaveURL(n.url("other"), n.alias("past"))
+	require.ErrorIs(t, err, urlstore.ErrAliasExists)
+}
+
+func testGetURLExpiry(t *testing.T, s urlstore.Store, n names) {
+	getter, ok := s.(urlstore.ExpiryGetter)
+	if !ok {
+		t.Skip("store does not return expiry time")
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	_, err := s.SaveURL(n.url("future"), n.alias("future"), urlstore.WithExpiry(expiresAt))
+	require.NoError(t, err)
+	_, err = s.SaveURL(n.url("forever"), n.alias("forever"))
+	require.NoError(t, err)
+	_, err = s.SaveURL(n.url("past"), n.alias("past"), urlstore.WithExpiry(time.Now().Add(-time.Minute)))
+	require.NoError(t, err)
+
+	src, at, err := getter.GetURLExpiry(n.alias("future"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("future"), src)
+	require.True(t, expiresAt.Equal(at), "expected %v, got %v", expiresAt, at)
+
+	src, at, err = getter.GetURLExpiry(n.alias("forever"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("forever"), src)
+	require.True(t, at.IsZero())
+
+	_, _, err = getter.GetURLExpiry(n.alias("past"))
+	require.ErrorIs(t, err, urlstore.ErrUrlExpired)
+	_, _, err = getter.GetURLExpiry(n.alias("missing"))
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+}
+
+func testSaveURLs(t *testing.T, s urlstore.Store, n names) {
+	_, err := s.SaveURL(n.url("taken"), n.alias("taken"))
+	require.NoError(t, err)
+
+	results, err := s.SaveURLs([]urlstore.BatchItem{
+		{Source: n.url("a"), Alias: n.alias("a")},
+		{Source: n.url("b"), Alias: n.alias("taken")},
+		{Source: "", Alias: n.alias("c")},
+		{Source: n.url("d"), Alias: ""},
+		{Source: n.url("e"), Alias: n.alias("a")},
+		{Source: n.url("f"), Alias: n.alias("f"), Options: urlstore.SaveOptions{Owner: "alice"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 6)
+
+	require.NoError(t, results[0].Err)
+	require.NotEmpty(t, results[0].ID)
+	require.ErrorIs(t, results[1].Err, urlstore.ErrAliasExists)
+	require.ErrorIs(t, results[2].Err, urlstore.ErrUrlEmpty)
+	require.ErrorIs(t, results[3].Err, urlstore.ErrAliasEmpty)
+	require.ErrorIs(t, results[4].Err, urlstore.ErrAliasExists)
+	require.NoError(t, results[5].Err)
+	require.NotEqual(t, results[0].ID, results[5].ID)
+
+	src, err := s.GetURL(n.alias("a"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("a"), src)
+
+	src, err = s.GetURL(n.alias("taken"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("taken"), src)
+
+	alias, err := s.FindAlias(n.url("f"), "alice")
+	require.NoError(t, err)
+	require.Equal(t, n.alias("f"), alias)
+
+	results, err = s.SaveURLs(nil)
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
+func testFindAlias(t *testing.T, s urlstore.Store, n names) {
+	_, err := s.SaveURL(n.url("a"), n.alias("first"), urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+	_, err = s.SaveURL(n.url("a"), n.alias("second"), urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+	_, err = s.SaveURL(n.url("a"), n.alias("anonymous"))
+	require.NoError(t, err)
+	_, err = s.SaveURL(n.url("b"), n.alias("expiring"), urlstore.WithOwner("alice"), urlstore.WithExpiry(time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+
+	alias, err := s.FindAlias(n.url("a"), "alice")
+	require.NoError(t, err)
+	require.Equal(t, n.alias("first"), alias)
+
+	alias, err = s.FindAlias(n.url("a"), "")
+	require.NoError(t, err)
+	require.Equal(t, n.alias("anonymous"), alias)
+
+	_, err = s.FindAlias(n.url("a"), "bob")
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+
+	// urls with expiry are never reused
+	_, err = s.FindAlias(n.url("b"), "alice")
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+
+	_, err = s.FindAlias(n.url("missing"), "alice")
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+}
+
+func testUpdate(t *testing.T, s urlstore.Store, n names) {
+	_, err := s.SaveURL(n.url("a"), n.alias("owned"), urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+	_, err = s.SaveURL(n.url("a"), n.alias("anonymous"))
+	require.NoError(t, err)
+
+	require.NoError(t, s.UpdateURL(n.alias("owned"), n.url("b"), "alice"))
+	src, err := s.GetURL(n.alias("owned"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("b"), src)
+
+	alias, err := s.FindAlias(n.url("b"), "alice")
+	require.NoError(t, err)
+	require.Equal(t, n.alias("owned"), alias)
+	_, err = s.FindAlias(n.url("a"), "alice")
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+
+	require.ErrorIs(t, s.UpdateURL(n.alias("owned"), n.url("c"), "bob"), urlstore.ErrNotOwner)
+	require.ErrorIs(t, s.UpdateURL(n.alias("owned"), n.url("c"), ""), urlstore.ErrNotOwner)
+	require.ErrorIs(t, s.UpdateURL(n.alias("anonymous"), n.url("c"), "alice"), urlstore.ErrNotOwner)
+	// anonymous urls can not be managed, even by anonymous callers
+	require.ErrorIs(t, s.UpdateURL(n.alias("anonymous"), n.url("c"), ""), urlstore.ErrNotOwner)
+	require.ErrorIs(t, s.UpdateURL(n.alias("missing"), n.url("c"), ""), urlstore.ErrUrlNotFound)
+
+	require.ErrorIs(t, s.UpdateURL(n.alias("missing"), n.url("c"), "alice"), urlstore.ErrUrlNotFound)
+	require.ErrorIs(t, s.UpdateURL("", n.url("c"), "alice"), urlstore.ErrAliasEmpty)
+	require.ErrorIs(t, s.UpdateURL(n.alias("owned"), "", "alice"), urlstore.ErrUrlEmpty)
+	require.ErrorIs(t, s.UpdateURL(n.alias("owned"), "   ", "alice"), urlstore.ErrUrlEmpty)
+
+	src, err = s.GetURL(n.alias("owned"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("b"), src)
+}
+
+func testDelete(t *testing.T, s urlstore.Store, n names) {
+	_, err := s.SaveURL(n.url("a"), n.alias("owned"), urlstore.WithOwner("alice"))
+	require.NoError(t, err)
+	_, err = s.SaveURL(n.url("a"), n.alias("anonymous"))
+	require.NoError(t, err)
+
+	require.ErrorIs(t, s.DeleteURL(n.alias("owned"), "bob"), urlstore.ErrNotOwner)
+	require.ErrorIs(t, s.DeleteURL(n.alias("owned"), ""), urlstore.ErrNotOwner)
+	require.ErrorIs(t, s.DeleteURL(n.alias("anonymous"), "alice"), urlstore.ErrNotOwner)
+	require.ErrorIs(t, s.DeleteURL("", "alice"), urlstore.ErrAliasEmpty)
+
+	require.NoError(t, s.DeleteURL(n.alias("owned"), "alice"))
+	_, err = s.GetURL(n.alias("owned"))
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+	_, err = s.FindAlias(n.url("a"), "alice")
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+	require.ErrorIs(t, s.DeleteURL(n.alias("owned"), "alice"), urlstore.ErrUrlNotFound)
+
+	// anonymous urls can not be managed, even by anonymous callers
+	require.ErrorIs(t, s.DeleteURL(n.alias("anonymous"), ""), urlstore.ErrNotOwner)
+	src, err := s.GetURL(n.alias("anonymous"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("a"), src)
+	require.ErrorIs(t, s.DeleteURL(n.alias("missing"), ""), urlstore.ErrUrlNotFound)
+
+	// deleted alias can be taken again
+	_, err = s.SaveURL(n.url("b"), n.alias("owned"))
+	require.NoError(t, err)
+}
+
+func testOutbox(t *testing.T, s urlstore.Store, n names) {
+	outbox, ok := s.(urlstore.Outbox)
+	if !ok {
+		t.Skip("store has no outbox")
+	}
+
+	// messages are written only with the saved urls
+	_, err := s.SaveURL(n.url("a"), n.alias("a"), urlstore.WithMessages(urlstore.OutboxMessage{Key: "a", ContentType: "text/plain", Payload: []byte("saved")}))
+	require.NoError(t, err)
+	_, err = s.SaveURL(n.url("b"), n.alias("a"), urlstore.WithMessages(urlstore.OutboxMessage{Payload: []byte("duplicate")}))
+	require.ErrorIs(t, err, urlstore.ErrAliasExists)
+	results, err := s.SaveURLs([]urlstore.BatchItem{
+		{Source: n.url("c"), Alias: n.alias("c"), Options: urlstore.NewSaveOptions(urlstore.WithMessages(urlstore.OutboxMessage{Payload: []byte("batch")}))},
+		{Source: n.url("d"), Alias: n.alias("a"), Options: urlstore.NewSaveOptions(urlstore.WithMessages(urlstore.OutboxMessage{Payload: []byte("batch duplicate")}))},
+	})
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	require.ErrorIs(t, results[1].Err, urlstore.ErrAliasExists)
+	require.NoError(t, outbox.AddMessages(
+		urlstore.OutboxMessage{Key: "c", ContentType: "application/x-protobuf", Payload: []byte("added")},
+		urlstore.OutboxMessage{Payload: []byte("added too")},
+	))
+
+	pending, err := outbox.PendingMessages(3)
+	require.NoError(t, err)
+	require.Len(t, pending, 3)
+	for i, want := range []urlstore.OutboxMessage{
+		{Key: "a", ContentType: "text/plain", Payload: []byte("saved")},
+		{Payload: []byte("batch")},
+		{Key: "c", ContentType: "application/x-protobuf", Payload: []byte("added")},
+	} {
+		require.Equal(t, want.Key, pending[i].Key)
+		require.Equal(t, want.ContentType, pending[i].ContentType)
+		require.Equal(t, string(want.Payload), string(pending[i].Payload))
+		if i > 0 {
+			require.Greater(t, pending[i].ID, pending[i-1].ID)
+		}
+	}
+
+	require.NoError(t, outbox.MarkSent(pending[0].ID, pending[1].ID))
+	pending, err = outbox.PendingMessages(10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	require.Equal(t, "added", string(pending[0].Payload))
+	require.Equal(t, "added too", string(pending[1].Payload))
+}
+
+func testPurgeExpired(t *testing.T, s urlstore.Store, n names) {
+	purger, ok := s.(urlstore.ExpiredPurger)
+	if !ok {
+		t.Skip("store does not purge expired urls")
+	}
+
+	_, err := s.SaveURL(n.url("past"), n.alias("past"), urlstore.WithExpiry(time.Now().Add(-time.Minute)))
+	require.NoError(t, err)
+	_, err = s.SaveURL(n.url("future"), n.alias("future"), urlstore.WithExpiry(time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+
+	purged, err := purger.PurgeExpired()
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, purged, int64(1))
+
+	_, err = s.GetURL(n.alias("past"))
+	require.ErrorIs(t, err, urlstore.ErrUrlNotFound)
+	_, err = s.GetURL(n.alias("future"))
+	require.NoError(t, err)
+}
+
+func testConcurrent(t *testing.T, s urlstore.Store, n names) {
+	const workers = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*2)
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprint(i)
+			if _, err := s.SaveURL(n.url(name), n.alias(name)); err != nil {
+				errs <- err
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			// all goroutines race for the same alias, only one of them wins
+			_, err := s.SaveURL(n.url("race"), n.alias("race"))
+			if err != nil && !errors.Is(err, urlstore.ErrAliasExists) {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < workers; i++ {
+		name := fmt.Sprint(i)
+		src, err := s.GetURL(n.alias(name))
+		require.NoError(t, err)
+		require.Equal(t, n.url(name), src)
+	}
+	src, err := s.GetURL(n.alias("race"))
+	require.NoError(t, err)
+	require.Equal(t, n.url("race"), src)
+}
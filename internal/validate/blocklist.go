@@ -0,0 +1,148 @@
+package validate
+
+import (
+	"bufio"
+	"context"
+	"github.com/sajoniks/GoShort/internal/trace"
+	"go.uber.org/zap"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultReloadInterval = time.Second * 5
+
+// Blocklist rejects urls of the blocked domains and their subdomains.
+//
+// Domains are loaded from a file with one domain per line. Empty lines and lines starting with '#' are ignored.
+// File is checked for changes periodically and reloaded
+type Blocklist struct {
+	path    string
+	logger  *zap.Logger
+	mx      sync.RWMutex
+	domains map[string]struct{}
+	modTime time.Time
+	size    int64
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewFileBlocklist loads blocklist from path and starts watching it for changes
+func NewFileBlocklist(path string, reloadInterval time.Duration, logger *zap.Logger) (*Blocklist, error) {
+	if reloadInterval <= 0 {
+		reloadInterval = defaultReloadInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Blocklist{
+		path:   path,
+		logger: logger.With(zap.String("blocklist", path)),
+		cancel: cancel,
+	}
+	if _, err := b.reloadIfChanged(); err != nil {
+		cancel()
+		return nil, trace.WrapError(err)
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ticker := time.NewTicker(reloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reloaded, err := b.reloadIfChanged()
+				if err != nil {
+					b.logger.Error("failed to reload blocklist", zap.Error(err))
+				} else if reloaded {
+					b.logger.Info("reloaded blocklist", zap.Int("domains", b.Len()))
+				}
+			}
+		}
+	}()
+
+	return b, nil
+}
+
+func (b *Blocklist) Close() {
+	b.cancel()
+	b.wg.Wait()
+}
+
+// Len returns number of blocked domains
+func (b *Blocklist) Len() int {
+	b.mx.RLock()
+	defer b.mx.RUnlock()
+	return len(b.domains)
+}
+
+func (b *Blocklist) reloadIfChanged() (bool, error) {
+	stat, err := os.Stat(b.path)
+	if err != nil {
+		return false, err
+	}
+
+	b.mx.RLock()
+	changed := b.domains == nil || !stat.ModTime().Equal(b.modTime) || stat.Size() != b.size
+	b.mx.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	f, err := os.Open(b.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	domains, err := parseBlocklist(f)
+	if err != nil {
+		return false, err
+	}
+
+	b.mx.Lock()
+	b.domains = domains
+	b.modTime = stat.ModTime()
+	b.size = stat.Size()
+	b.mx.Unlock()
+	return true, nil
+}
+
+func parseBlocklist(r io.Reader) (map[string]struct{}, error) {
+	domains := make(map[string]struct{})
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[normalizeHost(line)] = struct{}{}
+	}
+	return domains, sc.Err()
+}
+
+func (b *Blocklist) Check(u *url.URL) error {
+	host := normalizeHost(u.Hostname())
+
+	b.mx.RLock()
+	defer b.mx.RUnlock()
+
+	// check the host and every parent domain: a.b.example.com, b.example.com, example.com, com
+	for host != "" {
+		if _, ok := b.domains[host]; ok {
+			return ErrBlockedDomain
+		}
+		_, parent, found := strings.Cut(host, ".")
+		if !found {
+			break
+		}
+		host = parent
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package validate
+
+import (
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// normalizeHost lowercases host, removes port and trailing dot and converts internationalized names to punycode
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ascii, err := hostProfile.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}
+
+// SelfReference rejects urls pointing to one of the hosts, which would create a redirect loop.
+// Hosts may contain port, it is ignored
+func SelfReference(hosts ...string) Rule {
+	self := make(map[string]struct{})
+	for _, h := range hosts {
+		if h = normalizeHost(h); h != "" {
+			self[h] = struct{}{}
+		}
+	}
+	return RuleFunc(func(u *url.URL) error {
+		if _, ok := self[normalizeHost(u.Hostname())]; ok {
+			return ErrSelfReference
+		}
+		return nil
+	})
+}
+
+// PrivateAddress rejects urls with literal loopback, private, link-local and unspecified ip addresses,
+// localhost and single-label host names, which can be resolved only in local network.
+// Host names are not resolved
+func PrivateAddress() Rule {
+	return RuleFunc(func(u *url.URL) error {
+		host := normalizeHost(u.Hostname())
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return ErrPrivateAddress
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			if !strings.Contains(host, ".") {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+		addr = addr.Unmap()
+		if addr.IsLoopback() ||
+			addr.IsPrivate() ||
+			addr.IsLinkLocalUnicast() ||
+			addr.IsLinkLocalMulticast() ||
+			addr.IsInterfaceLocalMulticast() ||
+			addr.IsUnspecified() {
+			return ErrPrivateAddress
+		}
+		return nil
+	})
+}
@@ -0,0 +1,130 @@
+package validate
+
+import (
+	"golang.org/x/net/idna"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// Error is a rejection of the url with a machine-readable code
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	ErrInvalidUrl     = &Error{Code: "invalid_url", Message: "invalid url"}
+	ErrSelfReference  = &Error{Code: "self_reference", Message: "url points to the shortener itself"}
+	ErrPrivateAddress = &Error{Code: "private_address", Message: "url points to a private address"}
+	ErrBlockedDomain  = &Error{Code: "blocked_domain", Message: "url domain is blocked"}
+)
+
+// hostProfile converts internationalized host names to their ASCII (punycode) form
+var hostProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.BidiRule(),
+	idna.VerifyDNSLength(true),
+)
+
+// Rule checks parsed url and returns *Error if url is rejected
+type Rule interface {
+	Check(u *url.URL) error
+}
+
+type RuleFunc func(u *url.URL) error
+
+func (f RuleFunc) Check(u *url.URL) error {
+	return f(u)
+}
+
+// Validator parses urls and checks them with rules in order
+type Validator struct {
+	rules []Rule
+}
+
+func New(rules ...Rule) *Validator {
+	return &Validator{rules: rules}
+}
+
+// Validate parses and normalizes raw url, then applies rules. First rejection is returned.
+//
+// Only absolute http and https urls are accepted. Host of the returned url is lowercase ASCII:
+// internationalized names are converted to punycode, ip addresses are kept as is
+func (v *Validator) Validate(raw string) (*url.URL, error) {
+	u, err := Normalize(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range v.rules {
+		if err := r.Check(u); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// Normalize parses raw url and converts its host to the canonical form
+func Normalize(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, ErrInvalidUrl
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, ErrInvalidUrl
+	}
+	// url.Parse lowercases scheme, relative urls ("/path", "//host/path") have no scheme
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, ErrInvalidUrl
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return nil, ErrInvalidUrl
+	}
+
+	host, err := normalizeUrlHost(u.Hostname())
+	if err != nil {
+		return nil, ErrInvalidUrl
+	}
+
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+	return u, nil
+}
+
+// normalizeUrlHost validates host and returns it as ip address or ASCII domain name
+func normalizeUrlHost(host string) (string, error) {
+	if host == "" {
+		return "", ErrInvalidUrl
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if addr.Zone() != "" {
+			return "", ErrInvalidUrl
+		}
+		return addr.String(), nil
+	}
+
+	ascii, err := hostProfile.ToASCII(strings.TrimSuffix(host, "."))
+	if err != nil {
+		return "", err
+	}
+
+	// top level domain can not be numeric, otherwise it is a malformed ip address
+	tld := ascii[strings.LastIndexByte(ascii, '.')+1:]
+	if strings.Trim(tld, "0123456789") == "" {
+		return "", ErrInvalidUrl
+	}
+	return ascii, nil
+}
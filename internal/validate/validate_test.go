@@ -0,0 +1,91 @@
+package validate
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidator(t *testing.T) {
+	v := New(SelfReference("goshort:8080", "sho.rt"), PrivateAddress())
+
+	tt := []struct {
+		name string
+		url  string
+		err  error
+	}{
+		{name: "public", url: "https://www.example.com/path?q=1"},
+		{name: "public ip", url: "http://93.184.216.34/"},
+		{name: "empty", url: "", err: ErrInvalidUrl},
+		{name: "no scheme", url: "www.example.com", err: ErrInvalidUrl},
+		{name: "ftp", url: "ftp://example.com", err: ErrInvalidUrl},
+		{name: "no host", url: "https://", err: ErrInvalidUrl},
+		{name: "self", url: "http://goshort/abc", err: ErrSelfReference},
+		{name: "self with port", url: "http://goshort:8080/abc", err: ErrSelfReference},
+		{name: "self uppercase", url: "https://SHO.RT./abc", err: ErrSelfReference},
+		{name: "localhost", url: "http://localhost:3000", err: ErrPrivateAddress},
+		{name: "loopback", url: "http://127.0.0.1", err: ErrPrivateAddress},
+		{name: "private 10", url: "http://10.1.2.3", err: ErrPrivateAddress},
+		{name: "private 172", url: "http://172.16.0.1", err: ErrPrivateAddress},
+		{name: "private 192", url: "http://192.168.1.1", err: ErrPrivateAddress},
+		{name: "link local", url: "http://169.254.169.254", err: ErrPrivateAddress},
+		{name: "unspecified", url: "http://0.0.0.0", err: ErrPrivateAddress},
+		{name: "ipv6 loopback", url: "http://[::1]:8080/", err: ErrPrivateAddress},
+		{name: "ipv6 unique local", url: "http://[fd00::1]/", err: ErrPrivateAddress},
+		{name: "ipv6 link local", url: "http://[fe80::1]/", err: ErrPrivateAddress},
+		{name: "ipv4 mapped", url: "http://[::ffff:127.0.0.1]/", err: ErrPrivateAddress},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := v.Validate(tc.url)
+			if tc.err == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# banned\nevil.com\n\nBAD.example.org\n"), 0o644))
+
+	b, err := NewFileBlocklist(path, time.Millisecond*10, zap.NewNop())
+	require.NoError(t, err)
+	defer b.Close()
+
+	v := New(b)
+
+	_, err = v.Validate("https://evil.com/x")
+	require.ErrorIs(t, err, ErrBlockedDomain)
+	_, err = v.Validate("https://www.evil.com/x")
+	require.ErrorIs(t, err, ErrBlockedDomain)
+	_, err = v.Validate("https://bad.example.org")
+	require.ErrorIs(t, err, ErrBlockedDomain)
+	_, err = v.Validate("https://notevil.com")
+	require.NoError(t, err)
+	_, err = v.Validate("https://example.org")
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("notevil.com\n"), 0o644))
+	// make sure modification time differs on filesystems with coarse timestamps
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+
+	require.Eventually(t, func() bool {
+		_, err := v.Validate("https://evil.com")
+		return err == nil
+	}, time.Second, time.Millisecond*10)
+
+	_, err = v.Validate("https://notevil.com")
+	require.ErrorIs(t, err, ErrBlockedDomain)
+}
+
+func TestBlocklist_MissingFile(t *testing.T) {
+	_, err := NewFileBlocklist(filepath.Join(t.TempDir(), "missing.txt"), 0, zap.NewNop())
+	require.Error(t, err)
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/sajoniks/GoShort/internal/http-server/handlers/save"
 	"net/http"
 	"net/url"
+	"os"
 	"testing"
 )
 
@@ -12,9 +13,16 @@ const (
 	host string = "localhost:8080"
 )
 
+// withApiKey sets api key taken from GOSHRT_API_KEY environment variable
+func withApiKey(r *httpexpect.Request) {
+	if key := os.Getenv("GOSHRT_API_KEY"); key != "" {
+		r.WithHeader("Authorization", "Bearer "+key)
+	}
+}
+
 func getDefaultClient(t *testing.T) *httpexpect.Expect {
 	u := url.URL{Scheme: "http", Host: host}
-	return httpexpect.Default(t, u.String())
+	return httpexpect.Default(t, u.String()).Builder(withApiKey)
 }
 
 func getNonRedirectClient(t *testing.T) *httpexpect.Expect {
@@ -31,7 +39,7 @@ func getNonRedirectClient(t *testing.T) *httpexpect.Expect {
 				},
 			},
 		},
-	)
+	).Builder(withApiKey)
 }
 
 func TestUrlShortener_SuccessPost(t *testing.T) {